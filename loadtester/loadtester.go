@@ -2,14 +2,18 @@ package main
 
 import (
 	"bufio"
-	"log"
+	"crypto/tls"
+	"flag"
+	"fmt"
 	"math/rand"
 	"net"
 	"os"
 	"time"
 
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
 	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
 	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+	"github.com/gabriel-comeau/multiplayer-game-test/transport"
 )
 
 type TestPlayer struct {
@@ -24,10 +28,52 @@ const (
 	COUNTER_MAX int           = 5
 )
 
+var (
+	// Test players join as this name with a number on the end, using the same credential
+	username   string
+	credential string
+
+	// Room to put the test players in, empty to leave them in the server's default room
+	room string
+
+	// Queue the test players for matches instead
+	queue bool
+
+	// TLS settings shared by all the test players, nil for plain TCP
+	tlsConfig *tls.Config
+
+	// The per-message lines are at debug level and rate limited, since every test player sends
+	// and receives dozens of messages a second.  See the logging package.
+	testLog    = logging.For("loadtest")
+	testHotLog = logging.RateLimited(testLog, time.Second)
+)
+
 func main() {
+	flag.StringVar(&username, "user", "loadtest", "username prefix for the test players")
+	flag.StringVar(&credential, "credential", "", "password, shared secret or token to authenticate with")
+	flag.StringVar(&room, "room", "", "room to put the test players in, created if it doesn't exist")
+	flag.BoolVar(&queue, "queue", false, "queue the test players for matches")
+	useTLS := flag.Bool("tls", false, "connect to the server over TLS")
+	tlsPin := flag.String("tls-pin", "", "only trust a server certificate with this SHA-256 fingerprint (hex)")
+	tlsInsecure := flag.Bool("tls-insecure", false, "don't verify the server certificate at all")
+	logFlags := logging.RegisterFlags()
+	flag.Parse()
+
+	if err := logFlags.Apply(); err != nil {
+		logging.Fatal(testLog, "Bad logging configuration", logging.ERROR, err)
+	}
+
+	if *useTLS {
+		var err error
+		tlsConfig, err = transport.ClientConfig(shared.HOST, *tlsPin, *tlsInsecure)
+		if err != nil {
+			logging.Fatal(testLog, "Bad TLS configuration", logging.ERROR, err)
+		}
+	}
+
 	for i := 0; i < NUM_CLIENTS; i++ {
-		log.Print("Launching client:", i)
-		launchClient()
+		testLog.Info("Launching client", "index", i)
+		launchClient(fmt.Sprintf("%v%v", username, i))
 	}
 
 	for {
@@ -35,10 +81,25 @@ func main() {
 	}
 }
 
-func launchClient() {
+func launchClient(name string) {
 	testPlayer := new(TestPlayer)
-	testPlayer.conn, testPlayer.playerId = connectToServer()
-	log.Printf("Got a uuid of: %v\n", testPlayer.playerId)
+	start := time.Now()
+	testPlayer.conn, testPlayer.playerId = connectToServer(name)
+
+	// Includes the TLS handshake when -tls is on, so this is where its cost shows up
+	testLog.Info("Joined", logging.PLAYER_ID, testPlayer.playerId, "connect_time", time.Since(start))
+
+	// Whichever test player gets there first creates the room, the create fails for the rest and
+	// they join it instead.  For the first one the join is refused, since it's already there.
+	if room != "" {
+		testPlayer.conn.Write(protocol.CreateCreateRoomMessage(room, protocol.RoomSettings{}).Encode())
+		testPlayer.conn.Write(protocol.CreateJoinRoomMessage(room).Encode())
+	}
+
+	if queue {
+		testPlayer.conn.Write(protocol.CreateQueueMatchMessage().Encode())
+	}
+
 	go listenForMessages(testPlayer)
 	go runTestPlayer(testPlayer)
 
@@ -49,11 +110,16 @@ func runTestPlayer(testPlayer *TestPlayer) {
 
 	// Preset up the timestep stuff so there's a value for the first iteration of the loop
 	lastTick := time.Now()
-	var dt time.Duration = 0
+	var dt time.Duration
 	var inputState *shared.InputState
 	var counter int = 0
 
 	for {
+		// The delta we report is the real time since the last message went out
+		now := time.Now()
+		dt = now.Sub(lastTick)
+		lastTick = now
+
 		// Generate a new random input state if the counter is zero.  We don't want to send
 		// a new input state each tick or the movement is too wacky.
 		if counter == 0 {
@@ -64,33 +130,30 @@ func runTestPlayer(testPlayer *TestPlayer) {
 		testPlayer.conn.Write(msg.Encode())
 		testPlayer.lastSeq++
 
-		log.Printf("Sending message from client %v: %+v\n", testPlayer.playerId, msg)
+		testHotLog.Debug("Sending message", logging.PLAYER_ID, testPlayer.playerId, logging.SEQ, msg.Seq, logging.MESSAGE_TYPE, msg.GetMessageType())
 
 		counter++
 		if counter > COUNTER_MAX {
 			counter = 0
 		}
 
-		// Get how long it took to do all of this
-		now := time.Now()
-		dt = now.Sub(lastTick)
-		lastTick = now
-
-		if dt < SLEEP_TIME {
-			time.Sleep(SLEEP_TIME - dt)
+		// Sleep off whatever is left of this tick after the work it took to send.  The delta for
+		// the next message is measured separately, so every message has to wait its turn.
+		work := time.Since(now)
+		if work < SLEEP_TIME {
+			time.Sleep(SLEEP_TIME - work)
 		}
 
-		log.Printf("Client %v made it out of sleep loop\n", testPlayer.playerId)
 	}
 }
 
 // Get a random input state
 func generateRandomInputState() *shared.InputState {
 	is := new(shared.InputState)
-	is.KeyUpDown = coinToss()
-	is.KeyDownDown = coinToss()
-	is.KeyLeftDown = coinToss()
-	is.KeyRightDown = coinToss()
+	is.Set(shared.ACTION_UP, coinToss())
+	is.Set(shared.ACTION_DOWN, coinToss())
+	is.Set(shared.ACTION_LEFT, coinToss())
+	is.Set(shared.ACTION_RIGHT, coinToss())
 
 	return is
 }
@@ -108,13 +171,16 @@ func coinToss() bool {
 }
 
 // Establish a connection to the game server, return the network connection and the uuid
-func connectToServer() (net.Conn, int64) {
+func connectToServer(name string) (net.Conn, int64) {
 	var playerId int64
-	conn, err := net.Dial("tcp", shared.HOST+":"+shared.PORT)
+	conn, err := transport.Dial(shared.HOST+":"+shared.PORT, tlsConfig)
 	if err != nil {
 		panic(err.Error())
 	}
 
+	// Test players always join as brand new players
+	conn.Write(protocol.CreateJoinMessage(name, credential, "", false).Encode())
+
 	// Now we're going to wait for the server to give us an entity ID
 	b := bufio.NewReader(conn)
 	for {
@@ -122,7 +188,7 @@ func connectToServer() (net.Conn, int64) {
 
 		if err != nil {
 			conn.Close()
-			log.Print("Error while trying to accept player id")
+			testLog.Error("Error while trying to accept player id", logging.ERROR, err)
 			os.Exit(1)
 			break
 		}
@@ -133,22 +199,30 @@ func connectToServer() (net.Conn, int64) {
 
 		message, err := protocol.DecodeMessage(line)
 		if err != nil {
-			log.Print("ERROR during decode: " + err.Error())
+			testLog.Error("Error during decode", logging.ERROR, err)
 			continue
 		}
 
 		if message.GetMessageType() == protocol.PLAYER_UUID_MESSAGE {
 			typed, ok := message.(*protocol.PlayerUUIDMessage)
 			if !ok {
-				log.Print("Message couldn't be asserted into PlayerUUIDMessage though that was message id")
+				testLog.Error("Message couldn't be asserted into PlayerUUIDMessage though that was message id")
 				conn.Close()
 				os.Exit(1)
 			}
 
 			playerId = typed.UUID
 			break
+		} else if message.GetMessageType() == protocol.JOIN_REJECTED_MESSAGE {
+			typed, _ := message.(*protocol.JoinRejectedMessage)
+			testLog.Error("Server rejected the test player", "reason", typed.Reason)
+			conn.Close()
+			os.Exit(1)
+		} else if message.GetMessageType() == protocol.QUEUE_STATUS_MESSAGE {
+			typed, _ := message.(*protocol.QueueStatusMessage)
+			testLog.Info("Server is full, test player is queued", "position", typed.Position, "queue_length", typed.Length)
 		} else {
-			log.Print("Got the wrong type of message - expected PLAYER_UUID_MESSAGE")
+			testLog.Error("Got the wrong type of message, expected PLAYER_UUID_MESSAGE", logging.MESSAGE_TYPE, message.GetMessageType())
 			conn.Close()
 			os.Exit(1)
 		}
@@ -168,7 +242,7 @@ func listenForMessages(testPlayer *TestPlayer) {
 
 		if err != nil {
 			testPlayer.conn.Close()
-			log.Print("ERROR, CLOSING CONN: " + err.Error())
+			testLog.Error("Closing connection", logging.PLAYER_ID, testPlayer.playerId, logging.ERROR, err)
 			break
 		}
 
@@ -179,11 +253,42 @@ func listenForMessages(testPlayer *TestPlayer) {
 		// Deal with incoming messages from the server
 		message, err := protocol.DecodeMessage(line)
 		if err != nil {
-			log.Print("Error decoding message: " + err.Error())
+			testHotLog.Error("Error decoding message", logging.PLAYER_ID, testPlayer.playerId, logging.ERROR, err)
+			continue
+		}
+
+		if typed, ok := message.(*protocol.DisconnectMessage); ok {
+			testLog.Warn("Disconnected by the server", logging.PLAYER_ID, testPlayer.playerId, "reason", typed.Reason)
+			testPlayer.conn.Close()
+			break
+		}
+
+		if typed, ok := message.(*protocol.PingMessage); ok {
+			testPlayer.conn.Write(protocol.CreatePongMessage(typed.SentTime).Encode())
+			continue
+		}
+
+		if typed, ok := message.(*protocol.MatchFoundMessage); ok {
+			testLog.Info("Match found", logging.PLAYER_ID, testPlayer.playerId, "match_id", typed.MatchId, "players", typed.Players)
+			continue
+		}
+
+		if typed, ok := message.(*protocol.MatchEndedMessage); ok {
+			testLog.Info("Match over", logging.PLAYER_ID, testPlayer.playerId, "match_id", typed.MatchId, "reason", typed.Reason)
+			continue
+		}
+
+		if typed, ok := message.(*protocol.QueueRejectedMessage); ok {
+			testLog.Warn("Couldn't queue for a match", logging.PLAYER_ID, testPlayer.playerId, "reason", typed.Reason)
+			continue
+		}
+
+		if typed, ok := message.(*protocol.RoomChangedMessage); ok {
+			testLog.Debug("Room changed", logging.PLAYER_ID, testPlayer.playerId, "room", typed.Room, "reason", typed.Reason)
 			continue
 		}
 
-		// We don't really care about the messages right now, just print it out
-		log.Printf("Client: %v recieved world state message: %v\n", testPlayer.playerId, message)
+		// We don't really care about the messages right now, just note that they came in
+		testHotLog.Debug("Received message", logging.PLAYER_ID, testPlayer.playerId, logging.MESSAGE_TYPE, message.GetMessageType())
 	}
 }
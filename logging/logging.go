@@ -0,0 +1,400 @@
+// Logging sets up structured, leveled loggers (log/slog) for all of the binaries.  Every part of
+// a program asks for the logger of its subsystem, and the level and format of each subsystem can be
+// set on its own from the command line, e.g. "info,net=debug:json,validation=warn".
+package logging
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attribute keys used across the project, so the same thing is always called the same name
+const (
+	PLAYER_ID    = "player_id"
+	SEQ          = "seq"
+	MESSAGE_TYPE = "message_type"
+	SUBSYSTEM    = "subsystem"
+	ADDR         = "addr"
+	ERROR        = "error"
+)
+
+var (
+	lock sync.Mutex
+
+	// Where log lines go, and their format for subsystems without one of their own
+	output io.Writer = os.Stderr
+	format string    = "text"
+
+	// Formats of individual subsystems, for the ones which have been given one
+	formats = make(map[string]string)
+
+	// Level for subsystems without one of their own
+	defaultLevel = new(slog.LevelVar)
+
+	// Levels of individual subsystems.  The same LevelVar is shared with every logger handed out
+	// for the subsystem, so reconfiguring takes effect on loggers which already exist.
+	levels = make(map[string]*slog.LevelVar)
+
+	// Which subsystems have had a level set explicitly, rather than following the default
+	explicit = make(map[string]bool)
+
+	// Bumped every time the output or format changes, so handlers know to rebuild themselves
+	generation int
+)
+
+// Set the log levels and output formats.  The spec is a comma separated list of levels, where a
+// bare level sets the default and subsystem=level overrides it for one subsystem.  Any of them can
+// have a format on the end after a colon, like "net=debug:json", to write that subsystem's lines
+// (or everyone's, on a bare level) in a format other than logFormat.  Formats are "text" or "json".
+func Configure(spec, logFormat string, w io.Writer) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if err := checkFormat(logFormat); err != nil {
+		return err
+	}
+	format = logFormat
+	if w != nil {
+		output = w
+	}
+	generation++
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, levelText, found := strings.Cut(part, "=")
+		if !found {
+			levelText = name
+			name = ""
+		}
+
+		levelText, partFormat, hasFormat := strings.Cut(levelText, ":")
+		if hasFormat {
+			if err := checkFormat(partFormat); err != nil {
+				return err
+			}
+		}
+
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(levelText)); err != nil {
+			return fmt.Errorf("bad log level %q: %v", levelText, err)
+		}
+
+		if name == "" {
+			defaultLevel.Set(level)
+			if hasFormat {
+				format = partFormat
+			}
+		} else {
+			levelFor(name).Set(level)
+			explicit[name] = true
+			if hasFormat {
+				formats[name] = partFormat
+			}
+		}
+	}
+
+	// Subsystems which were never given their own level follow the new default
+	for name, lv := range levels {
+		if !explicit[name] {
+			lv.Set(defaultLevel.Level())
+		}
+	}
+
+	return nil
+}
+
+// Get the logger for a subsystem.  Every line it writes is tagged with the subsystem's name.
+// Loggers can be handed out before Configure is called (package level variables are fine), they
+// pick up the configuration whenever it changes.
+func For(subsystem string) *slog.Logger {
+	lock.Lock()
+	defer lock.Unlock()
+
+	handler := &subsystemHandler{
+		subsystem: subsystem,
+		level:     levelFor(subsystem),
+		shared:    &subsystemCache{gen: -1},
+	}
+
+	return slog.New(handler).With(SUBSYSTEM, subsystem)
+}
+
+// Wrap a logger so each distinct message is written at most once per interval for each player.
+// Lines that get swallowed are counted, and the count is added to the next line with the same
+// message (about the same player) that makes it through, or written with the last swallowed line
+// if no other line like it comes along before it's forgotten.  Meant for things which can happen on
+// every message or every tick.  Lines are told apart by their message and PLAYER_ID attribute
+// only, since the rest (sequence numbers, scores, errors) is different on nearly every line.
+func RateLimited(logger *slog.Logger, interval time.Duration) *slog.Logger {
+	return slog.New(&rateLimitHandler{
+		next:  logger.Handler(),
+		state: &rateLimitState{interval: interval, seen: make(map[string]*rateLimitEntry)},
+	})
+}
+
+// Log an error and exit the program, the slog version of log.Fatal
+func Fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// The logging command line flags, as registered by RegisterFlags
+type Flags struct {
+	level  *string
+	format *string
+}
+
+// Register the -log-level and -log-format flags on the default flag set.  Call Apply once the
+// flags have been parsed.
+func RegisterFlags() *Flags {
+	return &Flags{
+		level:  flag.String("log-level", "info", "log levels as a default plus per-subsystem overrides, each with an optional format, e.g. info,net=debug:json"),
+		format: flag.String("log-format", "text", "log output format: text or json, for subsystems without their own in -log-level"),
+	}
+}
+
+// Configure logging from the parsed flags
+func (f *Flags) Apply() error {
+	return Configure(*f.level, *f.format, nil)
+}
+
+// Get (making it if needed) the level of a subsystem.  Must be called with the lock held.
+func levelFor(subsystem string) *slog.LevelVar {
+	lv, ok := levels[subsystem]
+	if !ok {
+		lv = new(slog.LevelVar)
+		lv.Set(defaultLevel.Level())
+		levels[subsystem] = lv
+	}
+
+	return lv
+}
+
+// Check a log format is one we know how to write
+func checkFormat(logFormat string) error {
+	if logFormat != "text" && logFormat != "json" {
+		return fmt.Errorf("unknown log format %q", logFormat)
+	}
+	return nil
+}
+
+// Build the handler which actually writes a subsystem's lines out, according to the current output
+// and the subsystem's format.  Must be called with the lock held.
+func rootHandler(subsystem string) slog.Handler {
+	// Level filtering is done by subsystemHandler, so let everything through here
+	opts := &slog.HandlerOptions{Level: slog.Level(-1000)}
+
+	subsystemFormat, ok := formats[subsystem]
+	if !ok {
+		subsystemFormat = format
+	}
+
+	if subsystemFormat == "json" {
+		return slog.NewJSONHandler(output, opts)
+	}
+	return slog.NewTextHandler(output, opts)
+}
+
+// The handler built for the current configuration, remembered until the configuration changes
+type subsystemCache struct {
+	lock    sync.Mutex
+	gen     int
+	handler slog.Handler
+}
+
+// slog.Handler for a subsystem.  It filters on the subsystem's level and writes through a root
+// handler which is rebuilt when the configuration changes.  Attributes and groups added with
+// With / WithGroup are remembered as steps and replayed onto the new root handler.
+type subsystemHandler struct {
+	subsystem string
+	level     *slog.LevelVar
+	steps     []func(slog.Handler) slog.Handler
+	shared    *subsystemCache
+}
+
+// slog.Handler interface
+func (h *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// slog.Handler interface
+func (h *subsystemHandler) Handle(ctx context.Context, record slog.Record) error {
+	lock.Lock()
+	gen := generation
+	h.shared.lock.Lock()
+	if h.shared.gen != gen {
+		handler := rootHandler(h.subsystem)
+		for _, step := range h.steps {
+			handler = step(handler)
+		}
+		h.shared.handler = handler
+		h.shared.gen = gen
+	}
+	handler := h.shared.handler
+	h.shared.lock.Unlock()
+	lock.Unlock()
+
+	return handler.Handle(ctx, record)
+}
+
+// slog.Handler interface
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.withStep(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+// slog.Handler interface
+func (h *subsystemHandler) WithGroup(name string) slog.Handler {
+	return h.withStep(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+// Make a copy of the handler with one more step, and its own cache
+func (h *subsystemHandler) withStep(step func(slog.Handler) slog.Handler) slog.Handler {
+	steps := make([]func(slog.Handler) slog.Handler, len(h.steps), len(h.steps)+1)
+	copy(steps, h.steps)
+
+	return &subsystemHandler{
+		subsystem: h.subsystem,
+		level:     h.level,
+		steps:     append(steps, step),
+		shared:    &subsystemCache{gen: -1},
+	}
+}
+
+// Tracking for one message in a rate limited logger
+type rateLimitEntry struct {
+	last       time.Time
+	suppressed int
+
+	// The newest line which was swallowed, and the handler it would have gone to, so the count
+	// still gets written out if the entry is cleared away before another line like it comes along
+	pending     slog.Record
+	pendingNext slog.Handler
+}
+
+// Shared between a rate limited handler and the handlers derived from it with WithAttrs, so
+// they all count against the same limits.  Keyed by message and player.
+type rateLimitState struct {
+	lock     sync.Mutex
+	interval time.Duration
+	seen     map[string]*rateLimitEntry
+
+	// When entries which have gone quiet were last cleared out, so players who are long gone
+	// don't keep theirs forever
+	lastPrune time.Time
+}
+
+// slog.Handler which drops records whose message was already logged for the same player within
+// the interval
+type rateLimitHandler struct {
+	next  slog.Handler
+	state *rateLimitState
+
+	// The player the handler's lines are about, if one was added with WithAttrs
+	player string
+}
+
+// slog.Handler interface
+func (h *rateLimitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// slog.Handler interface
+func (h *rateLimitHandler) Handle(ctx context.Context, record slog.Record) error {
+	player := h.player
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr.Key == PLAYER_ID {
+			player = attr.Value.String()
+			return false
+		}
+		return true
+	})
+	key := record.Message + "\x00" + player
+
+	// Entries which have gone quiet are cleared out, but a count of swallowed lines is never lost:
+	// the last line swallowed is written with the count once it's cleared away.  The entry for
+	// this line is left alone, this line will carry its count.
+	summaries := make([]*rateLimitEntry, 0)
+	h.state.lock.Lock()
+	if record.Time.Sub(h.state.lastPrune) >= h.state.interval {
+		for k, e := range h.state.seen {
+			if k != key && record.Time.Sub(e.last) >= h.state.interval {
+				if e.suppressed > 0 {
+					summaries = append(summaries, e)
+				}
+				delete(h.state.seen, k)
+			}
+		}
+		h.state.lastPrune = record.Time
+	}
+
+	entry, ok := h.state.seen[key]
+	if !ok {
+		entry = new(rateLimitEntry)
+		h.state.seen[key] = entry
+	}
+
+	if !entry.last.IsZero() && record.Time.Sub(entry.last) < h.state.interval {
+		entry.suppressed++
+		entry.pending = record.Clone()
+		entry.pendingNext = h.next
+		h.state.lock.Unlock()
+		return writeSummaries(ctx, summaries)
+	}
+
+	suppressed := entry.suppressed
+	entry.suppressed = 0
+	entry.pending, entry.pendingNext = slog.Record{}, nil
+	entry.last = record.Time
+	h.state.lock.Unlock()
+
+	if err := writeSummaries(ctx, summaries); err != nil {
+		return err
+	}
+
+	if suppressed > 0 {
+		record = record.Clone()
+		record.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+
+	return h.next.Handle(ctx, record)
+}
+
+// Write out the last swallowed line of each entry, with how many were swallowed.  The entries have
+// already been taken out of the state, so no lock is needed.
+func writeSummaries(ctx context.Context, entries []*rateLimitEntry) error {
+	for _, entry := range entries {
+		record := entry.pending
+		record.AddAttrs(slog.Int("suppressed", entry.suppressed))
+		if err := entry.pendingNext.Handle(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// slog.Handler interface
+func (h *rateLimitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	player := h.player
+	for _, attr := range attrs {
+		if attr.Key == PLAYER_ID {
+			player = attr.Value.String()
+		}
+	}
+	return &rateLimitHandler{next: h.next.WithAttrs(attrs), state: h.state, player: player}
+}
+
+// slog.Handler interface
+func (h *rateLimitHandler) WithGroup(name string) slog.Handler {
+	return &rateLimitHandler{next: h.next.WithGroup(name), state: h.state, player: h.player}
+}
@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// slog.Handler which keeps every record it's given
+type captureHandler struct {
+	records *[]slog.Record
+}
+
+func (h captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h captureHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h captureHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h captureHandler) Handle(ctx context.Context, record slog.Record) error {
+	*h.records = append(*h.records, record)
+	return nil
+}
+
+// One line handed to the rate limited logger: when, relative to the first, its message and
+// player
+type limitedLine struct {
+	at      time.Duration
+	message string
+	player  string
+}
+
+// What came out the other end: the message, the player and the suppressed count (0 if none)
+type writtenLine struct {
+	message    string
+	player     string
+	suppressed int64
+}
+
+func TestRateLimited(t *testing.T) {
+	second := time.Second
+	ms := time.Millisecond
+
+	tests := []struct {
+		name  string
+		lines []limitedLine
+		want  []writtenLine
+	}{
+		{
+			name:  "repeats swallowed and counted",
+			lines: []limitedLine{{0, "bad input", "1"}, {100 * ms, "bad input", "1"}, {200 * ms, "bad input", "1"}, {second, "bad input", "1"}},
+			want:  []writtenLine{{"bad input", "1", 0}, {"bad input", "1", 2}},
+		},
+		{
+			name:  "players counted apart",
+			lines: []limitedLine{{0, "bad input", "1"}, {1, "bad input", "2"}, {2, "bad input", "1"}, {3, "bad input", "2"}},
+			want:  []writtenLine{{"bad input", "1", 0}, {"bad input", "2", 0}},
+		},
+		{
+			name:  "messages counted apart",
+			lines: []limitedLine{{0, "bad input", "1"}, {1, "too fast", "1"}, {2, "too fast", "1"}},
+			want:  []writtenLine{{"bad input", "1", 0}, {"too fast", "1", 0}},
+		},
+		{
+			name:  "nothing swallowed after the interval",
+			lines: []limitedLine{{0, "bad input", "1"}, {second, "bad input", "1"}, {2 * second, "bad input", "1"}},
+			want:  []writtenLine{{"bad input", "1", 0}, {"bad input", "1", 0}, {"bad input", "1", 0}},
+		},
+		{
+			// Player 1 goes quiet with two lines swallowed.  When their entry is cleared out the
+			// count comes out on the last line swallowed, before the line which triggered it.
+			name:  "count written when pruned",
+			lines: []limitedLine{{0, "bad input", "1"}, {100 * ms, "bad input", "1"}, {200 * ms, "bad input", "1"}, {3 * second, "too fast", "2"}},
+			want:  []writtenLine{{"bad input", "1", 0}, {"bad input", "1", 2}, {"too fast", "2", 0}},
+		},
+		{
+			name:  "nothing written when pruning entries with nothing swallowed",
+			lines: []limitedLine{{0, "bad input", "1"}, {3 * second, "too fast", "2"}, {3 * second, "too fast", "2"}},
+			want:  []writtenLine{{"bad input", "1", 0}, {"too fast", "2", 0}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records := make([]slog.Record, 0)
+			logger := RateLimited(slog.New(captureHandler{records: &records}), second)
+
+			start := time.Now()
+			for _, line := range test.lines {
+				record := slog.NewRecord(start.Add(line.at), slog.LevelWarn, line.message, 0)
+				record.AddAttrs(slog.String(PLAYER_ID, line.player))
+				if err := logger.Handler().Handle(context.Background(), record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := make([]writtenLine, 0)
+			for _, record := range records {
+				line := writtenLine{message: record.Message}
+				record.Attrs(func(attr slog.Attr) bool {
+					switch attr.Key {
+					case PLAYER_ID:
+						line.player = attr.Value.String()
+					case "suppressed":
+						line.suppressed = attr.Value.Int64()
+					}
+					return true
+				})
+				got = append(got, line)
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("wrote %+v, wanted %+v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("line %v was %+v, wanted %+v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitedWithPlayer(t *testing.T) {
+	records := make([]slog.Record, 0)
+	logger := RateLimited(slog.New(captureHandler{records: &records}), time.Minute)
+
+	// A player added up front counts the same as one added on each line
+	logger.With(PLAYER_ID, "1").Warn("bad input")
+	logger.Warn("bad input", PLAYER_ID, "1")
+	logger.With(PLAYER_ID, "2").Warn("bad input")
+
+	if len(records) != 2 {
+		t.Errorf("wrote %v lines, wanted 2", len(records))
+	}
+}
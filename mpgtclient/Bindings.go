@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	sf "bitbucket.org/krepa098/gosfml2"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Keys by the names bindings files use.  The letters and digits are filled in by init.
+var keyNames = map[string]sf.KeyCode{
+	"left":      sf.KeyLeft,
+	"right":     sf.KeyRight,
+	"up":        sf.KeyUp,
+	"down":      sf.KeyDown,
+	"space":     sf.KeySpace,
+	"tab":       sf.KeyTab,
+	"lshift":    sf.KeyLShift,
+	"rshift":    sf.KeyRShift,
+	"lcontrol":  sf.KeyLControl,
+	"rcontrol":  sf.KeyRControl,
+	"lalt":      sf.KeyLAlt,
+	"ralt":      sf.KeyRAlt,
+	"comma":     sf.KeyComma,
+	"period":    sf.KeyPeriod,
+	"slash":     sf.KeySlash,
+	"semicolon": sf.KeySemiColon,
+	"quote":     sf.KeyQuote,
+}
+
+// Mouse buttons by the names bindings files use
+var buttonNames = map[string]sf.MouseButton{
+	"mouseleft":   sf.MouseLeft,
+	"mouseright":  sf.MouseRight,
+	"mousemiddle": sf.MouseMiddle,
+	"mousex1":     sf.MouseXButton1,
+	"mousex2":     sf.MouseXButton2,
+}
+
+func init() {
+	for i := 0; i < 26; i++ {
+		keyNames[string(rune('a'+i))] = sf.KeyA + sf.KeyCode(i)
+	}
+	for i := 0; i < 10; i++ {
+		keyNames[string(rune('0'+i))] = sf.KeyNum0 + sf.KeyCode(i)
+	}
+}
+
+// Which action each key and mouse button does.  The game only ever deals in actions, so this is
+// the one place which knows about keys.  A bound key belongs to its action - whatever the client
+// would otherwise have done with it, like Tab showing the scoreboard, it doesn't any more.
+//
+// Several keys can be bound to the same action, and the action keeps going for as long as any of
+// them are held down.
+type Bindings struct {
+	keys    map[sf.KeyCode]shared.Action
+	buttons map[sf.MouseButton]shared.Action
+
+	// The bound keys and buttons being held down right now
+	heldKeys    map[sf.KeyCode]bool
+	heldButtons map[sf.MouseButton]bool
+}
+
+// Bind a key or mouse button to an action, both by name
+func (b *Bindings) Bind(input, action string) error {
+	a, err := shared.ParseAction(action)
+	if err != nil {
+		return err
+	}
+
+	name := strings.ToLower(input)
+	if key, ok := keyNames[name]; ok {
+		b.keys[key] = a
+		return nil
+	}
+	if button, ok := buttonNames[name]; ok {
+		b.buttons[button] = a
+		return nil
+	}
+
+	return fmt.Errorf("unknown key or button %q, try something like w, 1, left, space, lshift or mouseleft", input)
+}
+
+// Start or stop the action a key or mouse button event is bound to, updating the input.  Returns
+// false if the event isn't for a bound key or button, so it can go to whatever else wants it.
+func (b *Bindings) HandleEvent(event sf.Event, input *shared.InputState) bool {
+	switch ev := event.(type) {
+	case sf.EventKeyPressed:
+		if _, ok := b.keys[ev.Code]; !ok {
+			return false
+		}
+		b.heldKeys[ev.Code] = true
+
+	case sf.EventKeyReleased:
+		if _, ok := b.keys[ev.Code]; !ok {
+			return false
+		}
+		delete(b.heldKeys, ev.Code)
+
+	case sf.EventMouseButtonPressed:
+		if _, ok := b.buttons[ev.Button]; !ok {
+			return false
+		}
+		b.heldButtons[ev.Button] = true
+
+	case sf.EventMouseButtonReleased:
+		if _, ok := b.buttons[ev.Button]; !ok {
+			return false
+		}
+		delete(b.heldButtons, ev.Button)
+
+	default:
+		return false
+	}
+
+	input.Actions = b.Actions()
+	return true
+}
+
+// The actions of every bound key and button being held down
+func (b *Bindings) Actions() shared.Action {
+	var actions shared.Action
+	for key := range b.heldKeys {
+		actions |= b.keys[key]
+	}
+	for button := range b.heldButtons {
+		actions |= b.buttons[button]
+	}
+	return actions
+}
+
+// Forget about everything being held down, for when the keys are about to go somewhere else (like
+// the chat box) and we won't see them being let go
+func (b *Bindings) Release() {
+	b.heldKeys = make(map[sf.KeyCode]bool)
+	b.heldButtons = make(map[sf.MouseButton]bool)
+}
+
+// Create bindings with nothing bound
+func CreateBindings() *Bindings {
+	return &Bindings{
+		keys:        make(map[sf.KeyCode]shared.Action),
+		buttons:     make(map[sf.MouseButton]shared.Action),
+		heldKeys:    make(map[sf.KeyCode]bool),
+		heldButtons: make(map[sf.MouseButton]bool),
+	}
+}
+
+// The bindings the client uses without -bindings: the arrow keys or WASD to move, left shift to
+// sprint, E to interact and the left mouse button to fire
+func DefaultBindings() *Bindings {
+	b := CreateBindings()
+	b.keys[sf.KeyLeft] = shared.ACTION_LEFT
+	b.keys[sf.KeyRight] = shared.ACTION_RIGHT
+	b.keys[sf.KeyUp] = shared.ACTION_UP
+	b.keys[sf.KeyDown] = shared.ACTION_DOWN
+	b.keys[sf.KeyA] = shared.ACTION_LEFT
+	b.keys[sf.KeyD] = shared.ACTION_RIGHT
+	b.keys[sf.KeyW] = shared.ACTION_UP
+	b.keys[sf.KeyS] = shared.ACTION_DOWN
+	b.keys[sf.KeyLShift] = shared.ACTION_SPRINT
+	b.keys[sf.KeyE] = shared.ACTION_INTERACT
+	b.buttons[sf.MouseLeft] = shared.ACTION_FIRE
+	return b
+}
+
+// Read bindings from a file with a "key action" pair on each line, like "w up" or "mouseleft
+// fire".  Blank lines and lines starting with # are skipped.  Only what's in the file gets bound,
+// none of the defaults.  An empty path gives the DefaultBindings.
+func LoadBindings(path string) (*Bindings, error) {
+	if path == "" {
+		return DefaultBindings(), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	b := CreateBindings()
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%v:%v: expected a key or button and an action", path, lineNum)
+		}
+		if err := b.Bind(fields[0], fields[1]); err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", path, lineNum, err)
+		}
+	}
+
+	return b, scanner.Err()
+}
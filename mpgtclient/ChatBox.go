@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	sf "bitbucket.org/krepa098/gosfml2"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+)
+
+const (
+	// How many lines of chat are on screen at once, and how many are kept to scroll back through
+	CHAT_VISIBLE_LINES int = 8
+	CHAT_HISTORY_LINES int = 100
+
+	// Size of the chat text and the space between lines, in pixels
+	CHAT_FONT_SIZE   uint    = 14
+	CHAT_LINE_HEIGHT float32 = 18
+
+	// Where the bottom line of the chat box sits, measured from the bottom left of the window
+	CHAT_MARGIN float32 = 10
+
+	// Longest line we'll let the player type.  The server has its own limit, which may be lower.
+	CHAT_MAX_INPUT int = 200
+)
+
+// Colours for each kind of chat line
+var chatColors = map[protocol.ChatScope]sf.Color{
+	protocol.CHAT_SCOPE_GLOBAL:  sf.Color{255, 255, 255, 255},
+	protocol.CHAT_SCOPE_TEAM:    sf.Color{120, 220, 120, 255},
+	protocol.CHAT_SCOPE_WHISPER: sf.Color{220, 120, 220, 255},
+	protocol.CHAT_SCOPE_SYSTEM:  sf.Color{240, 220, 90, 255},
+}
+
+// One line of the chat log, ready to draw
+type chatLine struct {
+	text  string
+	color sf.Color
+}
+
+// The on-screen chat log, plus the line the player is typing.  Enter starts typing, Enter again
+// sends and escape gives up.  While the player is typing every key goes to the chat box instead of
+// moving the player, and page up / page down scroll back through the log.
+//
+// What gets typed goes to everyone, unless it starts with "/t " (team only) or "/w name " (a
+// whisper to that player).
+type ChatBox struct {
+	// Nil if the font couldn't be loaded, in which case chat only goes to the log
+	font *sf.Font
+	text *sf.Text
+
+	lines []chatLine
+
+	// How many lines up from the newest one the log is scrolled
+	scroll int
+
+	typing bool
+	input  []rune
+}
+
+// Whether the player is typing a line of chat
+func (cb *ChatBox) IsTyping() bool {
+	return cb.typing
+}
+
+// Start typing a new line
+func (cb *ChatBox) Open() {
+	cb.typing = true
+	cb.input = cb.input[:0]
+}
+
+// Add a line of chat from the server to the log.  myId is our own player ID, so whispers we sent
+// can be told apart from whispers sent to us.
+func (cb *ChatBox) Add(msg *protocol.ChatMessage, myId int64) {
+	var line string
+	switch msg.Scope {
+	case protocol.CHAT_SCOPE_TEAM:
+		line = fmt.Sprintf("[team] %v: %v", msg.From, msg.Text)
+	case protocol.CHAT_SCOPE_WHISPER:
+		if msg.FromId == myId {
+			line = fmt.Sprintf("[to %v] %v", msg.Target, msg.Text)
+		} else {
+			line = fmt.Sprintf("[from %v] %v", msg.From, msg.Text)
+		}
+	case protocol.CHAT_SCOPE_SYSTEM:
+		line = "* " + msg.Text
+	default:
+		line = fmt.Sprintf("%v: %v", msg.From, msg.Text)
+	}
+
+	gameLog.Info("Chat", "line", line)
+
+	color, ok := chatColors[msg.Scope]
+	if !ok {
+		color = chatColors[protocol.CHAT_SCOPE_GLOBAL]
+	}
+
+	cb.lines = append(cb.lines, chatLine{text: line, color: color})
+	if len(cb.lines) > CHAT_HISTORY_LINES {
+		cb.lines = cb.lines[len(cb.lines)-CHAT_HISTORY_LINES:]
+	}
+
+	// Stay put if the player has scrolled back to read something
+	if cb.scroll > 0 {
+		cb.Scroll(1)
+	}
+}
+
+// Scroll the log back (positive) or forward (negative) by some number of lines
+func (cb *ChatBox) Scroll(lines int) {
+	cb.scroll += lines
+	if max := len(cb.lines) - CHAT_VISIBLE_LINES; cb.scroll > max {
+		cb.scroll = max
+	}
+	if cb.scroll < 0 {
+		cb.scroll = 0
+	}
+}
+
+// Deal with a window event while the player is typing.  Returns the message to send when they
+// press enter, nil the rest of the time.
+func (cb *ChatBox) HandleEvent(event sf.Event) *protocol.SendChatMessage {
+	switch ev := event.(type) {
+	case sf.EventTextEntered:
+		if !unicode.IsControl(ev.Char) && len(cb.input) < CHAT_MAX_INPUT {
+			cb.input = append(cb.input, ev.Char)
+		}
+
+	case sf.EventKeyPressed:
+		switch ev.Code {
+		case sf.KeyReturn:
+			cb.typing = false
+			return parseChatInput(string(cb.input))
+
+		case sf.KeyBack:
+			if len(cb.input) > 0 {
+				cb.input = cb.input[:len(cb.input)-1]
+			}
+
+		case sf.KeyPageUp:
+			cb.Scroll(CHAT_VISIBLE_LINES / 2)
+
+		case sf.KeyPageDown:
+			cb.Scroll(-CHAT_VISIBLE_LINES / 2)
+		}
+
+	// Escape closes the window on release, so giving up has to happen on release too or the
+	// window would close right after
+	case sf.EventKeyReleased:
+		if ev.Code == sf.KeyEscape {
+			cb.typing = false
+		}
+	}
+
+	return nil
+}
+
+// Draw the log in the bottom left corner of the window, with the line being typed under it.  The
+// window's default view has to be in place, so the chat box doesn't move with the camera.
+func (cb *ChatBox) Draw(window *sf.RenderWindow) {
+	if cb.text == nil {
+		return
+	}
+
+	y := float32(window.GetSize().Y) - CHAT_MARGIN - CHAT_LINE_HEIGHT
+	if cb.typing {
+		cb.drawLine(window, "> "+string(cb.input)+"_", chatColors[protocol.CHAT_SCOPE_GLOBAL], y)
+	}
+	y -= CHAT_LINE_HEIGHT
+
+	end := len(cb.lines) - cb.scroll
+	for i := end - 1; i >= 0 && i >= end-CHAT_VISIBLE_LINES; i-- {
+		cb.drawLine(window, cb.lines[i].text, cb.lines[i].color, y)
+		y -= CHAT_LINE_HEIGHT
+	}
+}
+
+// Draw one line of text with its left edge on the margin
+func (cb *ChatBox) drawLine(window *sf.RenderWindow, line string, color sf.Color, y float32) {
+	cb.text.SetString(line)
+	cb.text.SetColor(color)
+	cb.text.SetPosition(sf.Vector2f{CHAT_MARGIN, y})
+	cb.text.Draw(window, sf.DefaultRenderStates())
+}
+
+// Turn what the player typed into a message for the server, working out who it's for from the
+// prefix.  Returns nil if there's nothing to send.
+func parseChatInput(input string) *protocol.SendChatMessage {
+	input = strings.TrimSpace(input)
+
+	scope, target := protocol.CHAT_SCOPE_GLOBAL, ""
+	switch {
+	case strings.HasPrefix(input, "/t "):
+		scope, input = protocol.CHAT_SCOPE_TEAM, input[len("/t "):]
+
+	case strings.HasPrefix(input, "/w "):
+		fields := strings.SplitN(strings.TrimSpace(input[len("/w "):]), " ", 2)
+		if len(fields) < 2 {
+			return nil
+		}
+		scope, target, input = protocol.CHAT_SCOPE_WHISPER, fields[0], fields[1]
+	}
+
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil
+	}
+
+	return protocol.CreateSendChatMessage(scope, target, input)
+}
+
+// Create the chat box.  If the font can't be loaded the chat box still works, but chat only shows
+// up in the log.
+func CreateChatBox(fontPath string) *ChatBox {
+	cb := new(ChatBox)
+
+	font, err := sf.NewFontFromFile(fontPath)
+	if err != nil {
+		gameLog.Warn("Couldn't load the chat font, chat will only be logged", "font", fontPath, logging.ERROR, err)
+		return cb
+	}
+
+	text, err := sf.NewText(font)
+	if err != nil {
+		gameLog.Warn("Couldn't set up the chat text, chat will only be logged", logging.ERROR, err)
+		return cb
+	}
+	text.SetCharacterSize(CHAT_FONT_SIZE)
+	cb.font = font
+	cb.text = text
+
+	return cb
+}
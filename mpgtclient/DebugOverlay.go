@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+
+	sf "bitbucket.org/krepa098/gosfml2"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+const (
+	// Size of the dots a bot's path is drawn with, and how far apart they are along it, in pixels.
+	// Waypoints get bigger dots so the corners stand out.
+	DEBUG_PATH_DOT_SIZE      float32 = 4
+	DEBUG_PATH_WAYPOINT_SIZE float32 = 8
+	DEBUG_PATH_DOT_SPACING   float32 = 12
+)
+
+// Colours of the obstacles and the bot paths
+var (
+	debugObstacleColor = sf.Color{110, 110, 110, 160}
+	debugPathColor     = sf.Color{90, 220, 120, 220}
+)
+
+// Draws the map's obstacles and the paths the bots are following, on top of the world, while F6
+// is toggled on.  There's only anything to draw if the server was started with -debug-paths,
+// otherwise it never sends any paths.
+type DebugOverlay struct {
+	// Nil if the shapes couldn't be set up, in which case the overlay is never drawn
+	obstacle *sf.RectangleShape
+	dot      *sf.RectangleShape
+
+	paths     []protocol.BotPath
+	obstacles []shared.FloatRect
+	showing   bool
+}
+
+// Take in the latest paths from the server
+func (do *DebugOverlay) Set(msg *protocol.BotPathsMessage) {
+	do.paths = msg.Paths
+	do.obstacles = msg.Obstacles
+}
+
+// Forget the paths and obstacles, when we leave the room they were for
+func (do *DebugOverlay) Clear() {
+	do.paths = nil
+	do.obstacles = nil
+}
+
+// Turn the overlay on or off
+func (do *DebugOverlay) Toggle() {
+	do.showing = !do.showing
+	gameLog.Info("Debug overlay", "showing", do.showing)
+}
+
+// Draw the obstacles, then each bot's path from where the bot is now through the rest of its
+// waypoints.  Unlike the chat box, this goes in the world, so the camera's view has to be in
+// place.
+func (do *DebugOverlay) Draw(window *sf.RenderWindow, units map[int64]*Unit) {
+	if !do.showing || do.dot == nil {
+		return
+	}
+
+	for _, obstacle := range do.obstacles {
+		do.obstacle.SetSize(sf.Vector2f{obstacle.Width, obstacle.Height})
+		do.obstacle.SetPosition(sf.Vector2f{obstacle.X, obstacle.Y})
+		do.obstacle.Draw(window, sf.DefaultRenderStates())
+	}
+
+	// Points are entity positions, which are the top left corner of the entity's square, so
+	// they're moved to the middle of it to line up with the entity on screen
+	half := shared.ENTITY_SIZE / 2
+	for _, path := range do.paths {
+		if len(path.Points) == 0 {
+			continue
+		}
+
+		from := sf.Vector2f{path.Points[0].X + half, path.Points[0].Y + half}
+		if unit, ok := units[path.Id]; ok {
+			pos := unit.GetPosition()
+			from = sf.Vector2f{pos.X + half, pos.Y + half}
+		}
+
+		for _, point := range path.Points {
+			to := sf.Vector2f{point.X + half, point.Y + half}
+			do.drawSegment(window, from, to)
+			do.drawDot(window, to, DEBUG_PATH_WAYPOINT_SIZE)
+			from = to
+		}
+	}
+}
+
+// Draw a dotted line between two points, not including the end
+func (do *DebugOverlay) drawSegment(window *sf.RenderWindow, from, to sf.Vector2f) {
+	dx, dy := to.X-from.X, to.Y-from.Y
+	steps := int(float32(math.Hypot(float64(dx), float64(dy))) / DEBUG_PATH_DOT_SPACING)
+	for i := 0; i < steps; i++ {
+		t := float32(i) / float32(steps)
+		do.drawDot(window, sf.Vector2f{from.X + dx*t, from.Y + dy*t}, DEBUG_PATH_DOT_SIZE)
+	}
+}
+
+// Draw one dot of a path, centred on the point
+func (do *DebugOverlay) drawDot(window *sf.RenderWindow, at sf.Vector2f, size float32) {
+	do.dot.SetSize(sf.Vector2f{size, size})
+	do.dot.SetPosition(sf.Vector2f{at.X - size/2, at.Y - size/2})
+	do.dot.Draw(window, sf.DefaultRenderStates())
+}
+
+// Create the overlay, switched off.  If its shapes can't be set up it's never drawn.
+func CreateDebugOverlay() *DebugOverlay {
+	do := new(DebugOverlay)
+
+	obstacle, err := sf.NewRectangleShape()
+	if err != nil {
+		gameLog.Warn("Couldn't set up the debug overlay, it won't be shown", logging.ERROR, err)
+		return do
+	}
+	obstacle.SetFillColor(debugObstacleColor)
+
+	dot, err := sf.NewRectangleShape()
+	if err != nil {
+		gameLog.Warn("Couldn't set up the debug overlay, it won't be shown", logging.ERROR, err)
+		return do
+	}
+	dot.SetFillColor(debugPathColor)
+
+	do.obstacle = obstacle
+	do.dot = dot
+	return do
+}
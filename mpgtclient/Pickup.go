@@ -0,0 +1,72 @@
+package main
+
+import (
+	sf "bitbucket.org/krepa098/gosfml2"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/texturemanager"
+)
+
+// The texture for each kind of pickup.  A kind the server has and we don't isn't drawn at all.
+var pickupTextures = map[protocol.PickupKind]string{
+	protocol.PICKUP_SPEED:  "speedpickup.png",
+	protocol.PICKUP_HEALTH: "healthpickup.png",
+	protocol.PICKUP_SCORE:  "scorepickup.png",
+}
+
+// Something lying in the world to be picked up.  The server decides when it's been picked up, all
+// the client does is draw it until it's gone from the world state.
+type Pickup struct {
+	kind   protocol.PickupKind
+	sprite *sf.Sprite
+}
+
+// Draw the pickup to the render target (the window)
+func (p *Pickup) Draw(target sf.RenderTarget, states sf.RenderStates) {
+	p.sprite.Draw(target, states)
+}
+
+// Make the pickups we're drawing match the ones in a world state: new ones are added and the ones
+// which have been taken are dropped.  Pickups never move, so the ones we already have are left as
+// they are.
+func syncPickups(msgPickups []protocol.MessagePickup) {
+	seen := make(map[int64]bool, len(msgPickups))
+	for _, msgPickup := range msgPickups {
+		seen[msgPickup.Id] = true
+		if _, ok := pickups[msgPickup.Id]; ok {
+			continue
+		}
+
+		if pickup := NewPickup(msgPickup.Kind, ConvertToSFMLVector(msgPickup.Position)); pickup != nil {
+			pickups[msgPickup.Id] = pickup
+		}
+	}
+
+	for id := range pickups {
+		if !seen[id] {
+			delete(pickups, id)
+		}
+	}
+}
+
+// Set up a pickup of the given kind with its texture.  Returns nil if we don't know the kind or its
+// texture can't be loaded.
+func NewPickup(kind protocol.PickupKind, pos sf.Vector2f) *Pickup {
+	path, ok := pickupTextures[kind]
+	if !ok {
+		return nil
+	}
+
+	tex, err := texturemanager.LoadTexture("pickup-"+string(kind), path)
+	if err != nil {
+		return nil
+	}
+
+	spr, err := sf.NewSprite(tex)
+	if err != nil {
+		return nil
+	}
+	spr.SetPosition(pos)
+
+	return &Pickup{kind: kind, sprite: spr}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	sf "bitbucket.org/krepa098/gosfml2"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+)
+
+const (
+	// Size of the round banner's text, and where it sits, measured from the top left of the window
+	BANNER_FONT_SIZE uint    = 18
+	BANNER_MARGIN    float32 = 10
+)
+
+// Colour of the round banner's text
+var bannerColor = sf.Color{240, 220, 90, 255}
+
+// The line across the top of the window saying where the room is in its round: the mode, the
+// state, how long it has left and whatever the mode wants us to know, like who is "it".  The
+// countdown runs locally between the server's updates.
+type RoundBanner struct {
+	// Nil if the font couldn't be loaded, in which case round changes only go to the log
+	text *sf.Text
+
+	// The last state the server sent, and when it's up by our clock.  ends is zero if the state
+	// has no time limit.
+	state *protocol.RoundStateMessage
+	ends  time.Time
+}
+
+// Take in a new round state from the server, logging it if something other than the countdown
+// has changed
+func (rb *RoundBanner) Set(msg *protocol.RoundStateMessage) {
+	old := rb.state
+	if old == nil || old.State != msg.State || old.Round != msg.Round || old.Status != msg.Status {
+		gameLog.Info("Round", "mode", msg.Mode, "round", msg.Round, "state", msg.State.String(), "winner", msg.Winner, "status", msg.Status)
+	}
+
+	rb.state = msg
+	rb.ends = time.Time{}
+	if msg.Remaining.Duration > 0 {
+		rb.ends = time.Now().Add(msg.Remaining.Duration)
+	}
+}
+
+// Forget the round, when we leave the room it was in
+func (rb *RoundBanner) Clear() {
+	rb.state = nil
+}
+
+// Put the banner into words
+func (rb *RoundBanner) Line() string {
+	msg := rb.state
+	line := msg.Mode + " - "
+
+	switch msg.State {
+	case protocol.ROUND_STATE_WARMUP:
+		line += "warmup"
+		if rb.ends.IsZero() {
+			line += ", waiting for players"
+		}
+	case protocol.ROUND_STATE_IN_PROGRESS:
+		line += fmt.Sprintf("round %v", msg.Round)
+	case protocol.ROUND_STATE_POST_ROUND:
+		line += fmt.Sprintf("round %v over", msg.Round)
+		if msg.Winner != "" {
+			line += ", " + msg.Winner + " wins"
+		} else {
+			line += ", nobody wins"
+		}
+	case protocol.ROUND_STATE_MAP_CHANGE:
+		line += "changing map"
+	}
+
+	if !rb.ends.IsZero() {
+		left := time.Until(rb.ends)
+		if left < 0 {
+			left = 0
+		}
+		secs := int(left.Round(time.Second).Seconds())
+		line += fmt.Sprintf(" (%d:%02d)", secs/60, secs%60)
+	}
+	if msg.Status != "" {
+		line += " - " + msg.Status
+	}
+
+	return line
+}
+
+// Draw the banner in the top left corner of the window.  Like the chat box, the window's default
+// view has to be in place.
+func (rb *RoundBanner) Draw(window *sf.RenderWindow) {
+	if rb.text == nil || rb.state == nil {
+		return
+	}
+
+	rb.text.SetString(rb.Line())
+	rb.text.Draw(window, sf.DefaultRenderStates())
+}
+
+// Create the round banner, drawn with the given font.  If the font can't be loaded the banner
+// still works, but round changes only show up in the log.
+func CreateRoundBanner(fontPath string) *RoundBanner {
+	rb := new(RoundBanner)
+
+	font, err := sf.NewFontFromFile(fontPath)
+	if err != nil {
+		gameLog.Warn("Couldn't load the banner font, round changes will only be logged", "font", fontPath, logging.ERROR, err)
+		return rb
+	}
+
+	text, err := sf.NewText(font)
+	if err != nil {
+		gameLog.Warn("Couldn't set up the banner text, round changes will only be logged", logging.ERROR, err)
+		return rb
+	}
+	text.SetCharacterSize(BANNER_FONT_SIZE)
+	text.SetColor(bannerColor)
+	text.SetPosition(sf.Vector2f{BANNER_MARGIN, BANNER_MARGIN})
+	rb.text = text
+
+	return rb
+}
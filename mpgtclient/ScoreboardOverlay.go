@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	sf "bitbucket.org/krepa098/gosfml2"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+)
+
+const (
+	// Size of the scoreboard's text and the space between its lines, in pixels
+	SCOREBOARD_FONT_SIZE   uint    = 16
+	SCOREBOARD_LINE_HEIGHT float32 = 22
+
+	// Space between the edge of the scoreboard's background and its text, and between the top of
+	// the window and the scoreboard
+	SCOREBOARD_PADDING float32 = 12
+	SCOREBOARD_TOP     float32 = 60
+)
+
+// Where each column of the scoreboard starts, measured from its left edge, and what's at the top
+// of it.  The last entry is where the scoreboard ends.
+var (
+	scoreboardColumns  = []float32{0, 180, 250, 310, 350, 390, 480, 550, 610}
+	scoreboardHeadings = []string{"Player", "Team", "Score", "K", "D", "Distance", "Time", "Ping"}
+)
+
+// Colours of the scoreboard's background, its text and our own line
+var (
+	scoreboardBackground = sf.Color{0, 0, 0, 180}
+	scoreboardTextColor  = sf.Color{255, 255, 255, 255}
+	scoreboardMineColor  = sf.Color{240, 220, 90, 255}
+)
+
+// Everyone's stats in the room we're in, shown in the middle of the window while Tab is held.  The
+// server sends a new scoreboard every couple of seconds.
+type ScoreboardOverlay struct {
+	// Nil if the font couldn't be loaded, in which case the scoreboard can't be shown
+	text       *sf.Text
+	background *sf.RectangleShape
+
+	entries []protocol.ScoreEntry
+	showing bool
+}
+
+// Take in a new scoreboard from the server
+func (so *ScoreboardOverlay) Set(msg *protocol.ScoreboardMessage) {
+	so.entries = msg.Entries
+}
+
+// Forget the scoreboard, when we leave the room it was for
+func (so *ScoreboardOverlay) Clear() {
+	so.entries = nil
+}
+
+// Show or hide the scoreboard
+func (so *ScoreboardOverlay) Show(showing bool) {
+	so.showing = showing
+}
+
+// Draw the scoreboard, if it's being shown, centred across the window.  Like the chat box, the
+// window's default view has to be in place.
+func (so *ScoreboardOverlay) Draw(window *sf.RenderWindow, myId int64) {
+	if !so.showing || so.text == nil {
+		return
+	}
+
+	width := scoreboardColumns[len(scoreboardColumns)-1] + 2*SCOREBOARD_PADDING
+	height := float32(len(so.entries)+1)*SCOREBOARD_LINE_HEIGHT + 2*SCOREBOARD_PADDING
+	left := (float32(window.GetSize().X) - width) / 2
+
+	so.background.SetSize(sf.Vector2f{width, height})
+	so.background.SetPosition(sf.Vector2f{left, SCOREBOARD_TOP})
+	so.background.Draw(window, sf.DefaultRenderStates())
+
+	x, y := left+SCOREBOARD_PADDING, SCOREBOARD_TOP+SCOREBOARD_PADDING
+	so.drawRow(window, scoreboardHeadings, scoreboardTextColor, x, y)
+
+	for _, entry := range so.entries {
+		y += SCOREBOARD_LINE_HEIGHT
+		color := scoreboardTextColor
+		if entry.Id == myId {
+			color = scoreboardMineColor
+		}
+
+		connected := int(entry.Connected.Seconds())
+		so.drawRow(window, []string{
+			entry.Username,
+			entry.Team,
+			fmt.Sprint(entry.Score),
+			fmt.Sprint(entry.Kills),
+			fmt.Sprint(entry.Deaths),
+			fmt.Sprintf("%.0f", entry.Distance),
+			fmt.Sprintf("%d:%02d", connected/60, connected%60),
+			fmt.Sprint(entry.RTT.Round(time.Millisecond).Milliseconds()),
+		}, color, x, y)
+	}
+}
+
+// Draw one line of the scoreboard, one cell per column
+func (so *ScoreboardOverlay) drawRow(window *sf.RenderWindow, cells []string, color sf.Color, x, y float32) {
+	so.text.SetColor(color)
+	for i, cell := range cells {
+		so.text.SetString(cell)
+		so.text.SetPosition(sf.Vector2f{x + scoreboardColumns[i], y})
+		so.text.Draw(window, sf.DefaultRenderStates())
+	}
+}
+
+// Create the scoreboard, drawn with the given font.  If the font can't be loaded the scoreboard is
+// never shown.
+func CreateScoreboardOverlay(fontPath string) *ScoreboardOverlay {
+	so := new(ScoreboardOverlay)
+
+	font, err := sf.NewFontFromFile(fontPath)
+	if err != nil {
+		gameLog.Warn("Couldn't load the scoreboard font, it won't be shown", "font", fontPath, logging.ERROR, err)
+		return so
+	}
+
+	text, err := sf.NewText(font)
+	if err != nil {
+		gameLog.Warn("Couldn't set up the scoreboard text, it won't be shown", logging.ERROR, err)
+		return so
+	}
+	text.SetCharacterSize(SCOREBOARD_FONT_SIZE)
+
+	background, err := sf.NewRectangleShape()
+	if err != nil {
+		gameLog.Warn("Couldn't set up the scoreboard background, it won't be shown", logging.ERROR, err)
+		return so
+	}
+	background.SetFillColor(scoreboardBackground)
+
+	so.text = text
+	so.background = background
+	return so
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+
+	sf "bitbucket.org/krepa098/gosfml2"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// How much faster than a player the free camera pans
+const CAMERA_PAN_MULTIPLIER float32 = 2
+
+// What a spectator looks through.  It either follows one player around or is moved freely with the
+// arrow keys.  Tab switches to following the next player, space goes back to the free camera.
+type SpectatorCamera struct {
+	view *sf.View
+
+	// Who's being followed, if anyone
+	following bool
+	followId  int64
+
+	// Username to start following as soon as that player shows up, from the -follow flag
+	followName string
+
+	// How fast the free camera is panning, so it speeds up and slows down like a player does
+	velocity shared.FloatVector
+}
+
+// Move the camera for this frame - onto the followed player, or by the arrow keys if it's free
+func (c *SpectatorCamera) Update(input *shared.InputState, dt shared.MDuration, units map[int64]*Unit) {
+	if !c.following && c.followName != "" {
+		for id, unit := range units {
+			if unit.name == c.followName {
+				c.Follow(id)
+				break
+			}
+		}
+	}
+
+	if c.following {
+		unit, ok := units[c.followId]
+		if ok {
+			c.view.SetCenter(unit.GetPosition())
+			return
+		}
+
+		// They left, stay where they were last seen
+		c.FreeLook()
+	}
+
+	pan := shared.GetMovement(input, dt, shared.DefaultMovementParams(), &c.velocity)
+	c.view.Move(sf.Vector2f{X: pan.X * CAMERA_PAN_MULTIPLIER, Y: pan.Y * CAMERA_PAN_MULTIPLIER})
+}
+
+// Follow a player
+func (c *SpectatorCamera) Follow(id int64) {
+	c.following = true
+	c.followId = id
+	c.followName = ""
+	c.velocity = shared.FloatVector{}
+}
+
+// Switch to following the next player along, in order of their IDs, wrapping around at the end
+func (c *SpectatorCamera) FollowNext(units map[int64]*Unit) {
+	if len(units) == 0 {
+		return
+	}
+
+	ids := make([]int64, 0, len(units))
+	for id := range units {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	next := ids[0]
+	if c.following {
+		for _, id := range ids {
+			if id > c.followId {
+				next = id
+				break
+			}
+		}
+	}
+
+	c.Follow(next)
+}
+
+// Stop following and go back to the free camera, starting from wherever the camera is now
+func (c *SpectatorCamera) FreeLook() {
+	c.following = false
+	c.followName = ""
+}
+
+// Make the window draw through this camera
+func (c *SpectatorCamera) Apply(renderWindow *sf.RenderWindow) {
+	renderWindow.SetView(c.view)
+}
+
+// Create a camera the size of the window, looking at the same part of the world the window
+// would show by default.  If followName isn't empty, the camera follows that player once they
+// show up.
+func CreateSpectatorCamera(width, height float32, followName string) *SpectatorCamera {
+	view := sf.NewView()
+	view.SetSize(sf.Vector2f{X: width, Y: height})
+	view.SetCenter(sf.Vector2f{X: width / 2, Y: height / 2})
+
+	return &SpectatorCamera{view: view, followName: followName}
+}
@@ -3,18 +3,89 @@ package main
 import (
 	sf "bitbucket.org/krepa098/gosfml2"
 
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
 	"github.com/gabriel-comeau/multiplayer-game-test/texturemanager"
 )
 
-// Represents a drawable unit.
+const (
+	// Height of the health bar over a hurt unit, and the gap between it and the unit, in pixels
+	HEALTH_BAR_HEIGHT float32 = 5
+	HEALTH_BAR_GAP    float32 = 4
+)
+
+// Colours of the empty and full parts of a health bar
+var (
+	healthBarBackground = sf.Color{60, 0, 0, 200}
+	healthBarFill       = sf.Color{70, 210, 70, 230}
+)
+
+// Colours other players are tinted with for the teams we know about.  Teams not listed here get
+// TEAM_COLOR_UNKNOWN.
+var teamColors = map[string]sf.Color{
+	"red":  sf.Color{220, 60, 60, 255},
+	"blue": sf.Color{60, 110, 230, 255},
+}
+
+// Tint for a player on a team without a colour of its own
+var TEAM_COLOR_UNKNOWN = sf.Color{200, 200, 200, 255}
+
+// Represents a drawable unit.  The name is the username of the player controlling it and the team
+// is the team they're on, empty if they aren't on one.
 type Unit struct {
 	tex    *sf.Texture
 	sprite *sf.Sprite
+	name   string
+	team   string
+
+	// Whether this is our own player, which always keeps its own texture
+	mine bool
+
+	// Health out of shared.MAX_HEALTH, zero when the server didn't say (a replay doesn't), and the
+	// bar showing it.  The bar is nil if it couldn't be set up.
+	health     int
+	healthBack *sf.RectangleShape
+	healthBar  *sf.RectangleShape
 }
 
-// Draw the unit to the render target (the window)
+// Draw the unit to the render target (the window), with a health bar above it if it's hurt
 func (this *Unit) Draw(target sf.RenderTarget, states sf.RenderStates) {
 	this.sprite.Draw(target, states)
+
+	if this.healthBar == nil || this.health <= 0 || this.health >= shared.MAX_HEALTH {
+		return
+	}
+
+	pos := this.sprite.GetPosition()
+	barPos := sf.Vector2f{pos.X, pos.Y - HEALTH_BAR_GAP - HEALTH_BAR_HEIGHT}
+	this.healthBack.SetPosition(barPos)
+	this.healthBack.Draw(target, states)
+	this.healthBar.SetSize(sf.Vector2f{shared.ENTITY_SIZE * float32(this.health) / float32(shared.MAX_HEALTH), HEALTH_BAR_HEIGHT})
+	this.healthBar.SetPosition(barPos)
+	this.healthBar.Draw(target, states)
+}
+
+// Set how much health the unit has
+func (this *Unit) SetHealth(health int) {
+	this.health = health
+}
+
+// Set up the unit's health bar.  If it can't be, the unit is drawn without one.
+func (this *Unit) setUpHealthBar() {
+	back, err := sf.NewRectangleShape()
+	if err != nil {
+		return
+	}
+	back.SetSize(sf.Vector2f{shared.ENTITY_SIZE, HEALTH_BAR_HEIGHT})
+	back.SetFillColor(healthBarBackground)
+
+	bar, err := sf.NewRectangleShape()
+	if err != nil {
+		return
+	}
+	bar.SetFillColor(healthBarFill)
+
+	this.healthBack = back
+	this.healthBar = bar
 }
 
 // Move unit from its current position to a new one via a vector offset
@@ -32,6 +103,42 @@ func (this *Unit) GetPosition() sf.Vector2f {
 	return this.sprite.GetPosition()
 }
 
+// Put the unit on a team.  Other players on a team are drawn as a white square tinted with the
+// team's colour, and players on no team go back to the Other texture.
+func (this *Unit) SetTeam(team string) {
+	if team == this.team {
+		return
+	}
+	this.team = team
+
+	if this.mine {
+		return
+	}
+
+	if team == "" {
+		tex, err := texturemanager.LoadTexture("sprites-other", "bluesquare.png")
+		if err != nil {
+			return
+		}
+		this.tex = tex
+		this.sprite.SetTexture(tex, false)
+		this.sprite.SetColor(sf.Color{255, 255, 255, 255})
+		return
+	}
+
+	tex, err := texturemanager.LoadTexture("sprites-team", "whitesquare.png")
+	if err != nil {
+		return
+	}
+	color, ok := teamColors[team]
+	if !ok {
+		color = TEAM_COLOR_UNKNOWN
+	}
+	this.tex = tex
+	this.sprite.SetTexture(tex, false)
+	this.sprite.SetColor(color)
+}
+
 // This constructor will set up the unit with the Player texture
 func NewPlayer(initialPos sf.Vector2f) *Unit {
 	player := new(Unit)
@@ -48,7 +155,9 @@ func NewPlayer(initialPos sf.Vector2f) *Unit {
 	}
 
 	player.sprite = spr
+	player.mine = true
 	player.sprite.SetPosition(initialPos)
+	player.setUpHealthBar()
 
 	return player
 }
@@ -70,6 +179,7 @@ func NewOther(initialPos sf.Vector2f) *Unit {
 
 	other.sprite = spr
 	other.sprite.SetPosition(initialPos)
+	other.setUpHealthBar()
 
 	return other
 }
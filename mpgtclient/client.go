@@ -2,38 +2,113 @@ package main
 
 import (
 	"bufio"
-	"log"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"math"
 	"net"
-	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	sf "bitbucket.org/krepa098/gosfml2"
 
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
 	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
 	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+	"github.com/gabriel-comeau/multiplayer-game-test/transport"
+)
+
+const (
+	// How long to wait before the first attempt at reconnecting to the server.  Every failed attempt
+	// doubles the wait, up to RECONNECT_MAX_BACKOFF.
+	RECONNECT_MIN_BACKOFF time.Duration = 250 * time.Millisecond
+
+	// Longest we'll ever wait between two connection attempts
+	RECONNECT_MAX_BACKOFF time.Duration = 10 * time.Second
+
+	// Font the chat and round banner are drawn with, unless -chat-font says otherwise
+	DEFAULT_CHAT_FONT = "/usr/share/fonts/truetype/dejavu/DejaVuSans.ttf"
 )
 
 var (
 	// This block of variables is shared global state throughout the client.  Obviously not great
 	// but since our client program is pretty simple, this is quick and effective.
 
-	// Our current movement velocity
-	velocity sf.Vector2f
+	// Our current velocity, as the server last told us plus our own inputs since.  It carries
+	// over from one frame to the next, and while we're still moving we keep sending inputs even
+	// with no keys down, so the server slows us down at the same time we do.
+	velocity shared.FloatVector
 
-	// Current state of input - which buttons are being pressed
+	// Current state of input - which actions are being done, and where we're aiming
 	inputState *shared.InputState
 
-	// Socket connection to the server
+	// Which keys and mouse buttons do which actions, from -bindings
+	bindings *Bindings
+
+	// Socket connection to the server.  It gets swapped out by the connection goroutine whenever
+	// we reconnect and is nil while we're disconnected, so always go through getConn / setConn.
 	conn net.Conn
 
+	// Guards conn
+	connLock *sync.Mutex
+
+	// Username and credential to join with.  What the credential is depends on how the server
+	// authenticates players - a password, a shared secret or a signed token.
+	username   string
+	credential string
+
+	// Watching instead of playing.  Spectators have no player of their own and look at the world
+	// through the camera instead.
+	spectating bool
+	camera     *SpectatorCamera
+
+	// TLS settings for talking to the server, nil for plain TCP
+	tlsConfig *tls.Config
+
+	// Token handed out by the server which lets us reclaim our player after a reconnect.  Only the
+	// connection goroutine touches this once the game loop is running.
+	sessionToken string
+
 	// Unique identifying ID sent over by the server on connection
 	myPlayerId int64
 
+	// The room we're in, empty if none, and the rooms the server told us about the last time we
+	// asked.  F1 asks for the list, F2 moves to the next room on it and F3 leaves the room.
+	currentRoom string
+	roomList    []protocol.RoomInfo
+
+	// How we move, as the server last told us.  It can change at any time, and our prediction has
+	// to move us exactly the way the server does.
+	myMovement = shared.DefaultMovementParams()
+
+	// Whether we're waiting in the lobby for a match.  F4 joins or leaves the queue.
+	queued bool
+
+	// The teams in the room we're in, empty if it doesn't have any, and the one we're on.  F5
+	// switches to the next team, if the server thinks that's fair.
+	roomTeams []string
+	myTeam    string
+
+	// The chat log and the line being typed.  Enter starts typing.
+	chatBox *ChatBox
+
+	// Where the room we're in is in its round, across the top of the window
+	roundBanner *RoundBanner
+
+	// Everyone's stats in the room we're in, shown while Tab is held
+	scoreboard *ScoreboardOverlay
+
+	// Bot paths and obstacles, drawn over the world when F6 turns it on
+	debugOverlay *DebugOverlay
+
 	// Keep track of the entities we need to draw.  The key is their UUID.  Our player entity
 	// is just another in this list.
 	entities map[int64]*Unit
 
+	// The pickups lying around the room we're in, by ID
+	pickups map[int64]*Pickup
+
 	// Hold messages from the server in a queue
 	messageQueue *protocol.MessageQueue
 
@@ -46,19 +121,56 @@ var (
 
 	// Current sequence number for input messages we'll be sending
 	currentSeq int64
+
+	// Loggers for the networking side and the game loop.  See the logging package.
+	netLog  = logging.For("net")
+	gameLog = logging.For("game")
 )
 
 func init() {
 	runtime.LockOSThread()
 	inputState = new(shared.InputState)
 	entities = make(map[int64]*Unit)
+	pickups = make(map[int64]*Pickup)
 	messageQueue = protocol.CreateMessageQueue()
 	outgoing = make(chan protocol.Message)
 	currentSeq = 0
 	unacked = make([]*protocol.SendInputMessage, 0)
+	connLock = new(sync.Mutex)
 }
 
 func main() {
+	flag.StringVar(&username, "user", "", "username to join the server as")
+	flag.StringVar(&credential, "credential", "", "password, shared secret or token to authenticate with")
+	useTLS := flag.Bool("tls", false, "connect to the server over TLS")
+	tlsPin := flag.String("tls-pin", "", "only trust a server certificate with this SHA-256 fingerprint (hex)")
+	tlsInsecure := flag.Bool("tls-insecure", false, "don't verify the server certificate at all")
+	flag.BoolVar(&spectating, "spectate", false, "watch the game instead of playing (tab follows the next player, space frees the camera)")
+	follow := flag.String("follow", "", "when spectating, follow the player with this username")
+	room := flag.String("room", "", "room to go to once connected, instead of the server's default room")
+	createRoom := flag.Bool("create-room", false, "create the -room instead of joining it")
+	roomMaxPlayers := flag.Int("room-max-players", 0, "with -create-room, how many players the room takes (0 for no limit)")
+	chatFont := flag.String("chat-font", DEFAULT_CHAT_FONT, "TrueType font to draw the chat and round banner with")
+	bindingsPath := flag.String("bindings", "", "file of \"key action\" lines saying which keys and mouse buttons do what, empty for arrows/WASD to move, left shift to sprint, E to interact and the left mouse button to fire")
+	logFlags := logging.RegisterFlags()
+	flag.Parse()
+
+	if err := logFlags.Apply(); err != nil {
+		logging.Fatal(gameLog, "Bad logging configuration", logging.ERROR, err)
+	}
+
+	var err error
+	bindings, err = LoadBindings(*bindingsPath)
+	if err != nil {
+		logging.Fatal(gameLog, "Couldn't load key bindings", logging.ERROR, err)
+	}
+
+	if *useTLS {
+		tlsConfig, err = transport.ClientConfig(shared.HOST, *tlsPin, *tlsInsecure)
+		if err != nil {
+			logging.Fatal(netLog, "Bad TLS configuration", logging.ERROR, err)
+		}
+	}
 
 	// Open the game window.
 	renderWindow := sf.NewRenderWindow(sf.VideoMode{1024, 768, 32}, "Wow! Much client-side-interpretation", sf.StyleDefault, sf.DefaultContextSettings())
@@ -71,8 +183,24 @@ func main() {
 	// portion, but for simplicity's sake, this will do the job.
 	renderWindow.SetFramerateLimit(60)
 
+	if spectating {
+		camera = CreateSpectatorCamera(1024, 768, *follow)
+	}
+	chatBox = CreateChatBox(*chatFont)
+	roundBanner = CreateRoundBanner(*chatFont)
+	scoreboard = CreateScoreboardOverlay(*chatFont)
+	debugOverlay = CreateDebugOverlay()
+
 	// establish connection to server
-	conn = connectToServer()
+	connectToServer()
+
+	if *room != "" {
+		if *createRoom {
+			outgoing <- protocol.CreateCreateRoomMessage(*room, protocol.RoomSettings{MaxPlayers: *roomMaxPlayers})
+		} else {
+			outgoing <- protocol.CreateJoinRoomMessage(*room)
+		}
+	}
 
 	// Preset up the timestep stuff so there's a value for the first rendered frame
 	lastTick := time.Now()
@@ -83,18 +211,23 @@ func main() {
 
 		// process user input, changing the value of the inputstate struct
 		inputState = handleUserInput(renderWindow, inputState)
-		if inputState.HasInput() {
-			velocity = ConvertToSFMLVector(shared.GetVectorFromInputAndDt(inputState, shared.MDuration{dt}))
+		if spectating {
+			// Spectators' keys only move the camera, nothing gets sent
+			camera.Update(inputState, shared.MDuration{dt}, entities)
+		} else if inputState.HasInput() || velocity != (shared.FloatVector{}) {
+			offset := ConvertToSFMLVector(shared.GetMovement(inputState, shared.MDuration{dt}, myMovement, &velocity))
 
 			// client side prediction
 			player, ok := entities[myPlayerId]
 			if ok {
-				player.Move(velocity)
+				player.Move(offset)
 			}
 
 			// We need to send this input to the server, so build a message object
-			// stick it in the unacked map and then transmit
-			inputMsg := protocol.CreateSendInputMessage(inputState, currentSeq, dt, myPlayerId)
+			// stick it in the unacked map and then transmit.  It gets its own copy of the input,
+			// since the bindings keep changing ours and it has to be replayed exactly as it was.
+			sent := *inputState
+			inputMsg := protocol.CreateSendInputMessage(&sent, currentSeq, dt, myPlayerId)
 			unacked = append(unacked, inputMsg)
 			currentSeq++
 			outgoing <- inputMsg
@@ -105,10 +238,145 @@ func main() {
 		for _, message := range incoming {
 			switch message.GetMessageType() {
 
+			case protocol.PLAYER_UUID_MESSAGE:
+				typed, ok := message.(*protocol.PlayerUUIDMessage)
+				if !ok {
+					gameLog.Error("Got a message with PLAYER_UUID_MESSAGE id but couldn't be cast")
+					continue
+				}
+
+				// Spectators have nothing to lose on a reconnect, they just get a new ID
+				if spectating {
+					myPlayerId = typed.UUID
+					continue
+				}
+
+				// We've reconnected.  If the server gave us our old player back, everything carries
+				// on as before.  If not, our session expired and we're starting over as someone new.
+				if typed.UUID != myPlayerId {
+					gameLog.Warn("Session lost, rejoined as a new player", logging.PLAYER_ID, typed.UUID)
+					myPlayerId = typed.UUID
+					entities = make(map[int64]*Unit)
+					unacked = make([]*protocol.SendInputMessage, 0)
+				}
+
+			case protocol.ROOM_CHANGED_MESSAGE:
+				typed, ok := message.(*protocol.RoomChangedMessage)
+				if !ok {
+					gameLog.Error("Got a message with ROOM_CHANGED_MESSAGE id but couldn't be cast")
+					continue
+				}
+
+				if typed.Reason != "" {
+					gameLog.Warn("Couldn't change room", "reason", typed.Reason, "room", typed.Room)
+					continue
+				}
+
+				roomTeams = typed.Teams
+
+				// A different room is a different world, nothing we knew about carries over
+				if typed.Room != currentRoom {
+					gameLog.Info("Now in room", "room", typed.Room)
+					currentRoom = typed.Room
+					entities = make(map[int64]*Unit)
+					pickups = make(map[int64]*Pickup)
+					myTeam = ""
+
+					// Until the world state says otherwise, we'll move at the room's speed
+					myMovement = shared.DefaultMovementParams()
+					if typed.Settings.Speed > 0 {
+						myMovement.MaxSpeed = typed.Settings.Speed
+					}
+					velocity = shared.FloatVector{}
+					roundBanner.Clear()
+					scoreboard.Clear()
+					debugOverlay.Clear()
+					unacked = make([]*protocol.SendInputMessage, 0)
+				}
+
+			case protocol.ROOM_LIST_MESSAGE:
+				typed, ok := message.(*protocol.RoomListMessage)
+				if !ok {
+					gameLog.Error("Got a message with ROOM_LIST_MESSAGE id but couldn't be cast")
+					continue
+				}
+
+				roomList = typed.Rooms
+				for _, info := range roomList {
+					gameLog.Info("Room", "room", info.Name, "players", info.Players, "max_players", info.Settings.MaxPlayers)
+				}
+
+			case protocol.MATCH_FOUND_MESSAGE:
+				typed, ok := message.(*protocol.MatchFoundMessage)
+				if !ok {
+					gameLog.Error("Got a message with MATCH_FOUND_MESSAGE id but couldn't be cast")
+					continue
+				}
+				queued = false
+				gameLog.Info("Match found", "match_id", typed.MatchId, "players", typed.Players)
+
+			case protocol.MATCH_READY_MESSAGE:
+				typed, ok := message.(*protocol.MatchReadyMessage)
+				if !ok {
+					gameLog.Error("Got a message with MATCH_READY_MESSAGE id but couldn't be cast")
+					continue
+				}
+				gameLog.Info("Match starting", "match_id", typed.MatchId, "room", typed.Room)
+
+			case protocol.MATCH_ENDED_MESSAGE:
+				typed, ok := message.(*protocol.MatchEndedMessage)
+				if !ok {
+					gameLog.Error("Got a message with MATCH_ENDED_MESSAGE id but couldn't be cast")
+					continue
+				}
+				queued = false
+				gameLog.Info("Match over", "match_id", typed.MatchId, "reason", typed.Reason)
+
+			case protocol.QUEUE_REJECTED_MESSAGE:
+				typed, ok := message.(*protocol.QueueRejectedMessage)
+				if !ok {
+					gameLog.Error("Got a message with QUEUE_REJECTED_MESSAGE id but couldn't be cast")
+					continue
+				}
+				queued = false
+				gameLog.Warn("Couldn't queue for a match", "reason", typed.Reason)
+
+			case protocol.CHAT_MESSAGE:
+				typed, ok := message.(*protocol.ChatMessage)
+				if !ok {
+					gameLog.Error("Got a message with CHAT_MESSAGE id but couldn't be cast")
+					continue
+				}
+				chatBox.Add(typed, myPlayerId)
+
+			case protocol.ROUND_STATE_MESSAGE:
+				typed, ok := message.(*protocol.RoundStateMessage)
+				if !ok {
+					gameLog.Error("Got a message with ROUND_STATE_MESSAGE id but couldn't be cast")
+					continue
+				}
+				roundBanner.Set(typed)
+
+			case protocol.SCOREBOARD_MESSAGE:
+				typed, ok := message.(*protocol.ScoreboardMessage)
+				if !ok {
+					gameLog.Error("Got a message with SCOREBOARD_MESSAGE id but couldn't be cast")
+					continue
+				}
+				scoreboard.Set(typed)
+
+			case protocol.BOT_PATHS_MESSAGE:
+				typed, ok := message.(*protocol.BotPathsMessage)
+				if !ok {
+					gameLog.Error("Got a message with BOT_PATHS_MESSAGE id but couldn't be cast")
+					continue
+				}
+				debugOverlay.Set(typed)
+
 			case protocol.WORLD_STATE_MESSAGE:
 				typed, ok := message.(*protocol.WorldStateMessage)
 				if !ok {
-					log.Print("Got a message with WORLD_STATE_MESSAGE id but couldn't be cast")
+					gameLog.Error("Got a message with WORLD_STATE_MESSAGE id but couldn't be cast")
 					continue
 				}
 
@@ -124,15 +392,30 @@ func main() {
 						// not in the map, let's create it - we'll bail after this because even if
 						// this is our own entity we'll start to worry about interpolation on the next
 						// pass only
-						addEntityToGameWorld(msgEnt.Id, ConvertToSFMLVector(msgEnt.Position))
+						addEntityToGameWorld(msgEnt.Id, msgEnt.Username, msgEnt.Team, ConvertToSFMLVector(msgEnt.Position))
 						continue
 					}
+					existingEnt.SetTeam(msgEnt.Team)
+					existingEnt.SetHealth(msgEnt.Health)
 
 					// Is this ours or someone else's?
 					if msgEnt.Id == myPlayerId {
+						if msgEnt.Team != myTeam {
+							myTeam = msgEnt.Team
+							if myTeam != "" {
+								gameLog.Info("Now on a team", "team", myTeam)
+							}
+						}
+
+						// Pick up any change to the way we move before going over the inputs the
+						// server hasn't seen yet, it'll move us the new way for those too
+						if msgEnt.Movement.MaxSpeed > 0 {
+							myMovement = msgEnt.Movement
+						}
 
-						// First, set the position to wherever the server thinks it was
+						// First, set the position and velocity to whatever the server thinks they were
 						existingEnt.SetPosition(ConvertToSFMLVector(msgEnt.Position))
+						velocity = msgEnt.Velocity
 
 						// Next, let's go through our pending inputs list and get rid of everything older
 						// than this seq number
@@ -141,7 +424,7 @@ func main() {
 							if oldMsg.Seq > msgEnt.LastSeq {
 								// not processed yet, so reapply and keep it in the list
 								newUnacked = append(newUnacked, oldMsg)
-								existingEnt.Move(ConvertToSFMLVector(shared.GetVectorFromInputAndDt(oldMsg.Input, oldMsg.Dt)))
+								existingEnt.Move(ConvertToSFMLVector(shared.GetMovement(oldMsg.Input, oldMsg.Dt, myMovement, &velocity)))
 							}
 						}
 						unacked = newUnacked
@@ -156,6 +439,7 @@ func main() {
 				// that belong to players who've left.  This means we have to do another ugly iteration
 				// but that's life.
 				removeDisconnectedPlayers(typed.Entities)
+				syncPickups(typed.Pickups)
 			}
 		}
 
@@ -164,6 +448,14 @@ func main() {
 		lastTick = now
 
 		renderWindow.Clear(sf.Color{0, 0, 0, 0})
+		if spectating {
+			camera.Apply(renderWindow)
+		}
+
+		// Pickups go underneath everyone
+		for _, pickup := range pickups {
+			pickup.Draw(renderWindow, sf.DefaultRenderStates())
+		}
 
 		// Draw all the units but draw the player last so it's always on top
 		var playerUnit *Unit
@@ -178,6 +470,14 @@ func main() {
 		if playerUnit != nil {
 			playerUnit.Draw(renderWindow, sf.DefaultRenderStates())
 		}
+		debugOverlay.Draw(renderWindow, entities)
+
+		// The chat box and round banner stay in the corners of the window wherever the camera is
+		// looking
+		renderWindow.SetView(renderWindow.GetDefaultView())
+		chatBox.Draw(renderWindow)
+		roundBanner.Draw(renderWindow)
+		scoreboard.Draw(renderWindow, myPlayerId)
 
 		renderWindow.Display()
 	}
@@ -191,56 +491,84 @@ func handleUserInput(renderWindow *sf.RenderWindow, inputState *shared.InputStat
 
 	// Handle user input
 	for event := renderWindow.PollEvent(); event != nil; event = renderWindow.PollEvent() {
+		// While a line of chat is being typed, the keys are all for the chat box
+		if chatBox.IsTyping() {
+			if msg := chatBox.HandleEvent(event); msg != nil {
+				outgoing <- msg
+			}
+			continue
+		}
+
+		// Bound keys and buttons go to their actions before anything else gets a look at them
+		if bindings.HandleEvent(event, inputState) {
+			continue
+		}
+
 		switch ev := event.(type) {
+		case sf.EventMouseMoved:
+			inputState.Aim = aimToward(renderWindow, ev.X, ev.Y)
+
 		case sf.EventKeyReleased:
 			switch ev.Code {
 
 			case sf.KeyEscape:
 				renderWindow.Close()
 
-			case sf.KeyLeft:
-				if inputState.KeyLeftDown {
-					inputState.KeyLeftDown = false
-				}
-
-			case sf.KeyRight:
-				if inputState.KeyRightDown {
-					inputState.KeyRightDown = false
-				}
-
-			case sf.KeyDown:
-				if inputState.KeyDownDown {
-					inputState.KeyDownDown = false
-				}
-
-			case sf.KeyUp:
-				if inputState.KeyUpDown {
-					inputState.KeyUpDown = false
-				}
+			case sf.KeyTab:
+				scoreboard.Show(false)
 
 			}
 
 		case sf.EventKeyPressed:
 			switch ev.Code {
 
-			case sf.KeyLeft:
-				if !inputState.KeyLeftDown {
-					inputState.KeyLeftDown = true
+			// Start typing a line of chat.  Whatever was held down is let go, or the player would
+			// keep walking while they type.
+			case sf.KeyReturn:
+				bindings.Release()
+				*inputState = shared.InputState{}
+				chatBox.Open()
+
+			case sf.KeyF1:
+				outgoing <- protocol.CreateListRoomsMessage()
+
+			case sf.KeyF2:
+				if next := nextRoom(); next != "" {
+					outgoing <- protocol.CreateJoinRoomMessage(next)
+				}
+
+			case sf.KeyF3:
+				outgoing <- protocol.CreateLeaveRoomMessage()
+
+			case sf.KeyF4:
+				if queued {
+					outgoing <- protocol.CreateLeaveQueueMessage()
+					gameLog.Info("Left the match queue")
+				} else {
+					outgoing <- protocol.CreateQueueMatchMessage()
+					gameLog.Info("Waiting for a match")
 				}
+				queued = !queued
 
-			case sf.KeyRight:
-				if !inputState.KeyRightDown {
-					inputState.KeyRightDown = true
+			case sf.KeyF5:
+				if next := nextTeam(); next != "" {
+					outgoing <- protocol.CreateChooseTeamMessage(next)
 				}
 
-			case sf.KeyDown:
-				if !inputState.KeyDownDown {
-					inputState.KeyDownDown = true
+			case sf.KeyF6:
+				debugOverlay.Toggle()
+
+			// Tab shows the scoreboard for as long as it's held.  Spectators also move on to
+			// following the next player.
+			case sf.KeyTab:
+				scoreboard.Show(true)
+				if spectating {
+					camera.FollowNext(entities)
 				}
 
-			case sf.KeyUp:
-				if !inputState.KeyUpDown {
-					inputState.KeyUpDown = true
+			case sf.KeySpace:
+				if spectating {
+					camera.FreeLook()
 				}
 			}
 		}
@@ -249,27 +577,87 @@ func handleUserInput(renderWindow *sf.RenderWindow, inputState *shared.InputStat
 	return inputState
 }
 
+// Which way the mouse at x,y in the window is from the middle of our player, as a direction one
+// pixel long.  Nil if we don't have a player to aim from or the mouse is right in its middle.
+func aimToward(renderWindow *sf.RenderWindow, x, y int) *shared.FloatVector {
+	player, ok := entities[myPlayerId]
+	if !ok || spectating {
+		return nil
+	}
+
+	mouse := renderWindow.MapPixelToCoords(sf.Vector2i{x, y}, renderWindow.GetDefaultView())
+	pos := player.GetPosition()
+	half := shared.ENTITY_SIZE / 2
+	dx, dy := mouse.X-(pos.X+half), mouse.Y-(pos.Y+half)
+
+	length := float32(math.Hypot(float64(dx), float64(dy)))
+	if length == 0 {
+		return nil
+	}
+	return &shared.FloatVector{X: dx / length, Y: dy / length}
+}
+
+// Get the room after the one we're in from the last room list, wrapping around at the end.  Returns
+// an empty string if there's nowhere else to go.
+func nextRoom() string {
+	for i, info := range roomList {
+		if info.Name == currentRoom {
+			next := roomList[(i+1)%len(roomList)].Name
+			if next == currentRoom {
+				return ""
+			}
+			return next
+		}
+	}
+
+	if len(roomList) > 0 {
+		return roomList[0].Name
+	}
+	return ""
+}
+
+// Get the team after the one we're on in the room's list of teams, wrapping around at the end.
+// Returns an empty string if the room doesn't have teams.
+func nextTeam() string {
+	if len(roomTeams) == 0 {
+		return ""
+	}
+
+	for i, team := range roomTeams {
+		if team == myTeam {
+			return roomTeams[(i+1)%len(roomTeams)]
+		}
+	}
+	return roomTeams[0]
+}
+
 // Add a new entity to the game world.  It will use the Player constructor (for the player texture)
 // if the entity ID matches the player ID and the Other constructor otherwise.
-func addEntityToGameWorld(id int64, pos sf.Vector2f) {
+func addEntityToGameWorld(id int64, name, team string, pos sf.Vector2f) {
 	if id == myPlayerId {
 		_, ok := entities[myPlayerId]
 		if ok {
-			log.Print("ERROR - tried to add a new player with the same ID")
+			gameLog.Error("Tried to add a new player with the same ID", logging.PLAYER_ID, id)
 			return
 		}
 
 		player := NewPlayer(pos)
+		player.name = name
+		player.SetTeam(team)
+		myTeam = team
 		entities[myPlayerId] = player
 	} else {
 		_, ok := entities[id]
 		if ok {
-			log.Print("ERROR - tried to add a new other entity with an ID that was already in the system")
+			gameLog.Error("Tried to add a new other entity with an ID that was already in the system", logging.PLAYER_ID, id)
 			return
 		}
 
 		other := NewOther(pos)
+		other.name = name
+		other.SetTeam(team)
 		entities[id] = other
+		gameLog.Info("Player joined", logging.PLAYER_ID, id, "username", name)
 	}
 }
 
@@ -297,23 +685,72 @@ func removeDisconnectedPlayers(serverEntities []protocol.MessageEntity) {
 	}
 }
 
-// Establish a connection to the game server and start the two goroutines which require it
-func connectToServer() net.Conn {
-	conn, err := net.Dial("tcp", shared.HOST+":"+shared.PORT)
+// Establish the first connection to the game server and start the two goroutines which require
+// it.  Blocks until we've got a player ID, retrying with backoff if the server isn't there yet.
+func connectToServer() {
+	c, b, uuidMsg := dialWithBackoff()
+	myPlayerId = uuidMsg.UUID
+
+	go maintainConnection(c, b)
+	go writeMessages(outgoing)
+}
+
+// Keeps us connected to the server.  Listens on the current connection until it drops, then
+// reconnects (presenting our session token) and goes back to listening.  The PlayerUUIDMessage
+// from each reconnect goes through the message queue so the game loop can tell whether we got
+// our old player back.
+//
+// This is a concurrent function - it runs simultaneously to the main game loop as a goroutine
+func maintainConnection(c net.Conn, b *bufio.Reader) {
+	for {
+		setConn(c)
+		listenForMessages(c, b)
+		setConn(nil)
+
+		netLog.Warn("Lost connection to the server, reconnecting")
+		var uuidMsg *protocol.PlayerUUIDMessage
+		c, b, uuidMsg = dialWithBackoff()
+		messageQueue.PushMessage(uuidMsg)
+	}
+}
+
+// Keep trying to connect and join until it works, doubling the wait between attempts each time.
+func dialWithBackoff() (net.Conn, *bufio.Reader, *protocol.PlayerUUIDMessage) {
+	backoff := RECONNECT_MIN_BACKOFF
+	for {
+		c, err := transport.Dial(shared.HOST+":"+shared.PORT, tlsConfig)
+		if err == nil {
+			b := bufio.NewReader(c)
+			uuidMsg, err := joinServer(c, b)
+			if err == nil {
+				return c, b, uuidMsg
+			}
+			c.Close()
+		}
+
+		netLog.Warn("Couldn't connect to server", logging.ERROR, err, "retry_in", backoff)
+		time.Sleep(backoff)
+
+		backoff *= 2
+		if backoff > RECONNECT_MAX_BACKOFF {
+			backoff = RECONNECT_MAX_BACKOFF
+		}
+	}
+}
+
+// Send our JoinMessage and wait for the server to give us an entity ID.  If the server is full
+// that means waiting in its join queue until a slot comes free.  Remembers the session token the
+// server hands back for the next time we have to reconnect.
+func joinServer(c net.Conn, b *bufio.Reader) (*protocol.PlayerUUIDMessage, error) {
+	_, err := c.Write(protocol.CreateJoinMessage(username, credential, sessionToken, spectating).Encode())
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
 
-	// Now we're going to wait for the server to give us an entity ID
-	b := bufio.NewReader(conn)
 	for {
 		line, err := b.ReadBytes('\n')
-
 		if err != nil {
-			conn.Close()
-			log.Print("Error while trying to accept player id")
-			os.Exit(1)
-			break
+			return nil, err
 		}
 
 		if string(line) == "" || string(line) == "\n" {
@@ -322,45 +759,41 @@ func connectToServer() net.Conn {
 
 		message, err := protocol.DecodeMessage(line)
 		if err != nil {
-			log.Print("ERROR during decode: " + err.Error())
+			netLog.Error("Error during decode", logging.ERROR, err)
 			continue
 		}
 
-		if message.GetMessageType() == protocol.PLAYER_UUID_MESSAGE {
-			typed, ok := message.(*protocol.PlayerUUIDMessage)
-			if !ok {
-				log.Print("Message couldn't be asserted into PlayerUUIDMessage though that was message id")
-				conn.Close()
-				os.Exit(1)
-			}
-			myPlayerId = typed.UUID
-			break
-		} else {
-			log.Print("Got the wrong type of message - expected PLAYER_UUID_MESSAGE")
-			conn.Close()
-			os.Exit(1)
+		// No point retrying if the server doesn't want us
+		if rejected, ok := message.(*protocol.JoinRejectedMessage); ok {
+			logging.Fatal(netLog, "Server refused to let us join", "reason", rejected.Reason)
 		}
-	}
 
-	go listenForMessages(conn)
-	go writeMessages(conn, outgoing)
+		if status, ok := message.(*protocol.QueueStatusMessage); ok {
+			netLog.Info("Server is full, waiting in the queue", "position", status.Position, "queue_length", status.Length)
+			continue
+		}
 
-	return conn
+		typed, ok := message.(*protocol.PlayerUUIDMessage)
+		if !ok {
+			return nil, errors.New("got the wrong type of message - expected PLAYER_UUID_MESSAGE")
+		}
+
+		sessionToken = typed.SessionToken
+		return typed, nil
+	}
 }
 
 // Listens for incoming messages from the server, decodes the serialized versions into
-// message objects and then pushes them into the message queue.
-//
-// This is a concurrent function - it runs simultaneously to the main game loop as a goroutine
-func listenForMessages(conn net.Conn) {
-	b := bufio.NewReader(conn)
+// message objects and then pushes them into the message queue.  Returns once the connection
+// is closed or broken.
+func listenForMessages(c net.Conn, b *bufio.Reader) {
 	for {
 		line, err := b.ReadBytes('\n')
 
 		if err != nil {
-			conn.Close()
-			log.Print("ERROR, CLOSING CONN: " + err.Error())
-			break
+			c.Close()
+			netLog.Error("Closing connection", logging.ERROR, err)
+			return
 		}
 
 		if string(line) == "" || string(line) == "\n" {
@@ -370,19 +803,50 @@ func listenForMessages(conn net.Conn) {
 		// Deal with incoming messages from the server
 		message, err := protocol.DecodeMessage(line)
 		if err != nil {
-			log.Print("Error decoding message: " + err.Error())
+			netLog.Error("Error decoding message", logging.ERROR, err)
 			continue
 		}
+
+		// Being thrown out isn't something to reconnect from
+		if typed, ok := message.(*protocol.DisconnectMessage); ok {
+			logging.Fatal(netLog, "Disconnected by the server", "reason", typed.Reason)
+		}
+
+		// Pings get answered straight away so the game loop's frame time doesn't count in the
+		// round trip time the server measures
+		if typed, ok := message.(*protocol.PingMessage); ok {
+			outgoing <- protocol.CreatePongMessage(typed.SentTime)
+			continue
+		}
+
 		messageQueue.PushMessage(message)
 	}
 }
 
-// This function writes outgoing messages to the connection.
+// This function writes outgoing messages to the connection.  While we're disconnected the
+// messages are simply dropped - the game loop never has to wait on a reconnect.
 //
 // This is a concurrent function - it runs simultaneously to the main game loop as a goroutine
-func writeMessages(conn net.Conn, msgChan chan protocol.Message) {
+func writeMessages(msgChan chan protocol.Message) {
 	for {
 		msg := <-msgChan
-		conn.Write(msg.Encode())
+		c := getConn()
+		if c != nil {
+			c.Write(msg.Encode())
+		}
 	}
 }
+
+// Get the current connection to the server, nil if we're disconnected
+func getConn() net.Conn {
+	connLock.Lock()
+	defer connLock.Unlock()
+	return conn
+}
+
+// Swap in a new connection to the server
+func setConn(c net.Conn) {
+	connLock.Lock()
+	defer connLock.Unlock()
+	conn = c
+}
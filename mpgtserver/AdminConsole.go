@@ -0,0 +1,817 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+	"github.com/gabriel-comeau/multiplayer-game-test/transport"
+)
+
+const (
+	// How long a command waits for a room's loop to get around to it before giving up
+	ADMIN_TASK_TIMEOUT time.Duration = 2 * time.Second
+
+	// How long a remote admin has to send the password after connecting
+	ADMIN_LOGIN_TIMEOUT time.Duration = 10 * time.Second
+)
+
+var adminLog = logging.For("admin")
+
+// One thing the admin console knows how to do
+type adminCommand struct {
+	// How to call it and what it does, for the help command
+	usage string
+	help  string
+
+	// Fewest arguments it can be given
+	minArgs int
+
+	run func(args []string, out io.Writer) error
+}
+
+// Lets an operator look at and change the running server.  Commands come in one per line, either
+// typed on the server's own stdin (-admin-console) or from a remote connection which has sent the
+// admin password first (-admin-addr).  Every command is logged along with where it came from.
+type AdminConsole struct {
+	commands map[string]*adminCommand
+	password string
+}
+
+// Run one line's worth of command, writing the result to out
+func (ac *AdminConsole) Execute(line string, out io.Writer, source string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	name, args := strings.ToLower(fields[0]), fields[1:]
+	cmd, ok := ac.commands[name]
+	if !ok {
+		fmt.Fprintf(out, "unknown command %q, try help\n", name)
+		return
+	}
+	if len(args) < cmd.minArgs {
+		fmt.Fprintf(out, "usage: %v\n", cmd.usage)
+		return
+	}
+
+	adminLog.Info("Admin command", "source", source, "command", line)
+	if err := cmd.run(args, out); err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+	}
+}
+
+// Read commands from in until it runs out or the admin types quit, writing the results to out
+func (ac *AdminConsole) Serve(in io.Reader, out io.Writer, source string) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			return
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "quit" || line == "exit" {
+			return
+		}
+		ac.Execute(line, out, source)
+	}
+}
+
+// Accept remote admin connections on the given address, forever.  Uses TLS if tlsConfig isn't nil,
+// otherwise the password goes over the wire in the clear.
+func (ac *AdminConsole) ListenAndServe(addr string, tlsConfig *tls.Config) {
+	listener, err := transport.Listen(addr, tlsConfig)
+	if err != nil {
+		adminLog.Error("Admin listener failed", logging.ERROR, err)
+		return
+	}
+
+	if tlsConfig == nil {
+		adminLog.Warn("Admin listener isn't using TLS, the password is sent in the clear", logging.ADDR, listener.Addr().String())
+	} else {
+		adminLog.Info("Admin listener started", logging.ADDR, listener.Addr().String())
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			adminLog.Error("Error during accept", logging.ERROR, err)
+			continue
+		}
+		go ac.handleConn(conn)
+	}
+}
+
+// Check a remote admin's password, then hand the connection to Serve
+func (ac *AdminConsole) handleConn(conn net.Conn) {
+	defer conn.Close()
+	addr := conn.RemoteAddr().String()
+
+	conn.SetReadDeadline(time.Now().Add(ADMIN_LOGIN_TIMEOUT))
+	b := bufio.NewReader(conn)
+	fmt.Fprint(conn, "password: ")
+	line, err := b.ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if subtle.ConstantTimeCompare([]byte(password), []byte(ac.password)) != 1 {
+		adminLog.Warn("Admin login failed", logging.ADDR, addr)
+		fmt.Fprintln(conn, "wrong password")
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	adminLog.Info("Admin logged in", logging.ADDR, addr)
+	fmt.Fprintln(conn, "logged in, try help")
+	ac.Serve(b, conn, addr)
+	adminLog.Info("Admin logged out", logging.ADDR, addr)
+}
+
+// List every command
+func (ac *AdminConsole) help(args []string, out io.Writer) error {
+	names := make([]string, 0, len(ac.commands))
+	for name := range ac.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-32v %v\n", ac.commands[name].usage, ac.commands[name].help)
+	}
+	return nil
+}
+
+// List the connected clients
+func adminList(args []string, out io.Writer) error {
+	clients := clientHolder.GetClients()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].clientId < clients[j].clientId })
+
+	fmt.Fprintf(out, "%-6v %-16v %-10v %-22v %-12v %-8v\n", "ID", "USERNAME", "KIND", "ADDRESS", "ROOM", "RTT")
+	for _, c := range clients {
+		kind, room := "player", ""
+		if c.spectator {
+			kind = "spectator"
+		}
+		if r := c.GetRoom(); r != nil {
+			room = r.name
+		}
+
+		fmt.Fprintf(out, "%-6v %-16v %-10v %-22v %-12v %-8v\n",
+			c.clientId, c.username, kind, c.conn.RemoteAddr().String(), room, c.GetRTT().Round(time.Millisecond))
+	}
+	fmt.Fprintf(out, "%v connected\n", len(clients))
+	return nil
+}
+
+// List the open rooms
+func adminRooms(args []string, out io.Writer) error {
+	for _, info := range roomHolder.List() {
+		fmt.Fprintf(out, "%-16v players=%-4v max=%-4v tick=%vms speed=%v\n",
+			info.Name, info.Players, info.Settings.MaxPlayers, info.Settings.TickMillis, info.Settings.Speed)
+	}
+	return nil
+}
+
+// Put a bot in a room
+func adminAddBot(args []string, out io.Writer) error {
+	room := roomHolder.GetRoom(args[0])
+	if room == nil {
+		return ErrNoSuchRoom
+	}
+
+	// The room's map can change between rounds, so the behavior has to be set up in the room's
+	// loop to be sure of getting the right one
+	var ent *PlayerEntity
+	err := runInRoom(room, func() error {
+		behavior, err := CreateBotBehavior(args[1], args[2:], room.spawner.gameMap)
+		if err != nil {
+			return err
+		}
+		ent = room.AddBot(behavior)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "added %v (%v) to %v\n", ent.username, ent.entityId, room.name)
+	return nil
+}
+
+// Put a pickup somewhere in a room.  It doesn't come back once it's been taken.
+func adminPickup(args []string, out io.Writer) error {
+	room := roomHolder.GetRoom(args[0])
+	if room == nil {
+		return ErrNoSuchRoom
+	}
+
+	x, errX := strconv.ParseFloat(args[2], 32)
+	y, errY := strconv.ParseFloat(args[3], 32)
+	if errX != nil || errY != nil {
+		return errors.New("the position has to be two numbers")
+	}
+	pos := shared.FloatVector{X: float32(x), Y: float32(y)}
+
+	var pickup *Pickup
+	err := runInRoom(room, func() error {
+		var err error
+		pickup, err = room.pickups.Place(protocol.PickupKind(args[1]), pos)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "put a %v pickup (%v) in %v at %v,%v\n", pickup.kind, pickup.id, room.name, pos.X, pos.Y)
+	return nil
+}
+
+// Set how much health a player has
+func adminHealth(args []string, out io.Writer) error {
+	client, err := clientArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	health, err := strconv.Atoi(args[1])
+	if err != nil || health < 0 || health > shared.MAX_HEALTH {
+		return fmt.Errorf("health has to be a whole number from 0 to %v", shared.MAX_HEALTH)
+	}
+
+	room := client.GetRoom()
+	if room == nil || client.spectator {
+		return fmt.Errorf("%v isn't playing in a room", client.username)
+	}
+
+	err = runInRoom(room, func() error {
+		ent := room.entities.GetEntity(client.clientId)
+		if ent == nil {
+			return fmt.Errorf("%v has no entity in %v", client.username, room.name)
+		}
+		ent.health = health
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "set %v's health to %v\n", client.username, health)
+	return nil
+}
+
+// Change the way a player moves.  Each setting is given as name=value: maxspeed, accel, friction and
+// drag are numbers, diagonals is on or off.  Anything not given stays as it is.
+func adminMovement(args []string, out io.Writer) error {
+	client, err := clientArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	room := client.GetRoom()
+	if room == nil || client.spectator {
+		return fmt.Errorf("%v isn't playing in a room", client.username)
+	}
+
+	var movement shared.MovementParams
+	err = runInRoom(room, func() error {
+		ent := room.entities.GetEntity(client.clientId)
+		if ent == nil {
+			return fmt.Errorf("%v has no entity in %v", client.username, room.name)
+		}
+
+		movement = ent.movement
+		if err := parseMovement(&movement, args[1:]); err != nil {
+			return err
+		}
+		room.SetMovement(ent, movement)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%v now moves with maxspeed=%v accel=%v friction=%v drag=%v diagonals=%v\n", client.username,
+		movement.MaxSpeed, movement.Acceleration, movement.Friction, movement.Drag, onOff(movement.NormalizeDiagonals))
+	return nil
+}
+
+// Apply name=value settings from the movement command
+func parseMovement(movement *shared.MovementParams, settings []string) error {
+	for _, setting := range settings {
+		name, value, _ := strings.Cut(setting, "=")
+		if name == "diagonals" {
+			if value != "on" && value != "off" {
+				return errors.New("diagonals has to be on or off")
+			}
+			movement.NormalizeDiagonals = value == "on"
+			continue
+		}
+
+		number, err := strconv.ParseFloat(value, 32)
+		if err != nil || number < 0 {
+			return fmt.Errorf("%v has to be a number, and not a negative one", name)
+		}
+		switch name {
+		case "maxspeed":
+			if float32(number) < MIN_ROOM_SPEED || float32(number) > MAX_ROOM_SPEED {
+				return fmt.Errorf("maxspeed must be between %v and %v", MIN_ROOM_SPEED, MAX_ROOM_SPEED)
+			}
+			movement.MaxSpeed = float32(number)
+		case "accel":
+			movement.Acceleration = float32(number)
+		case "friction":
+			movement.Friction = float32(number)
+		case "drag":
+			movement.Drag = float32(number)
+		default:
+			return fmt.Errorf("there's no %q, try maxspeed, accel, friction, drag or diagonals", name)
+		}
+	}
+	return nil
+}
+
+// Show a flag the way the movement command takes it
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// Give a player a push.  The impulse is added to however fast they're already going, in pixels per
+// second along each axis.
+func adminKnockback(args []string, out io.Writer) error {
+	client, err := clientArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	x, errX := strconv.ParseFloat(args[1], 32)
+	y, errY := strconv.ParseFloat(args[2], 32)
+	if errX != nil || errY != nil {
+		return errors.New("the impulse has to be two numbers")
+	}
+	impulse := shared.FloatVector{X: float32(x), Y: float32(y)}
+
+	room := client.GetRoom()
+	if room == nil || client.spectator {
+		return fmt.Errorf("%v isn't playing in a room", client.username)
+	}
+
+	var velocity shared.FloatVector
+	err = runInRoom(room, func() error {
+		ent := room.entities.GetEntity(client.clientId)
+		if ent == nil {
+			return fmt.Errorf("%v has no entity in %v", client.username, room.name)
+		}
+
+		room.Knockback(ent, impulse)
+		velocity = ent.velocity
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "knocked %v back, now going %v,%v\n", client.username, velocity.X, velocity.Y)
+	return nil
+}
+
+// Take a bot out of whichever room it's in
+func adminRemoveBot(args []string, out io.Writer) error {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("%q isn't a bot ID", args[0])
+	}
+
+	// Each room's loop looks for the bot itself, since the loop could be moving it right now
+	for _, room := range roomHolder.GetRooms() {
+		var removed *PlayerEntity
+		err := runInRoom(room, func() error {
+			if ent := room.entities.GetEntity(id); ent != nil && ent.bot != nil {
+				room.entities.RemoveEntity(id)
+				removed = ent
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if removed != nil {
+			fmt.Fprintf(out, "removed %v from %v\n", removed.username, room.name)
+			return nil
+		}
+	}
+	return fmt.Errorf("there's no bot %v", id)
+}
+
+// Throw a player off the server
+func adminKick(args []string, out io.Writer) error {
+	client, err := clientArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	kickPlayer(client.clientId, reasonArg(args[1:], "kicked by an admin"))
+	fmt.Fprintf(out, "kicked %v\n", client.username)
+	return nil
+}
+
+// Ban a player's username and address, then throw them off
+func adminBan(args []string, out io.Writer) error {
+	client, err := clientArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	duration, err := parseBanDuration(args[1])
+	if err != nil {
+		return err
+	}
+
+	banPlayer(client.clientId, reasonArg(args[2:], "banned by an admin"), duration)
+	fmt.Fprintf(out, "banned %v\n", client.username)
+	return nil
+}
+
+// Ban a username, whether or not anyone is using it right now
+func adminBanName(args []string, out io.Writer) error {
+	duration, err := parseBanDuration(args[1])
+	if err != nil {
+		return err
+	}
+
+	err = banList.BanUsername(args[0], reasonArg(args[2:], "banned by an admin"), duration)
+	if err != nil {
+		return err
+	}
+
+	enforceBans()
+	fmt.Fprintf(out, "banned %v\n", args[0])
+	return nil
+}
+
+// Ban an address or a CIDR range of them
+func adminBanIP(args []string, out io.Writer) error {
+	duration, err := parseBanDuration(args[1])
+	if err != nil {
+		return err
+	}
+
+	err = banList.BanNetwork(args[0], reasonArg(args[2:], "banned by an admin"), duration)
+	if err != nil {
+		return err
+	}
+
+	enforceBans()
+	fmt.Fprintf(out, "banned %v\n", args[0])
+	return nil
+}
+
+// Lift the bans on a username, address or range
+func adminUnban(args []string, out io.Writer) error {
+	removed, err := banList.Remove(args[0])
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("%v isn't banned", args[0])
+	}
+
+	fmt.Fprintf(out, "lifted %v bans on %v\n", removed, args[0])
+	return nil
+}
+
+// Let an address or range in even if a ban covers it
+func adminAllow(args []string, out io.Writer) error {
+	if err := banList.Allow(args[0]); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "allowed %v\n", args[0])
+	return nil
+}
+
+// Take an address or range back off the allow list
+func adminUnallow(args []string, out io.Writer) error {
+	found, err := banList.Disallow(args[0])
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%v isn't on the allow list", args[0])
+	}
+
+	// Anyone who was only getting in because of the allow rule has to go now
+	enforceBans()
+	fmt.Fprintf(out, "unallowed %v\n", args[0])
+	return nil
+}
+
+// List the bans and the allow list
+func adminBans(args []string, out io.Writer) error {
+	banList.Dump(out)
+	return nil
+}
+
+// Move a player's entity somewhere else in their room
+func adminTeleport(args []string, out io.Writer) error {
+	client, err := clientArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	x, errX := strconv.ParseFloat(args[1], 32)
+	y, errY := strconv.ParseFloat(args[2], 32)
+	if errX != nil || errY != nil {
+		return errors.New("the position has to be two numbers")
+	}
+	pos := shared.FloatVector{X: float32(x), Y: float32(y)}
+
+	room := client.GetRoom()
+	if room == nil || client.spectator {
+		return fmt.Errorf("%v isn't playing in a room", client.username)
+	}
+
+	// The entity belongs to the room's loop, so the move has to happen there
+	err = runInRoom(room, func() error {
+		ent := room.entities.GetEntity(client.clientId)
+		if ent == nil {
+			return fmt.Errorf("%v has no entity in %v", client.username, room.name)
+		}
+
+		ent.Teleport(pos, time.Now())
+		room.recorder.RecordTeleport(ent)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "moved %v to %v,%v\n", client.username, pos.X, pos.Y)
+	return nil
+}
+
+// Put a player on a team, however unbalanced that leaves things
+func adminTeam(args []string, out io.Writer) error {
+	client, err := clientArg(args[0])
+	if err != nil {
+		return err
+	}
+
+	room := client.GetRoom()
+	if room == nil || client.spectator {
+		return fmt.Errorf("%v isn't playing in a room", client.username)
+	}
+
+	err = runInRoom(room, func() error {
+		ent := room.entities.GetEntity(client.clientId)
+		if ent == nil {
+			return fmt.Errorf("%v has no entity in %v", client.username, room.name)
+		}
+		return room.ChangeTeam(ent, args[1], true)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "put %v on the %v team\n", client.username, args[1])
+	return nil
+}
+
+// Change how many players the server takes, 0 for no limit.  Anyone waiting in the join queue who
+// fits under the new limit gets let in.
+func adminMaxPlayers(args []string, out io.Writer) error {
+	max, err := strconv.Atoi(args[0])
+	if err != nil || max < 0 {
+		return errors.New("the player limit has to be a whole number, 0 for no limit")
+	}
+
+	joinQueue.SetMaxPlayers(max)
+	gameLog.Info("Player limit changed", "max_players", max)
+	joinQueue.Dump(out)
+	return nil
+}
+
+// Change how long a room's ticks are
+func adminTick(args []string, out io.Writer) error {
+	millis, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errors.New("the tick length has to be a whole number of milliseconds")
+	}
+
+	return changeRoomSettings(args[0], out, func(settings *protocol.RoomSettings) {
+		settings.TickMillis = millis
+	})
+}
+
+// Change how fast players move in a room
+func adminSpeed(args []string, out io.Writer) error {
+	speed, err := strconv.ParseFloat(args[1], 32)
+	if err != nil {
+		return errors.New("the speed has to be a number of pixels per second")
+	}
+
+	return changeRoomSettings(args[0], out, func(settings *protocol.RoomSettings) {
+		settings.Speed = float32(speed)
+	})
+}
+
+// Send a system line of chat to everyone on the server
+func adminAnnounce(args []string, out io.Writer) error {
+	text := strings.Join(args, " ")
+	broadcastMessage(protocol.CreateChatMessage(protocol.CHAT_SCOPE_SYSTEM, 0, "", "", text))
+	chatLog.Info("Announcement", "text", text)
+	fmt.Fprintf(out, "sent to %v clients\n", len(clientHolder.GetClients()))
+	return nil
+}
+
+// Stop a player from chatting for a while
+func adminMute(args []string, out io.Writer) error {
+	duration, err := time.ParseDuration(args[1])
+	if err != nil || duration <= 0 {
+		return errors.New("the duration has to be something like 30s or 10m")
+	}
+
+	chatFilter.Mute(args[0], time.Now().Add(duration))
+	fmt.Fprintf(out, "muted %v for %v\n", args[0], duration)
+	return nil
+}
+
+// Let a muted player chat again
+func adminUnmute(args []string, out io.Writer) error {
+	chatFilter.Unmute(args[0])
+	fmt.Fprintf(out, "unmuted %v\n", args[0])
+	return nil
+}
+
+// Write out everything the server knows, or everything about one room
+func adminDump(args []string, out io.Writer) error {
+	rooms := roomHolder.GetRooms()
+	if len(args) > 0 {
+		room := roomHolder.GetRoom(args[0])
+		if room == nil {
+			return ErrNoSuchRoom
+		}
+		rooms = []*Room{room}
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].name < rooms[j].name })
+
+	for _, room := range rooms {
+		settings := room.Settings()
+		fmt.Fprintf(out, "room %v: persistent=%v mode=%v max=%v tick=%vms speed=%v members=%v\n",
+			room.name, room.persistent, settings.Mode, settings.MaxPlayers, settings.TickMillis, settings.Speed, len(room.members.GetClients()))
+
+		// Like teleporting, the round and the entities have to be looked at from the room's own loop
+		var roundLine, pickupLine string
+		var lines []string
+		err := runInRoom(room, func() error {
+			now := time.Now()
+			roundLine = fmt.Sprintf("  round %v: %v, %v left, map=%v status=%q",
+				room.round.number, room.round.state, room.round.Remaining(now).Round(time.Second), gameMaps[room.mapIndex].Name, room.round.status)
+			pickupLine = "  pickups:"
+			for _, pickup := range room.pickups.Pickups() {
+				pickupLine += fmt.Sprintf(" %v=%v@%v,%v", pickup.id, pickup.kind, pickup.position.X, pickup.position.Y)
+			}
+			for _, ent := range room.entities.GetEntities() {
+				movement := ent.Movement()
+				line := fmt.Sprintf("  %v %v team=%v pos=%v,%v vel=%v,%v seq=%v violations=%.1f health=%v maxspeed=%v diagonals=%v",
+					ent.entityId, ent.username, ent.team, ent.position.X, ent.position.Y, ent.velocity.X, ent.velocity.Y, ent.lastSeq,
+					ent.budget.Score(now), ent.health, movement.MaxSpeed, onOff(movement.NormalizeDiagonals))
+				if ent.bot != nil {
+					line += " bot=" + ent.bot.behavior.Name()
+				}
+				lines = append(lines, line)
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(out, "  %v\n", err)
+			continue
+		}
+
+		fmt.Fprintln(out, roundLine)
+		fmt.Fprintln(out, pickupLine)
+		sort.Strings(lines)
+		for _, line := range lines {
+			fmt.Fprintln(out, line)
+		}
+	}
+
+	if len(args) == 0 {
+		players, spectators := clientHolder.Count()
+		fmt.Fprintf(out, "clients: %v players, %v spectators\n", players, spectators)
+		joinQueue.Dump(out)
+		matchmaker.Dump(out)
+	}
+	return nil
+}
+
+// Hand a function to a room's loop and wait for it to be run.  Gives up if the room doesn't get
+// to it in time, which is what happens if the room closes first.
+func runInRoom(room *Room, task func() error) error {
+	done := make(chan error, 1)
+	room.Do(func() {
+		done <- task()
+	})
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(ADMIN_TASK_TIMEOUT):
+		return fmt.Errorf("room %v didn't answer, it may have closed", room.name)
+	}
+}
+
+// Change some of a room's settings, checking the result the same way a new room's are checked
+func changeRoomSettings(name string, out io.Writer, change func(settings *protocol.RoomSettings)) error {
+	room := roomHolder.GetRoom(name)
+	if room == nil {
+		return ErrNoSuchRoom
+	}
+
+	settings := room.Settings()
+	change(&settings)
+	settings, err := normalizeRoomSettings(settings)
+	if err != nil {
+		return err
+	}
+
+	room.SetSettings(settings)
+	gameLog.Info("Room settings changed", "room", room.name, "tick_ms", settings.TickMillis, "speed", settings.Speed)
+	fmt.Fprintf(out, "%v: tick=%vms speed=%v\n", room.name, settings.TickMillis, settings.Speed)
+	return nil
+}
+
+// Find the connected client with the ID given as a command argument
+func clientArg(arg string) (*Client, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%q isn't a client ID", arg)
+	}
+
+	client := clientHolder.GetClient(id)
+	if client == nil {
+		return nil, fmt.Errorf("no client with ID %v", id)
+	}
+	return client, nil
+}
+
+// Join what's left of a command's arguments into a reason, or use the default if there aren't any
+func reasonArg(args []string, def string) string {
+	if len(args) == 0 {
+		return def
+	}
+	return strings.Join(args, " ")
+}
+
+// Create the admin console.  The password is only needed for remote admins.
+func CreateAdminConsole(password string) *AdminConsole {
+	ac := &AdminConsole{password: password}
+	ac.commands = map[string]*adminCommand{
+		"help":       {usage: "help", help: "list the commands", run: ac.help},
+		"list":       {usage: "list", help: "list the connected clients", run: adminList},
+		"rooms":      {usage: "rooms", help: "list the open rooms", run: adminRooms},
+		"kick":       {usage: "kick <id> [reason]", help: "disconnect a client", minArgs: 1, run: adminKick},
+		"ban":        {usage: "ban <id> <length> [reason]", help: "ban a player's name and address and disconnect them", minArgs: 2, run: adminBan},
+		"banname":    {usage: "banname <username> <length> [reason]", help: "ban a username", minArgs: 2, run: adminBanName},
+		"banip":      {usage: "banip <address/range> <length> [reason]", help: "ban an address or CIDR range", minArgs: 2, run: adminBanIP},
+		"unban":      {usage: "unban <username/address/range>", help: "lift a ban", minArgs: 1, run: adminUnban},
+		"allow":      {usage: "allow <address/range>", help: "let an address or range in even if it's banned", minArgs: 1, run: adminAllow},
+		"unallow":    {usage: "unallow <address/range>", help: "take an address or range off the allow list", minArgs: 1, run: adminUnallow},
+		"bans":       {usage: "bans", help: "list the bans and the allow list", run: adminBans},
+		"teleport":   {usage: "teleport <id> <x> <y>", help: "move a player somewhere else in their room", minArgs: 3, run: adminTeleport},
+		"team":       {usage: "team <id> <team>", help: "put a player on a team, ignoring the balance", minArgs: 2, run: adminTeam},
+		"addbot":     {usage: "addbot <room> <behavior> [x,y ...]", help: "put a bot in a room, patrol bots can be given waypoints", minArgs: 2, run: adminAddBot},
+		"removebot":  {usage: "removebot <id>", help: "take a bot out of its room", minArgs: 1, run: adminRemoveBot},
+		"pickup":     {usage: "pickup <room> <kind> <x> <y>", help: "put a pickup in a room: speed, health or score", minArgs: 4, run: adminPickup},
+		"health":     {usage: "health <id> <amount>", help: "set how much health a player has", minArgs: 2, run: adminHealth},
+		"movement":   {usage: "movement <id> <name=value ...>", help: "change how a player moves: maxspeed, accel, friction, drag or diagonals=on/off", minArgs: 2, run: adminMovement},
+		"knockback":  {usage: "knockback <id> <x> <y>", help: "push a player, adding to their velocity in pixels per second", minArgs: 3, run: adminKnockback},
+		"maxplayers": {usage: "maxplayers <n>", help: "change how many players the server takes, 0 for no limit", minArgs: 1, run: adminMaxPlayers},
+		"tick":       {usage: "tick <room> <ms>", help: "change how long a room's ticks are", minArgs: 2, run: adminTick},
+		"speed":      {usage: "speed <room> <pixels/s>", help: "change how fast players move in a room", minArgs: 2, run: adminSpeed},
+		"announce":   {usage: "announce <text>", help: "send a message to everyone", minArgs: 1, run: adminAnnounce},
+		"mute":       {usage: "mute <username> <duration>", help: "stop a player from chatting", minArgs: 2, run: adminMute},
+		"unmute":     {usage: "unmute <username>", help: "let a muted player chat again", minArgs: 1, run: adminUnmute},
+		"dump":       {usage: "dump [room]", help: "write out the state of every room, or just one", run: adminDump},
+	}
+
+	return ac
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Longest username we'll accept from anyone, authenticated or not
+const MAX_USERNAME_LENGTH = 24
+
+// The names the server makes up for players and spectators who don't give one.  Nobody gets to
+// ask for one of these, or they could end up sharing it with whoever the server gives it to.
+var generatedUsername = regexp.MustCompile(`(?i)^(player|spectator)[0-9]+$`)
+
+var (
+	// Returned by authenticators when the credential doesn't check out.  Deliberately vague so a
+	// client can't tell a bad username from a bad password.
+	ErrBadCredentials = errors.New("invalid username or credential")
+)
+
+// An Authenticator decides whether a joining client is who it says it is.  It is given the username
+// and credential from the client's JoinMessage and returns the username the player will be known
+// by, or an error if the player isn't allowed in.
+type Authenticator interface {
+	Authenticate(username, credential string) (string, error)
+}
+
+// Lets everyone in under whatever name they asked for.  This is what the server has always done.
+type AnonymousAuthenticator struct{}
+
+// Authenticator interface
+func (a *AnonymousAuthenticator) Authenticate(username, credential string) (string, error) {
+	return checkUsername(username)
+}
+
+// Lets in anyone who knows the server-wide secret, under whatever name they asked for.
+type SharedSecretAuthenticator struct {
+	secret []byte
+}
+
+// Authenticator interface
+func (a *SharedSecretAuthenticator) Authenticate(username, credential string) (string, error) {
+	if subtle.ConstantTimeCompare([]byte(credential), a.secret) != 1 {
+		return "", ErrBadCredentials
+	}
+
+	return checkUsername(username)
+}
+
+// Constructor, returns a pointer to a SharedSecretAuthenticator
+func CreateSharedSecretAuthenticator(secret string) *SharedSecretAuthenticator {
+	return &SharedSecretAuthenticator{secret: []byte(secret)}
+}
+
+// Build the authenticator selected in the server configuration
+func createAuthenticator(cfg *ServerConfig) (Authenticator, error) {
+	switch cfg.authMode {
+	case "none":
+		return new(AnonymousAuthenticator), nil
+	case "secret":
+		if cfg.authSecret == "" {
+			return nil, errors.New("auth mode secret needs -auth-secret")
+		}
+		return CreateSharedSecretAuthenticator(cfg.authSecret), nil
+	case "hmac":
+		if cfg.authHMACKey == "" {
+			return nil, errors.New("auth mode hmac needs -auth-hmac-key")
+		}
+		return CreateHMACAuthenticator(cfg.authHMACKey), nil
+	case "userfile":
+		if cfg.authUserFile == "" {
+			return nil, errors.New("auth mode userfile needs -auth-users")
+		}
+		return LoadUserFileAuthenticator(cfg.authUserFile)
+	}
+
+	return nil, fmt.Errorf("unknown auth mode %q", cfg.authMode)
+}
+
+// Sanity check a username.  Names are optional - an empty one is fine and the server will make one
+// up - but they can't be absurdly long, have control characters (newlines included) which would
+// mess up chat, logs and the scoreboard, or look like one the server made up.
+func checkUsername(username string) (string, error) {
+	if len(username) > MAX_USERNAME_LENGTH {
+		return "", fmt.Errorf("username longer than %v characters", MAX_USERNAME_LENGTH)
+	}
+	if !utf8.ValidString(username) {
+		return "", errors.New("username isn't valid UTF-8")
+	}
+	if strings.ContainsFunc(username, unicode.IsControl) {
+		return "", errors.New("username has control characters in it")
+	}
+	if generatedUsername.MatchString(username) {
+		return "", fmt.Errorf("%q is kept for players who don't pick a name", username)
+	}
+
+	return username, nil
+}
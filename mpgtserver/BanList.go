@@ -0,0 +1,452 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// One ban, on either a username or a range of addresses.  A single address is stored as a range
+// holding just that address.
+type Ban struct {
+	Username string `json:",omitempty"`
+	Network  string `json:",omitempty"`
+	Reason   string
+	Created  time.Time
+
+	// When the ban runs out.  Zero for never.
+	Expires time.Time
+
+	// The parsed form of Network
+	ipNet *net.IPNet
+}
+
+// Whether the ban has run out by the given time
+func (b *Ban) Expired(now time.Time) bool {
+	return !b.Expires.IsZero() && !now.Before(b.Expires)
+}
+
+// What the ban is on, the username or the range
+func (b *Ban) Target() string {
+	if b.Username != "" {
+		return b.Username
+	}
+	return b.Network
+}
+
+// How the ban list is laid out on disk
+type banFile struct {
+	Bans []*Ban
+
+	// Ranges which are let in even if a ban covers them, so a ban on a whole network can leave
+	// some of it open
+	Allow []string
+}
+
+// Thread safe record of who isn't allowed on the server, by username and by address range.  If it
+// has a path, every change is written straight to that file (as JSON), so bans last across
+// restarts and can be edited with the "bans" tool while the server is running - see Reload.
+type BanList struct {
+	lock  *sync.RWMutex
+	path  string
+	bans  []*Ban
+	allow []*net.IPNet
+
+	// The file as it was when we last read or wrote it, to tell when someone else has changed it
+	fileInfo os.FileInfo
+}
+
+// Ban a username for the given duration (0 for forever)
+func (bl *BanList) BanUsername(username, reason string, duration time.Duration) error {
+	if username == "" {
+		return errors.New("no username to ban")
+	}
+
+	return bl.add(&Ban{Username: username, Reason: reason}, duration)
+}
+
+// Ban an address or a CIDR range of addresses for the given duration (0 for forever)
+func (bl *BanList) BanNetwork(network, reason string, duration time.Duration) error {
+	ipNet, err := parseNetwork(network)
+	if err != nil {
+		return err
+	}
+
+	return bl.add(&Ban{Network: ipNet.String(), Reason: reason, ipNet: ipNet}, duration)
+}
+
+// Let an address or range in even if a ban covers it
+func (bl *BanList) Allow(network string) error {
+	ipNet, err := parseNetwork(network)
+	if err != nil {
+		return err
+	}
+
+	return bl.change(func() bool {
+		for _, allowed := range bl.allow {
+			if allowed.String() == ipNet.String() {
+				return false
+			}
+		}
+		bl.allow = append(bl.allow, ipNet)
+		return true
+	})
+}
+
+// Take an address or range off the allow list.  Returns false if it wasn't on it.
+func (bl *BanList) Disallow(network string) (bool, error) {
+	ipNet, err := parseNetwork(network)
+	if err != nil {
+		return false, err
+	}
+
+	removed := false
+	err = bl.change(func() bool {
+		for i, allowed := range bl.allow {
+			if allowed.String() == ipNet.String() {
+				bl.allow = append(bl.allow[:i], bl.allow[i+1:]...)
+				removed = true
+				break
+			}
+		}
+		return removed
+	})
+	return removed, err
+}
+
+// Lift every ban on a username or address range.  Returns how many were lifted.
+func (bl *BanList) Remove(target string) (int, error) {
+	if ipNet, err := parseNetwork(target); err == nil {
+		target = ipNet.String()
+	}
+
+	removed := 0
+	err := bl.change(func() bool {
+		kept := make([]*Ban, 0, len(bl.bans))
+		for _, ban := range bl.bans {
+			if ban.Target() != target {
+				kept = append(kept, ban)
+			}
+		}
+
+		removed = len(bl.bans) - len(kept)
+		bl.bans = kept
+		return removed > 0
+	})
+	return removed, err
+}
+
+// Check an IP address.  Returns the reason and true if a ban covers it and no allow rule does.
+func (bl *BanList) IsIPBanned(ip string) (string, bool) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", false
+	}
+
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+	for _, allowed := range bl.allow {
+		if allowed.Contains(addr) {
+			return "", false
+		}
+	}
+
+	now := time.Now()
+	for _, ban := range bl.bans {
+		if ban.ipNet != nil && !ban.Expired(now) && ban.ipNet.Contains(addr) {
+			return ban.Reason, true
+		}
+	}
+	return "", false
+}
+
+// Check a username.  Returns the reason and true if it's banned.
+func (bl *BanList) IsUsernameBanned(username string) (string, bool) {
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+
+	now := time.Now()
+	for _, ban := range bl.bans {
+		if ban.Username != "" && !ban.Expired(now) && strings.EqualFold(ban.Username, username) {
+			return ban.Reason, true
+		}
+	}
+	return "", false
+}
+
+// Get the bans which haven't run out, usernames first, and the allow list
+func (bl *BanList) List() ([]Ban, []string) {
+	bl.lock.RLock()
+	defer bl.lock.RUnlock()
+
+	now := time.Now()
+	bans := make([]Ban, 0, len(bl.bans))
+	for _, ban := range bl.bans {
+		if !ban.Expired(now) {
+			bans = append(bans, *ban)
+		}
+	}
+	sort.SliceStable(bans, func(i, j int) bool { return bans[i].Username != "" && bans[j].Username == "" })
+
+	allow := make([]string, 0, len(bl.allow))
+	for _, allowed := range bl.allow {
+		allow = append(allow, allowed.String())
+	}
+	return bans, allow
+}
+
+// Write out the bans and the allow list, for the admin console and the bans tool
+func (bl *BanList) Dump(w io.Writer) {
+	bans, allow := bl.List()
+	fmt.Fprintf(w, "bans: %v\n", len(bans))
+	for _, ban := range bans {
+		expires := "never"
+		if !ban.Expires.IsZero() {
+			expires = ban.Expires.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "  %-24v expires=%-25v reason=%q\n", ban.Target(), expires, ban.Reason)
+	}
+
+	fmt.Fprintf(w, "allowed: %v\n", len(allow))
+	for _, network := range allow {
+		fmt.Fprintf(w, "  %v\n", network)
+	}
+}
+
+// Read the file again if it has changed since we last read or wrote it.  Returns true if it was
+// reloaded.
+func (bl *BanList) Reload() (bool, error) {
+	if bl.path == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(bl.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+	if !bl.changedOnDisk(info) {
+		return false, nil
+	}
+
+	// A broken file only gets complained about once, not every time we look at it
+	bl.fileInfo = info
+	return true, bl.load()
+}
+
+// Add a ban, after dropping the ones which have run out
+func (bl *BanList) add(ban *Ban, duration time.Duration) error {
+	if duration < 0 {
+		return errors.New("a ban can't last for a negative time")
+	}
+
+	ban.Created = time.Now()
+	if duration > 0 {
+		ban.Expires = ban.Created.Add(duration)
+	}
+
+	return bl.change(func() bool {
+		kept := make([]*Ban, 0, len(bl.bans)+1)
+		for _, existing := range bl.bans {
+			if !existing.Expired(ban.Created) {
+				kept = append(kept, existing)
+			}
+		}
+		bl.bans = append(kept, ban)
+		return true
+	})
+}
+
+// Make a change to the list and write it out if the change says it did anything.  Anything written
+// to the file since we last read it (like a ban from the bans tool, which the server only picks up
+// when it next polls) is read in first, so the change is made on top of it instead of writing over
+// it.  If the file can't be read, nothing is changed - better to fail the change than to replace a
+// file someone is halfway through fixing by hand.
+func (bl *BanList) change(apply func() bool) error {
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+
+	if bl.path != "" {
+		info, err := os.Stat(bl.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil && bl.changedOnDisk(info) {
+			if err := bl.load(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !apply() {
+		return nil
+	}
+	return bl.save()
+}
+
+// Whether the file is different to the one we last read or wrote.  Saving swaps a whole new file
+// in, so it's a different file even when two saves land close enough together to get the same
+// modification time.  Must be called with the lock held.
+func (bl *BanList) changedOnDisk(info os.FileInfo) bool {
+	return bl.fileInfo == nil || !os.SameFile(bl.fileInfo, info) ||
+		!info.ModTime().Equal(bl.fileInfo.ModTime()) || info.Size() != bl.fileInfo.Size()
+}
+
+// Read the file into the list.  Must be called with the lock held.
+func (bl *BanList) load() error {
+	raw, err := os.ReadFile(bl.path)
+	if err != nil {
+		return err
+	}
+
+	var file banFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("%v: %v", bl.path, err)
+	}
+
+	for _, ban := range file.Bans {
+		if ban.Network != "" {
+			ban.ipNet, err = parseNetwork(ban.Network)
+			if err != nil {
+				return fmt.Errorf("%v: %v", bl.path, err)
+			}
+		}
+	}
+
+	allow := make([]*net.IPNet, 0, len(file.Allow))
+	for _, network := range file.Allow {
+		ipNet, err := parseNetwork(network)
+		if err != nil {
+			return fmt.Errorf("%v: %v", bl.path, err)
+		}
+		allow = append(allow, ipNet)
+	}
+
+	bl.bans, bl.allow = file.Bans, allow
+	if info, err := os.Stat(bl.path); err == nil {
+		bl.fileInfo = info
+	}
+	return nil
+}
+
+// Write the list out to the file, if it has one.  The file is replaced in one go, so neither a
+// crash nor the server reloading it halfway through can see half a list.  Must be called with the
+// lock held.
+func (bl *BanList) save() error {
+	if bl.path == "" {
+		return nil
+	}
+
+	file := banFile{Bans: bl.bans, Allow: make([]string, 0, len(bl.allow))}
+	for _, allowed := range bl.allow {
+		file.Allow = append(file.Allow, allowed.String())
+	}
+
+	raw, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(bl.path), ".bans-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(raw, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), bl.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if info, err := os.Stat(bl.path); err == nil {
+		bl.fileInfo = info
+	}
+	return nil
+}
+
+// Parse how long a ban lasts.  Takes Go durations (90m, 12h) plus whole days (7d), and "forever"
+// or 0 for a ban which never runs out.
+func parseBanDuration(s string) (time.Duration, error) {
+	if s == "forever" || s == "0" {
+		return 0, nil
+	}
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+
+	return 0, fmt.Errorf("%q isn't a ban length, try something like 30m, 12h, 7d or forever", s)
+}
+
+// Parse an address or CIDR range.  A bare address becomes a range holding only itself.
+func parseNetwork(network string) (*net.IPNet, error) {
+	if !strings.Contains(network, "/") {
+		ip := net.ParseIP(network)
+		if ip == nil {
+			return nil, fmt.Errorf("%q isn't an address or CIDR range", network)
+		}
+		if ip.To4() != nil {
+			network += "/32"
+		} else {
+			network += "/128"
+		}
+	}
+
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		return nil, fmt.Errorf("%q isn't an address or CIDR range", network)
+	}
+	return ipNet, nil
+}
+
+// Load the ban list kept in the file at path.  A file which doesn't exist yet is an empty list, and
+// gets created with the first ban.  An empty path gives a list which is only kept in memory.
+func LoadBanList(path string) (*BanList, error) {
+	bl := CreateBanList()
+	bl.path = path
+	if path == "" {
+		return bl, nil
+	}
+
+	bl.lock.Lock()
+	defer bl.lock.Unlock()
+	err := bl.load()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return bl, nil
+}
+
+// Constructor to init an empty ban list, only kept in memory
+func CreateBanList() *BanList {
+	return &BanList{
+		lock:  new(sync.RWMutex),
+		bans:  make([]*Ban, 0),
+		allow: make([]*net.IPNet, 0),
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBanListIPs(t *testing.T) {
+	bl := CreateBanList()
+	for _, network := range []string{"10.0.0.0/8", "192.168.1.7", "2001:db8::/32"} {
+		if err := bl.BanNetwork(network, "banned "+network, 0); err != nil {
+			t.Fatalf("banning %v: %v", network, err)
+		}
+	}
+	if err := bl.Allow("10.1.2.0/24"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip     string
+		banned bool
+		reason string
+	}{
+		{"10.0.0.1", true, "banned 10.0.0.0/8"},
+		{"10.255.255.255", true, "banned 10.0.0.0/8"},
+		{"10.1.2.3", false, ""},
+		{"10.1.3.3", true, "banned 10.0.0.0/8"},
+		{"11.0.0.1", false, ""},
+		{"192.168.1.7", true, "banned 192.168.1.7"},
+		{"192.168.1.8", false, ""},
+		{"2001:db8::1", true, "banned 2001:db8::/32"},
+		{"2001:db9::1", false, ""},
+		{"not an address", false, ""},
+	}
+
+	for _, test := range tests {
+		reason, banned := bl.IsIPBanned(test.ip)
+		if banned != test.banned || reason != test.reason {
+			t.Errorf("IsIPBanned(%q) = %q, %v, wanted %q, %v", test.ip, reason, banned, test.reason, test.banned)
+		}
+	}
+}
+
+func TestBanListUsernames(t *testing.T) {
+	bl := CreateBanList()
+	if err := bl.BanUsername("Mallory", "griefing", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.BanUsername("", "nobody", 0); err == nil {
+		t.Errorf("banned an empty username")
+	}
+
+	tests := []struct {
+		username string
+		banned   bool
+	}{
+		{"Mallory", true},
+		{"mallory", true},
+		{"MALLORY", true},
+		{"Mallory2", false},
+		{"alice", false},
+	}
+
+	for _, test := range tests {
+		if _, banned := bl.IsUsernameBanned(test.username); banned != test.banned {
+			t.Errorf("IsUsernameBanned(%q) = %v, wanted %v", test.username, banned, test.banned)
+		}
+	}
+}
+
+func TestBanExpiry(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		expires time.Time
+		expired bool
+	}{
+		{"forever", time.Time{}, false},
+		{"later", now.Add(time.Minute), false},
+		{"right now", now, true},
+		{"earlier", now.Add(-time.Minute), true},
+	}
+
+	for _, test := range tests {
+		ban := &Ban{Username: "someone", Expires: test.expires}
+		if got := ban.Expired(now); got != test.expired {
+			t.Errorf("%v: Expired = %v, wanted %v", test.name, got, test.expired)
+		}
+	}
+}
+
+func TestBanListExpiredBansDontCount(t *testing.T) {
+	bl := CreateBanList()
+	if err := bl.BanUsername("brief", "cool off", time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.BanNetwork("10.0.0.1", "cool off", time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.BanUsername("long", "cool off", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.BanUsername("negative", "", -time.Hour); err == nil {
+		t.Errorf("took a ban with a negative duration")
+	}
+	time.Sleep(time.Millisecond)
+
+	if _, banned := bl.IsUsernameBanned("brief"); banned {
+		t.Errorf("expired username ban still counts")
+	}
+	if _, banned := bl.IsIPBanned("10.0.0.1"); banned {
+		t.Errorf("expired address ban still counts")
+	}
+	if _, banned := bl.IsUsernameBanned("long"); !banned {
+		t.Errorf("ban which hasn't run out doesn't count")
+	}
+	if bans, _ := bl.List(); len(bans) != 1 {
+		t.Errorf("List gave %v bans, wanted only the one which hasn't run out", len(bans))
+	}
+}
+
+func TestBanListAllowAndRemove(t *testing.T) {
+	bl := CreateBanList()
+	if err := bl.BanNetwork("172.16.0.0/12", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.Allow("172.16.5.5"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, banned := bl.IsIPBanned("172.16.5.5"); banned {
+		t.Errorf("allowed address is banned")
+	}
+
+	if removed, err := bl.Disallow("172.16.5.5/32"); !removed || err != nil {
+		t.Fatalf("Disallow = %v, %v", removed, err)
+	}
+	if removed, _ := bl.Disallow("172.16.5.5"); removed {
+		t.Errorf("Disallow removed an address which wasn't allowed")
+	}
+	if _, banned := bl.IsIPBanned("172.16.5.5"); !banned {
+		t.Errorf("address still let in after it was taken off the allow list")
+	}
+
+	if removed, err := bl.Remove("172.16.0.0/12"); removed != 1 || err != nil {
+		t.Fatalf("Remove = %v, %v", removed, err)
+	}
+	if _, banned := bl.IsIPBanned("172.16.5.5"); banned {
+		t.Errorf("address still banned after the ban was lifted")
+	}
+}
+
+func TestBanListFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+	server, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.BanUsername("mallory", "griefing", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Something else (like the bans tool) changes the file before the server notices
+	tool, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tool.BanNetwork("10.0.0.0/8", "", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A change on the server's side mustn't throw the tool's change away
+	if err := server.Allow("10.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, banned := reloaded.IsUsernameBanned("mallory"); !banned {
+		t.Errorf("username ban lost")
+	}
+	if _, banned := reloaded.IsIPBanned("10.0.0.1"); !banned {
+		t.Errorf("ban made by the tool lost")
+	}
+	if _, banned := reloaded.IsIPBanned("10.1.1.1"); banned {
+		t.Errorf("allow rule lost")
+	}
+}
+
+func TestParseBanDuration(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Duration
+		ok   bool
+	}{
+		{"forever", 0, true},
+		{"0", 0, true},
+		{"90m", 90 * time.Minute, true},
+		{"12h", 12 * time.Hour, true},
+		{"7d", 7 * 24 * time.Hour, true},
+		{"0d", 0, false},
+		{"-5m", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseBanDuration(test.text)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseBanDuration(%q) = %v, %v, wanted %v (ok=%v)", test.text, got, err, test.want, test.ok)
+		}
+	}
+}
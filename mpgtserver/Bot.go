@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/pathfinding"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+const (
+	// How close a bot has to get to where it's going before it counts as there, in pixels.  Bots
+	// only move in eight directions, so without some slack they'd zig-zag around the spot forever.
+	BOT_ARRIVE_DISTANCE float32 = 8
+
+	// How often a bot finds a new path even though where it's going hasn't changed, in case it's
+	// been knocked off its path by a respawn or a teleport
+	BOT_REPLAN_INTERVAL time.Duration = time.Second
+)
+
+// What makes an entity a bot rather than a player.  A bot lives in its room's EntityHolder like any
+// other entity, but has no Client - instead, every tick, its behavior decides which actions it's
+// doing and the room moves it the same way it moves players.  Not thread safe - only the room's
+// loop uses it.
+type Bot struct {
+	behavior BotBehavior
+
+	// Sequence number for the bot's next input, so its inputs look like a player's in recordings
+	seq int64
+
+	// When the bot last moved, to work out its frame delta.  Zero until it first moves.
+	lastMove time.Time
+
+	// The waypoints left on the path the bot is following, and what it was planned for: the cell
+	// it leads to, on which map's grid, and when.  A new path is found when any of those are out
+	// of date.
+	path      []shared.FloatVector
+	pathGoal  pathfinding.Cell
+	pathGrid  *pathfinding.Grid
+	plannedAt time.Time
+}
+
+// The actions to head for a spot on the map, going around whatever's in the way.  The path there
+// is found once and then followed waypoint by waypoint.  If there's no way round, the bot heads
+// straight for the spot.
+func (b *Bot) SteerTo(room *Room, ent *PlayerEntity, target shared.FloatVector, now time.Time) shared.InputState {
+	grid := room.spawner.gameMap.NavGrid()
+	goal := grid.CellOf(target)
+	if b.pathGrid != grid || b.pathGoal != goal || now.Sub(b.plannedAt) >= BOT_REPLAN_INTERVAL {
+		// Without a path there's nothing left to follow, and the straight line below takes over
+		b.path, _ = room.paths.FindPath(grid, ent.position, target)
+		b.pathGoal, b.pathGrid, b.plannedAt = goal, grid, now
+	}
+
+	for len(b.path) > 0 {
+		if input := inputToward(ent.position, b.path[0]); input.HasInput() {
+			return input
+		}
+		b.path = b.path[1:]
+	}
+	return inputToward(ent.position, target)
+}
+
+// The waypoints left on the bot's path, empty if it isn't following one
+func (b *Bot) Path() []shared.FloatVector {
+	return b.path
+}
+
+// Forget the bot's path, when it's doing something which doesn't need one
+func (b *Bot) ClearPath() {
+	b.path, b.pathGrid = nil, nil
+}
+
+// Work out the bot's move for this tick and build the input message a player would have sent for
+// it, so it can go through the same code path.  The bot is kept inside the map.
+func (b *Bot) NextInput(room *Room, ent *PlayerEntity, now time.Time) *protocol.SendInputMessage {
+	dt := room.TickInterval()
+	if !b.lastMove.IsZero() {
+		dt = now.Sub(b.lastMove)
+	}
+	b.lastMove = now
+
+	input := b.behavior.Decide(room, ent, now)
+	keepInside(&input, ent.position, room.spawner.gameMap)
+
+	b.seq++
+	return protocol.CreateSendInputMessage(&input, b.seq, dt, ent.entityId)
+}
+
+// Stop any movement which would take a player at pos off the edge of the map
+func keepInside(input *shared.InputState, pos shared.FloatVector, gm *GameMap) {
+	if pos.X <= 0 {
+		input.Set(shared.ACTION_LEFT, false)
+	}
+	if pos.X >= gm.Width-shared.ENTITY_SIZE {
+		input.Set(shared.ACTION_RIGHT, false)
+	}
+	if pos.Y <= 0 {
+		input.Set(shared.ACTION_UP, false)
+	}
+	if pos.Y >= gm.Height-shared.ENTITY_SIZE {
+		input.Set(shared.ACTION_DOWN, false)
+	}
+}
+
+// The actions to move from one spot towards another.  There's no moving along an axis once the
+// spots are within BOT_ARRIVE_DISTANCE of each other on it.
+func inputToward(from, to shared.FloatVector) shared.InputState {
+	var input shared.InputState
+	switch dx := to.X - from.X; {
+	case dx > BOT_ARRIVE_DISTANCE:
+		input.Set(shared.ACTION_RIGHT, true)
+	case dx < -BOT_ARRIVE_DISTANCE:
+		input.Set(shared.ACTION_LEFT, true)
+	}
+	switch dy := to.Y - from.Y; {
+	case dy > BOT_ARRIVE_DISTANCE:
+		input.Set(shared.ACTION_DOWN, true)
+	case dy < -BOT_ARRIVE_DISTANCE:
+		input.Set(shared.ACTION_UP, true)
+	}
+	return input
+}
+
+// The actions to move from one spot directly away from another
+func inputAway(from, threat shared.FloatVector) shared.InputState {
+	away := shared.FloatVector{X: 2*from.X - threat.X, Y: 2*from.Y - threat.Y}
+	return inputToward(from, away)
+}
+
+// The closest entity to the given one which isn't a bot, and how far away it is.  Returns nil if
+// there are no players in the room.
+func nearestPlayer(room *Room, ent *PlayerEntity) (*PlayerEntity, float64) {
+	var nearest *PlayerEntity
+	distance := math.Inf(1)
+	for _, other := range room.entities.GetEntities() {
+		if other == ent || other.bot != nil || !other.spawned {
+			continue
+		}
+
+		d := math.Hypot(float64(other.position.X-ent.position.X), float64(other.position.Y-ent.position.Y))
+		if d < distance {
+			nearest, distance = other, d
+		}
+	}
+	return nearest, distance
+}
+
+// Create a bot entity driven by the behavior.  It's named after the behavior, and spawns like a
+// player once it's been added to a room.
+func CreateBotEntity(id int64, behavior BotBehavior) *PlayerEntity {
+	ent := CreatePlayerEntity(id, fmt.Sprintf("%v-bot-%v", behavior.Name(), id))
+	ent.bot = &Bot{behavior: behavior}
+	return ent
+}
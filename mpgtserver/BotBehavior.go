@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+const (
+	// Shortest and longest a wandering bot keeps going in one direction
+	WANDER_MIN_TIME time.Duration = time.Second
+	WANDER_MAX_TIME time.Duration = 3 * time.Second
+
+	// How close a player has to get before a fleeing bot runs, in pixels
+	FLEE_RADIUS float64 = 300
+)
+
+// Decides what a bot does.  Every tick the bot's room asks its behavior which actions the bot is
+// doing, exactly like the input a player sends, and moves the bot accordingly.  Each bot has its
+// own behavior, so a behavior can keep whatever state it likes.
+//
+// Decide is called from the room's loop, so a behavior can look at the room's entities.
+type BotBehavior interface {
+	// Name of the behavior, as it's given to -bots and the addbot command
+	Name() string
+
+	// Which actions the bot does this tick
+	Decide(room *Room, bot *PlayerEntity, now time.Time) shared.InputState
+}
+
+// Every so often, picks a random direction, or stands still for a bit
+type wanderBehavior struct {
+	input shared.InputState
+	until time.Time
+}
+
+// BotBehavior interface
+func (b *wanderBehavior) Name() string {
+	return "wander"
+}
+
+// BotBehavior interface
+func (b *wanderBehavior) Decide(room *Room, bot *PlayerEntity, now time.Time) shared.InputState {
+	if now.Before(b.until) {
+		return b.input
+	}
+
+	b.input = shared.InputState{}
+	switch rand.Intn(3) {
+	case 0:
+		b.input.Set(shared.ACTION_LEFT, true)
+	case 1:
+		b.input.Set(shared.ACTION_RIGHT, true)
+	}
+	switch rand.Intn(3) {
+	case 0:
+		b.input.Set(shared.ACTION_UP, true)
+	case 1:
+		b.input.Set(shared.ACTION_DOWN, true)
+	}
+
+	b.until = now.Add(WANDER_MIN_TIME + time.Duration(rand.Int63n(int64(WANDER_MAX_TIME-WANDER_MIN_TIME))))
+	return b.input
+}
+
+// Heads for the nearest player, around anything in the way, and stands still if there isn't one
+type chaseBehavior struct{}
+
+// BotBehavior interface
+func (b *chaseBehavior) Name() string {
+	return "chase"
+}
+
+// BotBehavior interface
+func (b *chaseBehavior) Decide(room *Room, bot *PlayerEntity, now time.Time) shared.InputState {
+	target, _ := nearestPlayer(room, bot)
+	if target == nil {
+		bot.bot.ClearPath()
+		return shared.InputState{}
+	}
+	return bot.bot.SteerTo(room, bot, target.position, now)
+}
+
+// Runs directly away from the nearest player once they get too close, and wanders otherwise
+type fleeBehavior struct {
+	wander wanderBehavior
+}
+
+// BotBehavior interface
+func (b *fleeBehavior) Name() string {
+	return "flee"
+}
+
+// BotBehavior interface
+func (b *fleeBehavior) Decide(room *Room, bot *PlayerEntity, now time.Time) shared.InputState {
+	threat, distance := nearestPlayer(room, bot)
+	if threat == nil || distance > FLEE_RADIUS {
+		return b.wander.Decide(room, bot, now)
+	}
+
+	// Once the threat has gone the bot should pick a new direction rather than carry on with
+	// whatever it was doing before
+	b.wander.until = time.Time{}
+	return inputAway(bot.position, threat.position)
+}
+
+// Walks from one waypoint to the next, going back to the first after the last, and around anything
+// in the way between them
+type patrolBehavior struct {
+	waypoints []shared.FloatVector
+	next      int
+}
+
+// BotBehavior interface
+func (b *patrolBehavior) Name() string {
+	return "patrol"
+}
+
+// BotBehavior interface
+func (b *patrolBehavior) Decide(room *Room, bot *PlayerEntity, now time.Time) shared.InputState {
+	if toward := inputToward(bot.position, b.waypoints[b.next]); !toward.HasInput() {
+		b.next = (b.next + 1) % len(b.waypoints)
+	}
+	return bot.bot.SteerTo(room, bot, b.waypoints[b.next], now)
+}
+
+// Every bot behavior there is, by name.  The arguments are whatever came after the behavior's name
+// on the addbot command, which only patrol uses.
+var botBehaviors = map[string]func(args []string, gm *GameMap) (BotBehavior, error){
+	"wander": func(args []string, gm *GameMap) (BotBehavior, error) { return new(wanderBehavior), nil },
+	"chase":  func(args []string, gm *GameMap) (BotBehavior, error) { return new(chaseBehavior), nil },
+	"flee":   func(args []string, gm *GameMap) (BotBehavior, error) { return new(fleeBehavior), nil },
+	"patrol": createPatrolBehavior,
+}
+
+// Set up a patrol.  The waypoints are given as x,y arguments.  Without any, the bot patrols one of
+// the map's routes, or around the edge of the map if it doesn't have any.
+func createPatrolBehavior(args []string, gm *GameMap) (BotBehavior, error) {
+	waypoints := make([]shared.FloatVector, 0, len(args))
+	for _, arg := range args {
+		x, y, ok := strings.Cut(arg, ",")
+		fx, errX := strconv.ParseFloat(x, 32)
+		fy, errY := strconv.ParseFloat(y, 32)
+		if !ok || errX != nil || errY != nil {
+			return nil, fmt.Errorf("waypoint %q isn't x,y", arg)
+		}
+		waypoints = append(waypoints, shared.FloatVector{X: float32(fx), Y: float32(fy)})
+	}
+
+	switch {
+	case len(waypoints) == 1:
+		return nil, errors.New("a patrol needs at least two waypoints")
+	case len(waypoints) == 0 && len(gm.Patrols) > 0:
+		waypoints = gm.Patrols[rand.Intn(len(gm.Patrols))]
+	case len(waypoints) == 0:
+		maxX, maxY := gm.Width-shared.ENTITY_SIZE, gm.Height-shared.ENTITY_SIZE
+		waypoints = []shared.FloatVector{{X: 0, Y: 0}, {X: maxX, Y: 0}, {X: maxX, Y: maxY}, {X: 0, Y: maxY}}
+	}
+
+	return &patrolBehavior{waypoints: waypoints}, nil
+}
+
+// Split a comma separated list of bot behaviors, like -bots takes, into their names
+func botList(list string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Check the name of a bot behavior from the command line or the admin console
+func checkBotBehavior(name string) error {
+	if _, ok := botBehaviors[name]; !ok {
+		names := make([]string, 0, len(botBehaviors))
+		for name := range botBehaviors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown bot behavior %q, try %v", name, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Create a bot behavior by name, for a bot on the given map
+func CreateBotBehavior(name string, args []string, gm *GameMap) (BotBehavior, error) {
+	if err := checkBotBehavior(name); err != nil {
+		return nil, err
+	}
+	return botBehaviors[name](args, gm)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Thread safe filter every line of chat goes through.  Words on the filter list get starred out,
+// and muted players can't say anything at all until their mute runs out.  Mutes go by username so
+// reconnecting doesn't get around them.
+type ChatFilter struct {
+	lock  *sync.RWMutex
+	words map[string]bool
+	mutes map[string]time.Time
+}
+
+// Star out every filtered word in the text.  Words are matched whole and without regard to case,
+// so "Class" doesn't get caught by a filter on "ass".
+func (cf *ChatFilter) Clean(text string) string {
+	cf.lock.RLock()
+	defer cf.lock.RUnlock()
+	if len(cf.words) == 0 {
+		return text
+	}
+
+	runes := []rune(text)
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+
+		if start >= 0 && cf.words[strings.ToLower(string(runes[start:i]))] {
+			for j := start; j < i; j++ {
+				runes[j] = '*'
+			}
+		}
+		start = -1
+	}
+
+	return string(runes)
+}
+
+// Stop a player from chatting until the given time
+func (cf *ChatFilter) Mute(username string, until time.Time) {
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+	cf.mutes[username] = until
+}
+
+// Let a muted player chat again
+func (cf *ChatFilter) Unmute(username string) {
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+	delete(cf.mutes, username)
+}
+
+// How much longer a player is muted for.  Zero if they aren't.
+func (cf *ChatFilter) MutedFor(username string, now time.Time) time.Duration {
+	cf.lock.RLock()
+	until, ok := cf.mutes[username]
+	cf.lock.RUnlock()
+	if !ok {
+		return 0
+	}
+
+	if !now.Before(until) {
+		cf.Unmute(username)
+		return 0
+	}
+
+	return until.Sub(now)
+}
+
+// Strip anything that isn't printable out of a line of chat, along with the whitespace around it
+func sanitizeChat(text string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text))
+}
+
+// Read the filter list at the given path, one word per line.  Blank lines and lines starting with
+// # are ignored.  An empty path gives a filter which lets everything through.
+func LoadChatFilter(path string) (*ChatFilter, error) {
+	filter := CreateChatFilter(nil)
+	if path == "" {
+		return filter, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		filter.words[strings.ToLower(line)] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// Create a filter for the given words, with nobody muted
+func CreateChatFilter(words []string) *ChatFilter {
+	filter := &ChatFilter{
+		lock:  new(sync.RWMutex),
+		words: make(map[string]bool),
+		mutes: make(map[string]time.Time),
+	}
+
+	for _, word := range words {
+		filter.words[strings.ToLower(word)] = true
+	}
+
+	return filter
+}
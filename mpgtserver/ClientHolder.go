@@ -1,9 +1,20 @@
 package main
 
 import (
+	"errors"
+	"strings"
 	"sync"
 )
 
+var (
+	// Returned when somebody joins under a name which someone else on the server already has.
+	// Names are compared ignoring case, the same way whispers find players.
+	ErrUsernameTaken = errors.New("that username is already taken")
+
+	// Returned when the server already has as many spectators as it takes
+	ErrTooManySpectators = errors.New("too many spectators")
+)
+
 // Basically a wrapper around a map of Client structs to make it thread safe.
 type ClientHolder struct {
 	lock    *sync.RWMutex
@@ -17,11 +28,80 @@ func (ch *ClientHolder) AddClient(client *Client) {
 	ch.clients[client.clientId] = client
 }
 
-// Remove a client from the map
+// Add a new player to the map, unless somebody else already goes by the same username.  The check
+// and the add happen under the same lock, so two players joining under one name at once can't both
+// get in.  Returns ErrUsernameTaken if the name is in use.
+func (ch *ClientHolder) AddPlayer(client *Client) error {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+
+	if ch.usernameTaken(client) {
+		return ErrUsernameTaken
+	}
+
+	ch.clients[client.clientId] = client
+	return nil
+}
+
+// Add a spectator to the map, unless there are already max of them or somebody else goes by the
+// same username.  The checks and the add happen under the same lock so a crowd of spectators
+// joining at once can't sneak past the limit.
+func (ch *ClientHolder) AddSpectator(client *Client, max int) error {
+	ch.lock.Lock()
+	defer ch.lock.Unlock()
+
+	if ch.usernameTaken(client) {
+		return ErrUsernameTaken
+	}
+
+	count := 0
+	for _, c := range ch.clients {
+		if c.spectator {
+			count++
+		}
+	}
+	if count >= max {
+		return ErrTooManySpectators
+	}
+
+	ch.clients[client.clientId] = client
+	return nil
+}
+
+// Whether a client other than the given one already has its username, ignoring case.  The lock
+// has to be held.
+func (ch *ClientHolder) usernameTaken(client *Client) bool {
+	for _, c := range ch.clients {
+		if c.clientId != client.clientId && strings.EqualFold(c.username, client.username) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count the connected players and spectators
+func (ch *ClientHolder) Count() (players, spectators int) {
+	ch.lock.RLock()
+	defer ch.lock.RUnlock()
+	for _, c := range ch.clients {
+		if c.spectator {
+			spectators++
+		} else {
+			players++
+		}
+	}
+
+	return players, spectators
+}
+
+// Remove a client from the map.  If a reconnecting client has already replaced this one under the
+// same ID, the newer client is left alone.
 func (ch *ClientHolder) RemoveClient(client *Client) {
 	ch.lock.Lock()
 	defer ch.lock.Unlock()
-	delete(ch.clients, client.clientId)
+	if ch.clients[client.clientId] == client {
+		delete(ch.clients, client.clientId)
+	}
 }
 
 // Gets a specific client, by ID, out of the map.  Returns nil if client is not available.
@@ -39,6 +119,20 @@ func (ch *ClientHolder) GetClient(id int64) *Client {
 	}
 }
 
+// Find a connected client by username, ignoring case.  Returns nil if nobody by that name is on.
+// There's never more than one, since nobody gets in under a name which is already taken.
+func (ch *ClientHolder) GetClientByUsername(username string) *Client {
+	ch.lock.RLock()
+	defer ch.lock.RUnlock()
+	for _, c := range ch.clients {
+		if strings.EqualFold(c.username, username) {
+			return c
+		}
+	}
+
+	return nil
+}
+
 // Get all of the clients as a slice.
 func (ch *ClientHolder) GetClients() []*Client {
 	ch.lock.RLock()
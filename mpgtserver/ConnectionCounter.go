@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sync"
+)
+
+// Thread safe count of how many connections each IP address currently has open
+type ConnectionCounter struct {
+	lock   *sync.Mutex
+	counts map[string]int
+}
+
+// Count a new connection from an IP, unless it already has max connections open in which case
+// nothing is counted and false is returned.  A max of zero or less means no limit.
+func (cc *ConnectionCounter) Acquire(ip string, max int) bool {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	if max > 0 && cc.counts[ip] >= max {
+		return false
+	}
+
+	cc.counts[ip]++
+	return true
+}
+
+// Stop counting a connection from an IP once it has closed
+func (cc *ConnectionCounter) Release(ip string) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	cc.counts[ip]--
+	if cc.counts[ip] <= 0 {
+		delete(cc.counts, ip)
+	}
+}
+
+// Constructor to init the counter
+func CreateConnectionCounter() *ConnectionCounter {
+	return &ConnectionCounter{
+		lock:   new(sync.Mutex),
+		counts: make(map[string]int),
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestConnectionCounter(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      int
+		attempts int
+		accepted int
+	}{
+		{"under the limit", 3, 2, 2},
+		{"over the limit", 3, 5, 3},
+		{"zero is no limit", 0, 50, 50},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc := CreateConnectionCounter()
+			accepted := 0
+			for i := 0; i < test.attempts; i++ {
+				if cc.Acquire("10.0.0.1", test.max) {
+					accepted++
+				}
+			}
+			if accepted != test.accepted {
+				t.Errorf("%v of %v connections accepted, wanted %v", accepted, test.attempts, test.accepted)
+			}
+
+			// Another address has its own count, and a closed connection makes room again
+			if !cc.Acquire("10.0.0.2", test.max) {
+				t.Errorf("second address refused")
+			}
+			cc.Release("10.0.0.1")
+			if !cc.Acquire("10.0.0.1", test.max) {
+				t.Errorf("refused after a connection closed")
+			}
+		})
+	}
+}
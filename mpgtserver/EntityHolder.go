@@ -4,16 +4,30 @@ import (
 	"sync"
 )
 
+// Gets told about entities coming and going.  Both calls are made with the holder locked, so
+// nobody else can see the change until the listener has returned.
+type EntityListener interface {
+	// Called just before the entity is put into the world
+	EntityAdded(entity *PlayerEntity)
+
+	// Called just after the entity was taken out of the world
+	EntityRemoved(id int64)
+}
+
 // Basically a wrapper around a map of PlayerEntity structs to make it thread safe.
 type EntityHolder struct {
 	lock     *sync.RWMutex
 	entities map[int64]*PlayerEntity
+	listener EntityListener
 }
 
 // Add a new entity to the map
 func (eh *EntityHolder) AddEntity(entity *PlayerEntity) {
 	eh.lock.Lock()
 	defer eh.lock.Unlock()
+	if eh.listener != nil {
+		eh.listener.EntityAdded(entity)
+	}
 	eh.entities[entity.entityId] = entity
 }
 
@@ -21,7 +35,19 @@ func (eh *EntityHolder) AddEntity(entity *PlayerEntity) {
 func (eh *EntityHolder) RemoveEntity(id int64) {
 	eh.lock.Lock()
 	defer eh.lock.Unlock()
+	_, ok := eh.entities[id]
 	delete(eh.entities, id)
+	if ok && eh.listener != nil {
+		eh.listener.EntityRemoved(id)
+	}
+}
+
+// Set the listener which gets told about entities being added and removed.  Only one listener is
+// supported, setting a new one replaces the old.
+func (eh *EntityHolder) SetListener(listener EntityListener) {
+	eh.lock.Lock()
+	defer eh.lock.Unlock()
+	eh.listener = listener
 }
 
 // Gets a specific entity, by ID, out of the map.  Returns nil if entity is not available.
@@ -51,6 +77,20 @@ func (eh *EntityHolder) GetEntities() []*PlayerEntity {
 	return eSlice
 }
 
+// Call fn with all of the entities, keeping the holder locked until it returns so none come or go
+// in the meantime.  Listeners are called with the holder locked too, so anything they do happens
+// either before fn or after it.  fn mustn't call anything else on the holder.
+func (eh *EntityHolder) View(fn func(entities []*PlayerEntity)) {
+	eh.lock.RLock()
+	defer eh.lock.RUnlock()
+	eSlice := make([]*PlayerEntity, 0, len(eh.entities))
+	for _, entity := range eh.entities {
+		eSlice = append(eSlice, entity)
+	}
+
+	fn(eSlice)
+}
+
 // Constructor to init the holder
 func CreateEntityHolder() *EntityHolder {
 	return &EntityHolder{
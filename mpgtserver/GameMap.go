@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/pathfinding"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+const (
+	// Size of the map used when the server isn't given one, which is the size of the client's
+	// window
+	DEFAULT_MAP_WIDTH  float32 = 1024
+	DEFAULT_MAP_HEIGHT float32 = 768
+
+	// Size of the squares the map is cut into for bots finding their way around, in pixels.  A
+	// quarter of a player, so a bot can get through any gap a player can, give or take.
+	NAV_CELL_SIZE float32 = 16
+)
+
+// Somewhere players can be spawned.  With no width or height it's a single point, otherwise it's a
+// rectangular region and players can be put anywhere inside it.  The coordinates are where the
+// top left corner of the player's square goes, the same as an entity's position.
+type SpawnArea struct {
+	X      float32
+	Y      float32
+	Width  float32 `json:",omitempty"`
+	Height float32 `json:",omitempty"`
+
+	// Only used by the team strategy.  Empty for a spawn anyone can use.
+	Team string `json:",omitempty"`
+}
+
+// Whether the area is a single point rather than a region
+func (sa SpawnArea) IsPoint() bool {
+	return sa.Width == 0 && sa.Height == 0
+}
+
+// Pick a random spot inside the area.  A point always gives itself back.
+func (sa SpawnArea) RandomSpot() shared.FloatVector {
+	return shared.FloatVector{X: sa.X + rand.Float32()*sa.Width, Y: sa.Y + rand.Float32()*sa.Height}
+}
+
+// Somewhere a pickup is always put.  Once it's picked up another of the same kind comes back after
+// a while.  Like a spawn, the coordinates are where the pickup's top left corner goes.
+type PickupPlacement struct {
+	Kind protocol.PickupKind
+	X    float32
+	Y    float32
+
+	// Seconds until the pickup comes back after it's taken, DEFAULT_PICKUP_RESPAWN if left out
+	Respawn float32 `json:",omitempty"`
+}
+
+// How long after being taken the placement's pickup comes back
+func (pp PickupPlacement) RespawnTime() time.Duration {
+	if pp.Respawn <= 0 {
+		return DEFAULT_PICKUP_RESPAWN
+	}
+	return time.Duration(pp.Respawn * float32(time.Second))
+}
+
+// Where the placement's pickup goes
+func (pp PickupPlacement) Position() shared.FloatVector {
+	return shared.FloatVector{X: pp.X, Y: pp.Y}
+}
+
+// The layout of the world, read from a JSON file.  For now that's its size, where players spawn,
+// what's in the way, where pickups go and the routes patrolling bots can take.
+type GameMap struct {
+	Name   string
+	Width  float32
+	Height float32
+	Spawns []SpawnArea
+
+	// Each route is a list of waypoints, positions like an entity's, walked in order and then
+	// back to the start
+	Patrols [][]shared.FloatVector `json:",omitempty"`
+
+	// Walls, rocks and the like.  Bots find their way around them and nobody spawns on them, but
+	// for now they don't stop anybody moving through them - the client would need to know about
+	// them too, to predict its own movement.
+	Obstacles []shared.FloatRect `json:",omitempty"`
+
+	// Pickups which are always on the map.  Others get dropped at random as well if the server
+	// is set up to.  See Pickup.go.  Health pickups can't go on a map yet, since nothing in the
+	// game hurts players.
+	Pickups []PickupPlacement `json:",omitempty"`
+
+	// Where bots can go, worked out from the obstacles when the map is loaded
+	navGrid *pathfinding.Grid
+}
+
+// Whether an entity at the position would be over any of the obstacles
+func (gm *GameMap) Blocked(pos shared.FloatVector) bool {
+	return gm.blockedRect(shared.EntityRect(pos))
+}
+
+// Whether anything covering the rectangle would be over any of the obstacles
+func (gm *GameMap) blockedRect(rect shared.FloatRect) bool {
+	for _, obstacle := range gm.Obstacles {
+		if rect.Intersects(obstacle) {
+			return true
+		}
+	}
+	return false
+}
+
+// The map's navigation grid, for bots to find paths across
+func (gm *GameMap) NavGrid() *pathfinding.Grid {
+	return gm.navGrid
+}
+
+// Get the map ready to be used once it's been read in, by working out its navigation grid.  The
+// grid never changes after this, so one map can be shared between rooms.
+func (gm *GameMap) prepare() {
+	gm.navGrid = pathfinding.CreateGrid(gm.Width-shared.ENTITY_SIZE, gm.Height-shared.ENTITY_SIZE, NAV_CELL_SIZE, gm.Blocked)
+}
+
+// Check that the map makes sense: it has a size, at least one spawn, every spawn leaves room for
+// a whole player inside the map, and everything else on it is inside the map too
+func (gm *GameMap) validate() error {
+	if gm.Width < shared.ENTITY_SIZE || gm.Height < shared.ENTITY_SIZE {
+		return fmt.Errorf("map %q is smaller than a player", gm.Name)
+	}
+	if len(gm.Spawns) == 0 {
+		return fmt.Errorf("map %q has no spawns", gm.Name)
+	}
+
+	for i, spawn := range gm.Spawns {
+		if spawn.Width < 0 || spawn.Height < 0 {
+			return fmt.Errorf("spawn %v on map %q has a negative size", i, gm.Name)
+		}
+		if spawn.X < 0 || spawn.Y < 0 ||
+			spawn.X+spawn.Width+shared.ENTITY_SIZE > gm.Width || spawn.Y+spawn.Height+shared.ENTITY_SIZE > gm.Height {
+			return fmt.Errorf("spawn %v on map %q doesn't fit inside the map", i, gm.Name)
+		}
+	}
+
+	for i, route := range gm.Patrols {
+		if len(route) < 2 {
+			return fmt.Errorf("patrol %v on map %q needs at least two waypoints", i, gm.Name)
+		}
+		for _, point := range route {
+			if point.X < 0 || point.Y < 0 || point.X+shared.ENTITY_SIZE > gm.Width || point.Y+shared.ENTITY_SIZE > gm.Height {
+				return fmt.Errorf("patrol %v on map %q goes outside the map", i, gm.Name)
+			}
+			if gm.Blocked(point) {
+				return fmt.Errorf("patrol %v on map %q has a waypoint on an obstacle", i, gm.Name)
+			}
+		}
+	}
+
+	for i, obstacle := range gm.Obstacles {
+		if obstacle.Width <= 0 || obstacle.Height <= 0 {
+			return fmt.Errorf("obstacle %v on map %q has no size", i, gm.Name)
+		}
+		if obstacle.X < 0 || obstacle.Y < 0 || obstacle.X+obstacle.Width > gm.Width || obstacle.Y+obstacle.Height > gm.Height {
+			return fmt.Errorf("obstacle %v on map %q doesn't fit inside the map", i, gm.Name)
+		}
+	}
+
+	for i, placement := range gm.Pickups {
+		if err := checkPlacedPickupKind(string(placement.Kind)); err != nil {
+			return fmt.Errorf("pickup %v on map %q: %v", i, gm.Name, err)
+		}
+		rect := pickupRect(placement.Position())
+		if rect.X < 0 || rect.Y < 0 || rect.X+rect.Width > gm.Width || rect.Y+rect.Height > gm.Height {
+			return fmt.Errorf("pickup %v on map %q doesn't fit inside the map", i, gm.Name)
+		}
+		if gm.blockedRect(rect) {
+			return fmt.Errorf("pickup %v on map %q is on an obstacle", i, gm.Name)
+		}
+	}
+
+	return nil
+}
+
+// Read a map from a JSON file.  An empty path gives the default map.
+func LoadGameMap(path string) (*GameMap, error) {
+	if path == "" {
+		return CreateDefaultGameMap(), nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gm := new(GameMap)
+	if err := json.Unmarshal(raw, gm); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if gm.Name == "" {
+		return nil, errors.New(path + ": the map needs a name")
+	}
+
+	if err := gm.validate(); err != nil {
+		return nil, err
+	}
+	gm.prepare()
+	return gm, nil
+}
+
+// Read the maps for the rotation from a comma separated list of JSON files.  An empty list gives
+// just the default map.
+func LoadGameMaps(paths string) ([]*GameMap, error) {
+	if paths == "" {
+		return []*GameMap{CreateDefaultGameMap()}, nil
+	}
+
+	maps := make([]*GameMap, 0)
+	for _, path := range strings.Split(paths, ",") {
+		gm, err := LoadGameMap(strings.TrimSpace(path))
+		if err != nil {
+			return nil, err
+		}
+		maps = append(maps, gm)
+	}
+	return maps, nil
+}
+
+// Create the map used when there's no map file: the size of the client's window, with players
+// spawning anywhere in it
+func CreateDefaultGameMap() *GameMap {
+	gm := &GameMap{
+		Name:   "default",
+		Width:  DEFAULT_MAP_WIDTH,
+		Height: DEFAULT_MAP_HEIGHT,
+		Spawns: []SpawnArea{{
+			Width:  DEFAULT_MAP_WIDTH - shared.ENTITY_SIZE,
+			Height: DEFAULT_MAP_HEIGHT - shared.ENTITY_SIZE,
+		}},
+	}
+	gm.prepare()
+	return gm
+}
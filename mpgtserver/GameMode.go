@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+)
+
+// The mode rooms get when their settings don't ask for one
+const DEFAULT_GAME_MODE = "ffa"
+
+// The kinds of thing which can happen in a room that a game mode gets told about through OnEvent
+type GameEventType int
+
+const (
+	// The entity was put on a team.  OldTeam is the one it was on before, empty if it has just come
+	// into the room.
+	GAME_EVENT_TEAM_CHANGED GameEventType = iota + 1
+
+	// The entity has just run into the other one.  Only sent when they start touching, not for
+	// every tick they stay that way.
+	GAME_EVENT_TOUCH
+
+	// The round has started, with everyone back at a spawn
+	GAME_EVENT_ROUND_STARTED
+
+	// The round is over.  The room's round has the winner.
+	GAME_EVENT_ROUND_ENDED
+)
+
+// Something which happened in a room.  Which fields are set depends on the type.
+type GameEvent struct {
+	Type    GameEventType
+	Entity  *PlayerEntity
+	Other   *PlayerEntity
+	OldTeam string
+}
+
+// The rules a room is played by.  The room runs the round - warmup, the round itself, showing the
+// result and moving on to the next map - and moves the players around, and the mode hears about
+// everything which happens along the way and decides when the round has been won.  Modes which
+// want to tell players something, like who is "it" in tag, can do so with Room.SetRoundStatus, and
+// they keep score with the room's scoreboard.
+//
+// Every method is called from the room's loop, so a mode has the room's entities to itself.
+type GameMode interface {
+	// Name of the mode, as it's given in the room settings
+	Name() string
+
+	// The teams there are, in the order they're offered to players.  Empty for a mode without
+	// teams, where everyone plays for themselves.
+	Teams() []string
+
+	// How many players there have to be for a round to start, not counting bots.  The round is
+	// called off if it drops below this.
+	MinPlayers() int
+
+	// How long a round lasts before CheckWinCondition is told time is up, zero for as long as it
+	// takes
+	TimeLimit() time.Duration
+
+	// A player came into the room.  They've been put somewhere and given a team by this point.
+	OnPlayerJoin(room *Room, entity *PlayerEntity)
+
+	// A player went away.  The entity is already out of the room.
+	OnPlayerLeave(room *Room, entity *PlayerEntity)
+
+	// Called every tick while the round is in progress, after the players have moved
+	OnTick(room *Room, now time.Time)
+
+	// Something happened in the room, whatever state the round is in
+	OnEvent(room *Room, event GameEvent)
+
+	// Called every tick while the round is in progress, to see whether it's over and who won it.
+	// Once timeUp is true the round ends whatever this returns, so it's the mode's last chance to
+	// name a winner.  An empty winner means nobody won.
+	CheckWinCondition(room *Room, timeUp bool) (winner string, over bool)
+}
+
+// A mode without any goal, where players just move around.  Rounds never end unless everyone
+// leaves.  The other modes build on this so they only need the hooks they care about.
+type sandboxMode struct{}
+
+// GameMode interface
+func (m *sandboxMode) Teams() []string {
+	return nil
+}
+
+// GameMode interface
+func (m *sandboxMode) MinPlayers() int {
+	return 1
+}
+
+// GameMode interface
+func (m *sandboxMode) TimeLimit() time.Duration {
+	return 0
+}
+
+// GameMode interface
+func (m *sandboxMode) OnPlayerJoin(room *Room, entity *PlayerEntity) {}
+
+// GameMode interface
+func (m *sandboxMode) OnPlayerLeave(room *Room, entity *PlayerEntity) {}
+
+// GameMode interface
+func (m *sandboxMode) OnTick(room *Room, now time.Time) {}
+
+// GameMode interface
+func (m *sandboxMode) OnEvent(room *Room, event GameEvent) {}
+
+// GameMode interface
+func (m *sandboxMode) CheckWinCondition(room *Room, timeUp bool) (string, bool) {
+	return "", false
+}
+
+// Everyone for themselves
+type freeForAllMode struct {
+	sandboxMode
+}
+
+// GameMode interface
+func (m *freeForAllMode) Name() string {
+	return "ffa"
+}
+
+// Red against blue, with nothing more to it than the colours.  The simplest team mode, and a
+// starting point for the real ones.
+type twoTeamMode struct {
+	sandboxMode
+}
+
+// GameMode interface
+func (m *twoTeamMode) Name() string {
+	return "teams"
+}
+
+// GameMode interface
+func (m *twoTeamMode) Teams() []string {
+	return []string{"red", "blue"}
+}
+
+// GameMode interface
+func (m *twoTeamMode) OnEvent(room *Room, event GameEvent) {
+	if event.Type == GAME_EVENT_TEAM_CHANGED {
+		gameLog.Info("Player joined team", logging.PLAYER_ID, event.Entity.entityId, "room", room.name, "team", event.Entity.team, "old_team", event.OldTeam)
+	}
+}
+
+// Every game mode there is, by name.  Each room gets its own instance.
+var gameModes = map[string]func() GameMode{
+	"ffa":   func() GameMode { return new(freeForAllMode) },
+	"teams": func() GameMode { return new(twoTeamMode) },
+	"tag":   func() GameMode { return CreateTagMode(config.roundTime) },
+}
+
+// Check the name of a game mode from the command line or a room's settings
+func checkGameMode(name string) error {
+	if _, ok := gameModes[name]; !ok {
+		names := make([]string, 0, len(gameModes))
+		for name := range gameModes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown mode %q, try %v", name, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Whether the mode has a team by that name
+func hasTeam(mode GameMode, team string) bool {
+	for _, t := range mode.Teams() {
+		if t == team {
+			return true
+		}
+	}
+	return false
+}
+
+// Create a game mode by name.  The name has to have passed checkGameMode.
+func CreateGameMode(name string) GameMode {
+	return gameModes[name]()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMACAuthenticator(t *testing.T) {
+	auth := CreateHMACAuthenticator("server key")
+	later := time.Now().Add(time.Hour)
+
+	valid := auth.MintToken("alice", later)
+	signature := valid[strings.LastIndex(valid, ":")+1:]
+
+	tests := []struct {
+		name     string
+		token    string
+		username string
+		ok       bool
+	}{
+		{"valid", valid, "alice", true},
+		{"colons in the username", auth.MintToken("a:b:c", later), "a:b:c", true},
+		{"expired", auth.MintToken("alice", time.Now().Add(-time.Second)), "", false},
+		{"other key", CreateHMACAuthenticator("other key").MintToken("alice", later), "", false},
+		{"username swapped", "mallory" + strings.TrimPrefix(valid, "alice"), "", false},
+		{"expiry pushed back", "alice:99999999999:" + signature, "", false},
+		{"signature not hex", "alice:99999999999:zz", "", false},
+		{"expiry not a number", "alice:soon:" + signature, "", false},
+		{"missing signature", "alice:99999999999", "", false},
+		{"no separators", "alice", "", false},
+		{"empty", "", "", false},
+		{"signed but not a good username", auth.MintToken("player7", later), "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The name the client asks for makes no difference, the token decides
+			username, err := auth.Authenticate("someone else", test.token)
+			if (err == nil) != test.ok || username != test.username {
+				t.Errorf("Authenticate(%q) = %q, %v, wanted %q (ok=%v)", test.token, username, err, test.username, test.ok)
+			}
+		})
+	}
+}
+
+func TestCheckUsername(t *testing.T) {
+	tests := []struct {
+		username string
+		ok       bool
+	}{
+		{"", true},
+		{"alice", true},
+		{"Zoë", true},
+		{"a:b", true},
+		{"player", true},
+		{"player1x", true},
+		{strings.Repeat("x", MAX_USERNAME_LENGTH), true},
+		{strings.Repeat("x", MAX_USERNAME_LENGTH+1), false},
+		{"player12", false},
+		{"Spectator3", false},
+		{"new\nline", false},
+		{"tab\tbed", false},
+		{"nul\x00", false},
+		{"\u0085", false},
+		{"bad\xffutf8", false},
+	}
+
+	for _, test := range tests {
+		if _, err := checkUsername(test.username); (err == nil) != test.ok {
+			t.Errorf("checkUsername(%q) gave %v, wanted ok=%v", test.username, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// A thread safe Prometheus style histogram: cumulative counts of observations falling at or
+// under each of a fixed set of upper bounds, plus the overall sum and count.
+type Histogram struct {
+	lock   *sync.Mutex
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Record one observation
+func (h *Histogram) Observe(value float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// Get the mean of all observations so far, zero if there haven't been any
+func (h *Histogram) Mean() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.count == 0 {
+		return 0
+	}
+
+	return h.sum / float64(h.count)
+}
+
+// Write the histogram out in the Prometheus text format under the given name
+func (h *Histogram) WriteTo(w io.Writer, name, help string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v histogram\n", name, help, name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%v_bucket{le=\"%v\"} %v\n", name, bound, h.counts[i])
+	}
+	fmt.Fprintf(w, "%v_bucket{le=\"+Inf\"} %v\n", name, h.count)
+	fmt.Fprintf(w, "%v_sum %v\n%v_count %v\n", name, h.sum, name, h.count)
+}
+
+// Create a histogram with the given upper bounds, which must be in increasing order
+func CreateHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		lock:   new(sync.Mutex),
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)),
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Returned by JoinQueue.Enter when every slot is taken and the queue is full as well
+var ErrServerFull = errors.New("the server is full and so is the queue to join it")
+
+// A player's place in the join queue
+type JoinTicket struct {
+	// Set, under the queue's lock, once the ticket has been handed a slot
+	hasSlot bool
+}
+
+// Thread safe count of the server's player slots, plus the line of players waiting for one.  A
+// slot is taken for as long as a player has a session, so a player who drops out keeps theirs for
+// the grace period and can always reconnect.  Spectators don't need slots.  A max of zero means
+// there are as many slots as anyone wants, and nobody ever waits.
+type JoinQueue struct {
+	lock       *sync.Mutex
+	maxPlayers int
+	maxWaiting int
+	used       int
+	waiting    []*JoinTicket
+}
+
+// Try to take a slot.  Returns a nil ticket if the player got one straight away, or a ticket to
+// wait on if they've been put in the queue.  Nobody jumps the queue - while anyone is waiting,
+// new players go to the back even if a slot has just come free.
+func (jq *JoinQueue) Enter() (*JoinTicket, error) {
+	jq.lock.Lock()
+	defer jq.lock.Unlock()
+
+	if jq.hasFreeSlot() && len(jq.waiting) == 0 {
+		jq.used++
+		return nil, nil
+	}
+
+	if len(jq.waiting) >= jq.maxWaiting {
+		return nil, ErrServerFull
+	}
+
+	ticket := new(JoinTicket)
+	jq.waiting = append(jq.waiting, ticket)
+	return ticket, nil
+}
+
+// Get a ticket's place in the queue, counting from 1, and how long the queue is.  The place is 0
+// once the ticket has been handed a slot.
+func (jq *JoinQueue) Position(ticket *JoinTicket) (int, int) {
+	jq.lock.Lock()
+	defer jq.lock.Unlock()
+
+	for i, waiting := range jq.waiting {
+		if waiting == ticket {
+			return i + 1, len(jq.waiting)
+		}
+	}
+	return 0, len(jq.waiting)
+}
+
+// Give up on a ticket, because the player went away while waiting.  If it was handed a slot in
+// the meantime the slot goes back to the next in line.
+func (jq *JoinQueue) Leave(ticket *JoinTicket) {
+	jq.lock.Lock()
+	defer jq.lock.Unlock()
+
+	if ticket.hasSlot {
+		jq.used--
+		jq.admit()
+		return
+	}
+
+	for i, waiting := range jq.waiting {
+		if waiting == ticket {
+			jq.waiting = append(jq.waiting[:i], jq.waiting[i+1:]...)
+			return
+		}
+	}
+}
+
+// Give back a slot, letting the player at the front of the queue in
+func (jq *JoinQueue) Release() {
+	jq.lock.Lock()
+	defer jq.lock.Unlock()
+
+	if jq.used > 0 {
+		jq.used--
+	}
+	jq.admit()
+}
+
+// Change how many players the server takes, zero for no limit.  Lowering it doesn't throw anyone
+// off, it just means nobody else gets in until enough have left.
+func (jq *JoinQueue) SetMaxPlayers(max int) {
+	jq.lock.Lock()
+	defer jq.lock.Unlock()
+
+	jq.maxPlayers = max
+	jq.admit()
+}
+
+// Write out how full the server is, for the admin console
+func (jq *JoinQueue) Dump(w io.Writer) {
+	jq.lock.Lock()
+	defer jq.lock.Unlock()
+
+	if jq.maxPlayers == 0 {
+		fmt.Fprintf(w, "slots: %v used, no limit\n", jq.used)
+		return
+	}
+	fmt.Fprintf(w, "slots: %v/%v used, %v/%v waiting to join\n", jq.used, jq.maxPlayers, len(jq.waiting), jq.maxWaiting)
+}
+
+// Whether a slot is free.  Must be called with the lock held.
+func (jq *JoinQueue) hasFreeSlot() bool {
+	return jq.maxPlayers == 0 || jq.used < jq.maxPlayers
+}
+
+// Hand out free slots to the front of the queue.  Must be called with the lock held.
+func (jq *JoinQueue) admit() {
+	for jq.hasFreeSlot() && len(jq.waiting) > 0 {
+		ticket := jq.waiting[0]
+		jq.waiting = jq.waiting[1:]
+
+		jq.used++
+		ticket.hasSlot = true
+	}
+}
+
+// Constructor to init a queue for a server taking maxPlayers players (zero for no limit), with up
+// to maxWaiting more allowed to wait for a slot
+func CreateJoinQueue(maxPlayers, maxWaiting int) *JoinQueue {
+	return &JoinQueue{
+		lock:       new(sync.Mutex),
+		maxPlayers: maxPlayers,
+		maxWaiting: maxWaiting,
+		waiting:    make([]*JoinTicket, 0),
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestJoinQueuePositions(t *testing.T) {
+	jq := CreateJoinQueue(2, 3)
+
+	for i := 0; i < 2; i++ {
+		if ticket, err := jq.Enter(); ticket != nil || err != nil {
+			t.Fatalf("player %v should have got a slot straight away, got %v, %v", i+1, ticket, err)
+		}
+	}
+
+	tickets := make([]*JoinTicket, 3)
+	for i := range tickets {
+		ticket, err := jq.Enter()
+		if ticket == nil || err != nil {
+			t.Fatalf("player %v should have been queued, got %v, %v", i+3, ticket, err)
+		}
+		tickets[i] = ticket
+	}
+	if _, err := jq.Enter(); err != ErrServerFull {
+		t.Fatalf("a full queue took another player, err=%v", err)
+	}
+
+	// Check the position of every ticket, in order, and the length of the queue
+	checkPositions := func(step string, want []int, length int) {
+		t.Helper()
+		for i, ticket := range tickets {
+			position, gotLength := jq.Position(ticket)
+			if position != want[i] || gotLength != length {
+				t.Errorf("%v: ticket %v is %v of %v, wanted %v of %v", step, i, position, gotLength, want[i], length)
+			}
+		}
+	}
+	checkPositions("queued", []int{1, 2, 3}, 3)
+
+	// Someone in the middle gives up
+	jq.Leave(tickets[1])
+	checkPositions("middle left", []int{1, 0, 2}, 2)
+
+	// A player with a slot leaves, so the front of the queue gets in
+	jq.Release()
+	checkPositions("slot released", []int{0, 0, 1}, 1)
+	if !tickets[0].hasSlot {
+		t.Errorf("front of the queue wasn't handed the free slot")
+	}
+
+	// The player who was let in goes away before joining, so their slot goes to the next one
+	jq.Leave(tickets[0])
+	checkPositions("admitted player left", []int{0, 0, 0}, 0)
+	if !tickets[2].hasSlot {
+		t.Errorf("slot given up by an admitted player didn't go to the next in line")
+	}
+
+	// Nobody is waiting, so the next free slot is just free
+	jq.Release()
+	if ticket, err := jq.Enter(); ticket != nil || err != nil {
+		t.Errorf("free slot wasn't handed out straight away, got %v, %v", ticket, err)
+	}
+}
+
+func TestJoinQueueMaxPlayers(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxPlayers int
+		newMax     int
+		admitted   int
+	}{
+		{"raising lets waiting players in", 1, 3, 2},
+		{"raising past the queue", 1, 10, 3},
+		{"lowering keeps everyone waiting", 2, 1, 0},
+		{"no limit lets everyone in", 1, 0, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jq := CreateJoinQueue(test.maxPlayers, 5)
+			for i := 0; i < test.maxPlayers; i++ {
+				jq.Enter()
+			}
+			tickets := make([]*JoinTicket, 0)
+			for i := 0; i < 3; i++ {
+				ticket, _ := jq.Enter()
+				tickets = append(tickets, ticket)
+			}
+
+			jq.SetMaxPlayers(test.newMax)
+			admitted := 0
+			for _, ticket := range tickets {
+				if ticket.hasSlot {
+					admitted++
+				}
+			}
+			if admitted != test.admitted {
+				t.Errorf("%v players let in, wanted %v", admitted, test.admitted)
+			}
+		})
+	}
+}
+
+func TestJoinQueueNoLimit(t *testing.T) {
+	jq := CreateJoinQueue(0, 0)
+
+	for i := 0; i < 100; i++ {
+		if ticket, err := jq.Enter(); ticket != nil || err != nil {
+			t.Fatalf("player %v had to wait with no limit, got %v, %v", i+1, ticket, err)
+		}
+	}
+}
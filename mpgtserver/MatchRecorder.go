@@ -0,0 +1,145 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/recording"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Write a keyframe (and flush the file) every this many ticks
+const KEYFRAME_INTERVAL int64 = 30
+
+var recordLog = logging.RateLimited(logging.For("recording"), time.Second)
+
+// Hooks the server up to a recording.  All of the methods are safe to call on a nil MatchRecorder
+// and do nothing, so the rest of the server doesn't have to care whether recording is turned on.
+type MatchRecorder struct {
+	recorder *recording.Recorder
+}
+
+// Start a new tick
+func (mr *MatchRecorder) StartTick(tick int64) {
+	if mr == nil {
+		return
+	}
+	mr.recorder.SetTick(tick)
+}
+
+// EntityListener interface - the entity is about to be put into the world
+func (mr *MatchRecorder) EntityAdded(entity *PlayerEntity) {
+	pos := entity.position
+	movement := entity.Movement()
+	velocity := entity.velocity
+	mr.record(recording.Event{
+		Kind:     recording.EVENT_JOIN,
+		PlayerId: entity.entityId,
+		Username: entity.username,
+		Position: &pos,
+		Movement: &movement,
+		Velocity: &velocity,
+	})
+}
+
+// EntityListener interface - the entity was taken out of the world
+func (mr *MatchRecorder) EntityRemoved(id int64) {
+	mr.record(recording.Event{Kind: recording.EVENT_LEAVE, PlayerId: id})
+}
+
+// An input was accepted and applied with the given (already clamped) frame delta
+func (mr *MatchRecorder) RecordInput(msg *protocol.SendInputMessage, dt shared.MDuration) {
+	input := *msg.Input
+	mr.record(recording.Event{
+		Kind:     recording.EVENT_INPUT,
+		PlayerId: msg.PlayerId,
+		Input:    &input,
+		Dt:       dt,
+		Seq:      msg.Seq,
+	})
+}
+
+// An entity was put somewhere by the server rather than by its player's input.  It always arrives
+// standing still.
+func (mr *MatchRecorder) RecordTeleport(entity *PlayerEntity) {
+	pos := entity.position
+	mr.record(recording.Event{Kind: recording.EVENT_TELEPORT, PlayerId: entity.entityId, Position: &pos})
+}
+
+// An entity's team was set
+func (mr *MatchRecorder) RecordTeam(entity *PlayerEntity) {
+	mr.record(recording.Event{Kind: recording.EVENT_TEAM, PlayerId: entity.entityId, Team: entity.team})
+}
+
+// The way an entity moves changed
+func (mr *MatchRecorder) RecordMovement(entity *PlayerEntity) {
+	movement := entity.Movement()
+	mr.record(recording.Event{Kind: recording.EVENT_MOVEMENT, PlayerId: entity.entityId, Movement: &movement})
+}
+
+// An entity was knocked back, changing its velocity
+func (mr *MatchRecorder) RecordKnockback(entity *PlayerEntity) {
+	velocity := entity.velocity
+	mr.record(recording.Event{Kind: recording.EVENT_KNOCKBACK, PlayerId: entity.entityId, Velocity: &velocity})
+}
+
+// The room's settings changed.  Also called once when the recording starts.
+func (mr *MatchRecorder) RecordSettings(settings protocol.RoomSettings) {
+	mr.record(recording.Event{
+		Kind:         recording.EVENT_SETTINGS,
+		Speed:        settings.Speed,
+		TickDuration: time.Duration(settings.TickMillis) * time.Millisecond,
+	})
+}
+
+// Called at the end of each tick with the world state which was just sent out.  Every so often it
+// goes into the recording as a keyframe so a replay can check it hasn't drifted.
+func (mr *MatchRecorder) EndTick(entities []protocol.MessageEntity) {
+	if mr == nil || mr.recorder.Tick()%KEYFRAME_INTERVAL != 0 {
+		return
+	}
+
+	mr.record(recording.Event{Kind: recording.EVENT_KEYFRAME, Entities: entities})
+	if err := mr.recorder.Flush(); err != nil && err != recording.ErrClosed {
+		recordLog.Error("Couldn't flush recording", logging.ERROR, err)
+	}
+}
+
+// Finish the recording.  Anything recorded afterwards is dropped.
+func (mr *MatchRecorder) Close() {
+	if mr == nil {
+		return
+	}
+
+	if err := mr.recorder.Close(); err != nil && err != recording.ErrClosed {
+		recordLog.Error("Couldn't close recording", logging.ERROR, err)
+	}
+}
+
+// Write an event, logging rather than failing if the disk is having trouble - a broken recording
+// shouldn't take the game down with it
+func (mr *MatchRecorder) record(event recording.Event) {
+	if mr == nil {
+		return
+	}
+
+	// The room can still be finishing a tick while the server shuts down and closes its recording
+	if err := mr.recorder.Record(event); err != nil && err != recording.ErrClosed {
+		recordLog.Error("Couldn't write to recording", logging.ERROR, err)
+	}
+}
+
+// Start recording a room to the given file.  The recorder registers itself with the room's entity
+// holder so it hears about every player joining and leaving.
+func CreateMatchRecorder(path string, entities *EntityHolder, settings protocol.RoomSettings) (*MatchRecorder, error) {
+	recorder, err := recording.CreateRecorder(path, time.Duration(settings.TickMillis)*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	mr := &MatchRecorder{recorder: recorder}
+	mr.RecordSettings(settings)
+	entities.SetListener(mr)
+	return mr, nil
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+)
+
+const (
+	// How often the matchmaker looks over the queue
+	MATCHMAKER_INTERVAL time.Duration = 250 * time.Millisecond
+
+	// Rating of a player the ratings file doesn't know about
+	DEFAULT_RATING float64 = 1000
+
+	// Match rooms are named this plus the match ID.  Clients can't make rooms with names like this
+	// themselves.
+	MATCH_ROOM_PREFIX = "match-"
+)
+
+var (
+	ErrSpectatorQueue = errors.New("spectators can't queue for matches")
+	ErrAlreadyQueued  = errors.New("already waiting for a match")
+	ErrAlreadyInMatch = errors.New("already in a match")
+)
+
+var matchLog = logging.For("match")
+
+// How the matchmaker puts groups together
+type MatchRules struct {
+	// How many players go in each match
+	size int
+
+	// Whether to only group players of similar rating.  Each player starts out only matching
+	// others within skillWindow of their own rating, and the window widens by relaxPerSecond for
+	// every second they've been waiting, so nobody waits forever.
+	useSkill       bool
+	skillWindow    float64
+	relaxPerSecond float64
+
+	// How long between a match being found and it starting, and how long it lasts
+	readyDelay time.Duration
+	length     time.Duration
+}
+
+// A player waiting in the lobby for a match
+type queuedPlayer struct {
+	playerId int64
+	username string
+	rating   float64
+	queuedAt time.Time
+}
+
+// A group of players the matchmaker has put together.  Players are kept by ID rather than by
+// client so a reconnect doesn't lose track of them.
+type Match struct {
+	id        int64
+	room      string
+	playerIds []int64
+	usernames []string
+
+	// When the room opens, and when the match is over.  endsAt is only set once it has started.
+	readyAt time.Time
+	endsAt  time.Time
+	started bool
+}
+
+// Groups the players waiting in the lobby into matches, moves each group into a fresh room of its
+// own and brings them back to the lobby (the default room) when the match is over.
+type Matchmaker struct {
+	lock    *sync.Mutex
+	rules   MatchRules
+	ratings map[string]float64
+	queue   []*queuedPlayer
+	matches map[int64]*Match
+	nextId  int64
+}
+
+// Put a player in the queue
+func (mm *Matchmaker) Enqueue(client *Client) error {
+	if client.spectator {
+		return ErrSpectatorQueue
+	}
+
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	for _, queued := range mm.queue {
+		if queued.playerId == client.clientId {
+			return ErrAlreadyQueued
+		}
+	}
+	if mm.findMatch(client.clientId) != nil {
+		return ErrAlreadyInMatch
+	}
+
+	rating, ok := mm.ratings[client.username]
+	if !ok {
+		rating = DEFAULT_RATING
+	}
+
+	mm.queue = append(mm.queue, &queuedPlayer{
+		playerId: client.clientId,
+		username: client.username,
+		rating:   rating,
+		queuedAt: time.Now(),
+	})
+	matchLog.Info("Player queued", logging.PLAYER_ID, client.clientId, "rating", rating, "queued", len(mm.queue))
+
+	return nil
+}
+
+// Take a player out of the queue.  Returns false if they weren't in it.
+func (mm *Matchmaker) Dequeue(playerId int64) bool {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	for i, queued := range mm.queue {
+		if queued.playerId == playerId {
+			mm.queue = append(mm.queue[:i], mm.queue[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Write out who's waiting and which matches are on, for the admin console
+func (mm *Matchmaker) Dump(w io.Writer) {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	now := time.Now()
+	fmt.Fprintf(w, "queue: %v waiting\n", len(mm.queue))
+	for _, queued := range mm.queue {
+		fmt.Fprintf(w, "  %v %v rating=%v waited=%v\n", queued.playerId, queued.username, queued.rating, now.Sub(queued.queuedAt).Round(time.Second))
+	}
+
+	ids := make([]int64, 0, len(mm.matches))
+	for id := range mm.matches {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	fmt.Fprintf(w, "matches: %v\n", len(ids))
+	for _, id := range ids {
+		match := mm.matches[id]
+		fmt.Fprintf(w, "  %v room=%v started=%v players=%v\n", match.id, match.room, match.started, match.usernames)
+	}
+}
+
+// The matchmaker's loop.  Runs in its own goroutine for as long as the server is up.
+func (mm *Matchmaker) Run() {
+	for {
+		time.Sleep(MATCHMAKER_INTERVAL)
+		now := time.Now()
+
+		for _, match := range mm.formMatches(now) {
+			matchLog.Info("Match found", "match_id", match.id, "players", match.usernames)
+			for _, id := range match.playerIds {
+				sendMessageToClient(protocol.CreateMatchFoundMessage(match.id, match.usernames), id)
+			}
+		}
+
+		for _, match := range mm.dueToStart(now) {
+			mm.startMatch(match, now)
+		}
+
+		for _, match := range mm.dueToEnd(now) {
+			mm.endMatch(match)
+		}
+	}
+}
+
+// Put together as many groups as the queue allows.  The players who have waited longest get
+// served first: each one in turn is matched with the closest rated players who are within both
+// of their windows.  Every player in a group has to be within the window of every other one, not
+// just the first's, or two players either side of the first could end up twice as far apart as
+// either would accept.  Returns the new matches.
+func (mm *Matchmaker) formMatches(now time.Time) []*Match {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	sort.Slice(mm.queue, func(i, j int) bool { return mm.queue[i].queuedAt.Before(mm.queue[j].queuedAt) })
+
+	used := make(map[int64]bool)
+	formed := make([]*Match, 0)
+	for i, anchor := range mm.queue {
+		if used[anchor.playerId] {
+			continue
+		}
+
+		candidates := make([]*queuedPlayer, 0)
+		for _, other := range mm.queue[i+1:] {
+			if !used[other.playerId] && mm.compatible(anchor, other, now) {
+				candidates = append(candidates, other)
+			}
+		}
+		if len(candidates)+1 < mm.rules.size {
+			continue
+		}
+
+		// Closest ratings first.  The sort is stable so equal ratings keep the longest waiting first.
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return math.Abs(candidates[a].rating-anchor.rating) < math.Abs(candidates[b].rating-anchor.rating)
+		})
+
+		group := []*queuedPlayer{anchor}
+		for _, candidate := range candidates {
+			if len(group) == mm.rules.size {
+				break
+			}
+			if mm.compatibleWithAll(candidate, group, now) {
+				group = append(group, candidate)
+			}
+		}
+		if len(group) < mm.rules.size {
+			continue
+		}
+
+		mm.nextId++
+		match := &Match{
+			id:      mm.nextId,
+			room:    fmt.Sprintf("%v%v", MATCH_ROOM_PREFIX, mm.nextId),
+			readyAt: now.Add(mm.rules.readyDelay),
+		}
+		for _, player := range group {
+			used[player.playerId] = true
+			match.playerIds = append(match.playerIds, player.playerId)
+			match.usernames = append(match.usernames, player.username)
+		}
+
+		mm.matches[match.id] = match
+		formed = append(formed, match)
+	}
+
+	remaining := mm.queue[:0]
+	for _, queued := range mm.queue {
+		if !used[queued.playerId] {
+			remaining = append(remaining, queued)
+		}
+	}
+	mm.queue = remaining
+
+	return formed
+}
+
+// Whether two players are close enough in rating to be put in the same match
+func (mm *Matchmaker) compatible(a, b *queuedPlayer, now time.Time) bool {
+	if !mm.rules.useSkill {
+		return true
+	}
+
+	diff := math.Abs(a.rating - b.rating)
+	return diff <= mm.window(a, now) && diff <= mm.window(b, now)
+}
+
+// Whether a player is close enough in rating to everyone already in a group
+func (mm *Matchmaker) compatibleWithAll(player *queuedPlayer, group []*queuedPlayer, now time.Time) bool {
+	for _, member := range group {
+		if !mm.compatible(player, member, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// How far from their own rating a player will accept, given how long they've been waiting
+func (mm *Matchmaker) window(player *queuedPlayer, now time.Time) float64 {
+	return mm.rules.skillWindow + mm.rules.relaxPerSecond*now.Sub(player.queuedAt).Seconds()
+}
+
+// Get the matches whose room should open now
+func (mm *Matchmaker) dueToStart(now time.Time) []*Match {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	due := make([]*Match, 0)
+	for _, match := range mm.matches {
+		if !match.started && !now.Before(match.readyAt) {
+			match.started = true
+			match.endsAt = now.Add(mm.rules.length)
+			due = append(due, match)
+		}
+	}
+
+	return due
+}
+
+// Get the matches which are over, either because their time is up or because everyone left the
+// room, and forget about them
+func (mm *Matchmaker) dueToEnd(now time.Time) []*Match {
+	mm.lock.Lock()
+	defer mm.lock.Unlock()
+
+	due := make([]*Match, 0)
+	for id, match := range mm.matches {
+		if match.started && (!now.Before(match.endsAt) || roomHolder.GetRoom(match.room) == nil) {
+			delete(mm.matches, id)
+			due = append(due, match)
+		}
+	}
+
+	return due
+}
+
+// Open a match's room and move its players in.  Whoever gets there first creates the room, the
+// rest join it.  Players who went away since the match was found are left out.
+func (mm *Matchmaker) startMatch(match *Match, now time.Time) {
+	settings, _ := normalizeRoomSettings(protocol.RoomSettings{MaxPlayers: mm.rules.size, Mode: config.matchMode})
+
+	mode := ROOM_CREATE
+	for _, id := range match.playerIds {
+		client := clientHolder.GetClient(id)
+		if client == nil {
+			continue
+		}
+
+		if changeRoom(client, match.room, mode, settings) == nil {
+			continue
+		}
+		mode = ROOM_JOIN_EXISTING
+
+		writeMessage(client.conn, protocol.CreateMatchReadyMessage(match.id, match.room))
+	}
+
+	// If nobody made it the room was never opened, and the match ends on the next pass
+	if mode == ROOM_CREATE {
+		matchLog.Info("Nobody showed up for the match", "match_id", match.id)
+		return
+	}
+	matchLog.Info("Match started", "match_id", match.id, "room", match.room, "length", mm.rules.length)
+}
+
+// Send everyone still in a match's room back to the lobby
+func (mm *Matchmaker) endMatch(match *Match) {
+	matchLog.Info("Match ended", "match_id", match.id, "room", match.room)
+
+	for _, id := range match.playerIds {
+		client := clientHolder.GetClient(id)
+		if client == nil {
+			continue
+		}
+
+		room := client.GetRoom()
+		if room == nil || room.name != match.room {
+			continue
+		}
+
+		writeMessage(client.conn, protocol.CreateMatchEndedMessage(match.id, "time is up"))
+		changeRoom(client, config.defaultRoom, ROOM_JOIN_EXISTING, protocol.RoomSettings{})
+	}
+}
+
+// Get the match a player is in, nil if none.  Must be called with the lock held.
+func (mm *Matchmaker) findMatch(playerId int64) *Match {
+	for _, match := range mm.matches {
+		for _, id := range match.playerIds {
+			if id == playerId {
+				return match
+			}
+		}
+	}
+
+	return nil
+}
+
+// Deal with a client asking to queue for a match or to stop waiting.  Returns false if the message
+// isn't about matchmaking.
+func handleMatchmakingMessage(client *Client, message protocol.Message) bool {
+	switch message.(type) {
+	case *protocol.QueueMatchMessage:
+		if err := matchmaker.Enqueue(client); err != nil {
+			writeMessage(client.conn, protocol.CreateQueueRejectedMessage(err.Error()))
+		}
+
+	case *protocol.LeaveQueueMessage:
+		if matchmaker.Dequeue(client.clientId) {
+			matchLog.Info("Player left the queue", logging.PLAYER_ID, client.clientId)
+		}
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Read player ratings from a file with a "username rating" pair on each line.  Blank lines and
+// lines starting with # are skipped.
+func LoadRatings(path string) (map[string]float64, error) {
+	ratings := make(map[string]float64)
+	if path == "" {
+		return ratings, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%v:%v: expected a username and a rating", path, lineNum)
+		}
+
+		rating, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v: bad rating: %v", path, lineNum, err)
+		}
+		ratings[fields[0]] = rating
+	}
+
+	return ratings, scanner.Err()
+}
+
+// Constructor to init the matchmaker.  Call Run to start it.
+func CreateMatchmaker(rules MatchRules, ratings map[string]float64) *Matchmaker {
+	return &Matchmaker{
+		lock:    new(sync.Mutex),
+		rules:   rules,
+		ratings: ratings,
+		queue:   make([]*queuedPlayer, 0),
+		matches: make(map[int64]*Match),
+	}
+}
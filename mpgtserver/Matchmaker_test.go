@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFormMatchesBySkill(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		ratings []float64
+		want    [][]int64
+	}{
+		{
+			name:    "everyone close",
+			ratings: []float64{1000, 1050, 960},
+			want:    [][]int64{{1, 3, 2}},
+		},
+		{
+			name:    "either side of the first but too far from each other",
+			ratings: []float64{1000, 920, 1080},
+			want:    nil,
+		},
+		{
+			name:    "skips the one who's too far from the others",
+			ratings: []float64{1000, 920, 1080, 1040},
+			want:    [][]int64{{1, 4, 3}},
+		},
+		{
+			name:    "two groups",
+			ratings: []float64{1000, 1500, 1010, 1520, 990, 1480},
+			want:    [][]int64{{1, 3, 5}, {2, 4, 6}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules := MatchRules{size: 3, useSkill: true, skillWindow: 100}
+			mm := CreateMatchmaker(rules, make(map[string]float64))
+			for i, rating := range test.ratings {
+				mm.queue = append(mm.queue, &queuedPlayer{
+					playerId: int64(i + 1),
+					username: fmt.Sprintf("p%v", i+1),
+					rating:   rating,
+					queuedAt: now.Add(time.Duration(i) * time.Millisecond),
+				})
+			}
+
+			formed := mm.formMatches(now.Add(time.Second))
+			got := make([][]int64, 0, len(formed))
+			for _, match := range formed {
+				got = append(got, match.playerIds)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(append([][]int64{}, test.want...)) {
+				t.Errorf("got matches %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+)
+
+// Everything the server counts about itself.  The counts are collected here as things happen;
+// gauges like the number of connected clients are read straight from the holders whenever
+// someone asks for them.
+type Metrics struct {
+	lock *sync.Mutex
+
+	startTime time.Time
+
+	// How long each iteration of the main loop took, not counting the sleep
+	tickDuration *Histogram
+
+	// How many messages came out of the MessageQueue in each iteration of the main loop
+	messagesPerTick *Histogram
+
+	// Traffic by message type
+	messagesSent     map[protocol.MessageType]uint64
+	bytesSent        map[protocol.MessageType]uint64
+	messagesReceived map[protocol.MessageType]uint64
+	bytesReceived    map[protocol.MessageType]uint64
+
+	// Inputs thrown away by the main loop, by reason
+	rejectedInputs map[string]uint64
+}
+
+// Count an outgoing message
+func (m *Metrics) CountSent(msgType protocol.MessageType, size int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messagesSent[msgType]++
+	m.bytesSent[msgType] += uint64(size)
+}
+
+// Count an incoming message
+func (m *Metrics) CountReceived(msgType protocol.MessageType, size int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.messagesReceived[msgType]++
+	m.bytesReceived[msgType] += uint64(size)
+}
+
+// Count an input rejected for the given reason
+func (m *Metrics) CountRejectedInput(reason string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.rejectedInputs[reason]++
+}
+
+// Serve the metrics in the Prometheus text format
+func (m *Metrics) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	m.tickDuration.WriteTo(w, "mpgt_tick_duration_seconds", "Time spent in each iteration of the main loop, excluding sleep.")
+	m.messagesPerTick.WriteTo(w, "mpgt_messages_per_tick", "Messages popped from the message queue per iteration of the main loop.")
+
+	players, spectators := clientHolder.Count()
+	writeGauge(w, "mpgt_connected_clients", "Clients currently connected, players and spectators.", float64(players+spectators))
+	writeGauge(w, "mpgt_connected_spectators", "Spectators currently connected.", float64(spectators))
+	rooms := roomHolder.GetRooms()
+	writeGauge(w, "mpgt_rooms", "Rooms currently open.", float64(len(rooms)))
+	writeGauge(w, "mpgt_entities", "Entities currently in the world, over all rooms.", float64(countEntities(rooms)))
+	writeGauge(w, "mpgt_uptime_seconds", "Seconds since the server started.", time.Since(m.startTime).Seconds())
+
+	m.lock.Lock()
+	writeTypeCounter(w, "mpgt_messages_sent_total", "Messages sent to clients, by type.", m.messagesSent)
+	writeTypeCounter(w, "mpgt_bytes_sent_total", "Bytes sent to clients, by message type.", m.bytesSent)
+	writeTypeCounter(w, "mpgt_messages_received_total", "Messages received from clients, by type.", m.messagesReceived)
+	writeTypeCounter(w, "mpgt_bytes_received_total", "Bytes received from clients, by message type.", m.bytesReceived)
+
+	fmt.Fprintf(w, "# HELP mpgt_rejected_inputs_total Inputs rejected by validation, by reason.\n# TYPE mpgt_rejected_inputs_total counter\n")
+	for _, reason := range sortedKeys(m.rejectedInputs) {
+		fmt.Fprintf(w, "mpgt_rejected_inputs_total{reason=%q} %v\n", reason, m.rejectedInputs[reason])
+	}
+	m.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP mpgt_throttled_messages_total Messages held back by the per-connection rate limiter.\n# TYPE mpgt_throttled_messages_total counter\n")
+	fmt.Fprintf(w, "mpgt_throttled_messages_total %v\n", atomic.LoadInt64(&totalThrottled))
+	fmt.Fprintf(w, "# HELP mpgt_dropped_messages_total Messages dropped by the per-connection rate limiter.\n# TYPE mpgt_dropped_messages_total counter\n")
+	fmt.Fprintf(w, "mpgt_dropped_messages_total %v\n", atomic.LoadInt64(&totalDropped))
+
+	fmt.Fprintf(w, "# HELP mpgt_client_rtt_seconds Last measured round trip time to each client.\n# TYPE mpgt_client_rtt_seconds gauge\n")
+	for _, c := range clientHolder.GetClients() {
+		fmt.Fprintf(w, "mpgt_client_rtt_seconds{player_id=\"%v\"} %v\n", c.clientId, c.GetRTT().Seconds())
+	}
+}
+
+// What a client looks like on the status page
+type clientStatus struct {
+	Id        int64
+	Username  string
+	Address   string
+	RTTMillis float64
+	Spectator bool
+	Room      string
+}
+
+// The whole status page
+type serverStatus struct {
+	Uptime              string
+	Clients             []clientStatus
+	Rooms               []protocol.RoomInfo
+	Entities            int
+	MeanTickMillis      float64
+	MeanMessagesPerTick float64
+}
+
+// Serve a quick human-readable summary as JSON
+func (m *Metrics) ServeStatus(w http.ResponseWriter, r *http.Request) {
+	status := serverStatus{
+		Uptime:              time.Since(m.startTime).Round(time.Second).String(),
+		Clients:             make([]clientStatus, 0),
+		Rooms:               roomHolder.List(),
+		Entities:            countEntities(roomHolder.GetRooms()),
+		MeanTickMillis:      m.tickDuration.Mean() * 1000,
+		MeanMessagesPerTick: m.messagesPerTick.Mean(),
+	}
+
+	for _, c := range clientHolder.GetClients() {
+		roomName := ""
+		if room := c.GetRoom(); room != nil {
+			roomName = room.name
+		}
+
+		status.Clients = append(status.Clients, clientStatus{
+			Id:        c.clientId,
+			Username:  c.username,
+			Address:   c.conn.RemoteAddr().String(),
+			RTTMillis: float64(c.GetRTT()) / float64(time.Millisecond),
+			Spectator: c.spectator,
+			Room:      roomName,
+		})
+	}
+	sort.Slice(status.Clients, func(i, j int) bool { return status.Clients[i].Id < status.Clients[j].Id })
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(status)
+}
+
+// Start the HTTP listener for the metrics and status pages.  Runs until the server exits.
+func (m *Metrics) ListenAndServe(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.ServeMetrics)
+	mux.HandleFunc("/status", m.ServeStatus)
+
+	netLog.Info("Serving metrics", logging.ADDR, addr)
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		netLog.Error("Metrics listener stopped", logging.ERROR, err)
+	}
+}
+
+// Constructor to init the metrics
+func CreateMetrics() *Metrics {
+	return &Metrics{
+		lock:             new(sync.Mutex),
+		startTime:        time.Now(),
+		tickDuration:     CreateHistogram([]float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.02, 0.033, 0.05, 0.1}),
+		messagesPerTick:  CreateHistogram([]float64{0, 1, 2, 5, 10, 25, 50, 100, 250}),
+		messagesSent:     make(map[protocol.MessageType]uint64),
+		bytesSent:        make(map[protocol.MessageType]uint64),
+		messagesReceived: make(map[protocol.MessageType]uint64),
+		bytesReceived:    make(map[protocol.MessageType]uint64),
+		rejectedInputs:   make(map[string]uint64),
+	}
+}
+
+// Write a single unlabelled gauge
+func writeGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v gauge\n%v %v\n", name, help, name, name, value)
+}
+
+// Write a counter labelled by message type
+func writeTypeCounter(w io.Writer, name, help string, values map[protocol.MessageType]uint64) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v counter\n", name, help, name)
+
+	types := make([]protocol.MessageType, 0, len(values))
+	for t := range values {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	for _, t := range types {
+		fmt.Fprintf(w, "%v{message_type=\"%v\"} %v\n", name, t, values[t])
+	}
+}
+
+// Get the keys of a map in order so the output is stable
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Add up the entities in all of the rooms
+func countEntities(rooms []*Room) int {
+	count := 0
+	for _, room := range rooms {
+		count += len(room.entities.GetEntities())
+	}
+
+	return count
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+const (
+	// Extra movement time a player can use in a window on top of the real elapsed time, to soak
+	// up network jitter.  Expressed both as a flat amount and as a fraction of the window.
+	BUDGET_TOLERANCE          time.Duration = 50 * time.Millisecond
+	BUDGET_TOLERANCE_FRACTION float64       = 0.05
+
+	// How many violation points go away per second of good behaviour
+	VIOLATION_DECAY_PER_SECOND float64 = 1
+
+	// How much each kind of violation adds to the score.  Single rejected messages happen to honest
+	// players on bad connections now and then, so they're cheap.  Going over the budget can only
+	// really happen on purpose, and so can sending a message with nothing in it.
+	VIOLATION_WEIGHT_BAD_DELTA  float64 = 1
+	VIOLATION_WEIGHT_OVERBUDGET float64 = 3
+	VIOLATION_WEIGHT_MALFORMED  float64 = 3
+)
+
+// One accepted input, remembered so it can be counted against the window
+type budgetSample struct {
+	rcvdTime time.Time
+	dt       time.Duration
+}
+
+// Tracks how much movement time a player has used over a sliding window of real time.  The frame
+// deltas of all the accepted inputs inside the window can't add up to more than the time that
+// actually passed, otherwise the player is moving faster than their speed allows no matter how
+// each individual message looks.  Also keeps a violation score which goes up with every offence
+// and slowly decays back to zero.
+type MovementBudget struct {
+	window  time.Duration
+	samples []budgetSample
+
+	// Time of the newest sample which has slid out of the window.  Real elapsed time is
+	// measured from here.
+	anchor time.Time
+
+	score           float64
+	lastScoreUpdate time.Time
+
+	// Where the player was the last time their score was clean.  Rubber-banding sends them back
+	// here.
+	safePosition shared.FloatVector
+}
+
+// Check whether an input with the given frame delta, received at the given time, fits in the
+// budget.  If it does, it gets counted against the window.
+func (mb *MovementBudget) Allow(rcvd time.Time, dt time.Duration) bool {
+	if mb.anchor.IsZero() {
+		// First input ever - give the benefit of the doubt for its own delta
+		mb.anchor = rcvd.Add(-dt)
+	}
+
+	// Drop everything which has slid out of the window, moving the anchor along with it
+	cutoff := rcvd.Add(-mb.window)
+	kept := mb.samples[:0]
+	for _, sample := range mb.samples {
+		if sample.rcvdTime.Before(cutoff) {
+			if sample.rcvdTime.After(mb.anchor) {
+				mb.anchor = sample.rcvdTime
+			}
+			continue
+		}
+		kept = append(kept, sample)
+	}
+	mb.samples = kept
+
+	// A player who sat still for a while doesn't get to bank all that time - at most one max
+	// frame on top of the window.
+	earliest := cutoff.Add(-shared.MAX_DT)
+	if mb.anchor.Before(earliest) {
+		mb.anchor = earliest
+	}
+
+	used := dt
+	for _, sample := range mb.samples {
+		used += sample.dt
+	}
+
+	elapsed := rcvd.Sub(mb.anchor)
+	allowed := elapsed + BUDGET_TOLERANCE + time.Duration(float64(elapsed)*BUDGET_TOLERANCE_FRACTION)
+	if used > allowed {
+		return false
+	}
+
+	mb.samples = append(mb.samples, budgetSample{rcvdTime: rcvd, dt: dt})
+	return true
+}
+
+// Add a violation to the score and return the new total
+func (mb *MovementBudget) AddViolation(now time.Time, weight float64) float64 {
+	mb.decay(now)
+	mb.score += weight
+	return mb.score
+}
+
+// Get the current score after decay
+func (mb *MovementBudget) Score(now time.Time) float64 {
+	mb.decay(now)
+	return mb.score
+}
+
+// Called after every accepted move so we know where to rubber-band back to
+func (mb *MovementBudget) RecordPosition(now time.Time, pos shared.FloatVector) {
+	if mb.Score(now) == 0 {
+		mb.safePosition = pos
+	}
+}
+
+// Forget the window and the score, used after rubber-banding so the player starts over clean
+func (mb *MovementBudget) Reset(now time.Time) {
+	mb.samples = mb.samples[:0]
+	mb.anchor = now
+	mb.score = 0
+	mb.lastScoreUpdate = now
+}
+
+// Let the score drop according to how long it's been since it was last touched
+func (mb *MovementBudget) decay(now time.Time) {
+	if !mb.lastScoreUpdate.IsZero() {
+		mb.score -= now.Sub(mb.lastScoreUpdate).Seconds() * VIOLATION_DECAY_PER_SECOND
+		if mb.score < 0 {
+			mb.score = 0
+		}
+	}
+	mb.lastScoreUpdate = now
+}
+
+// Create a new budget over the given window, starting from the entity's spawn position
+func CreateMovementBudget(window time.Duration, initialPos shared.FloatVector) *MovementBudget {
+	return &MovementBudget{
+		window:       window,
+		samples:      make([]budgetSample, 0),
+		safePosition: initialPos,
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// One input as the budget sees it: when it arrived, relative to the first one, and the frame time
+// it claims
+type budgetInput struct {
+	at time.Duration
+	dt time.Duration
+}
+
+// n inputs arriving every so often from start, each claiming dt
+func steadyInputs(start time.Duration, n int, every, dt time.Duration) []budgetInput {
+	inputs := make([]budgetInput, n)
+	for i := range inputs {
+		inputs[i] = budgetInput{at: start + time.Duration(i)*every, dt: dt}
+	}
+	return inputs
+}
+
+func TestMovementBudgetAllow(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := []struct {
+		name         string
+		inputs       []budgetInput
+		wantAccepted int
+	}{
+		{
+			name:         "honest player",
+			inputs:       steadyInputs(0, 150, 20*ms, 20*ms),
+			wantAccepted: 150,
+		},
+		{
+			// 30ms of movement every 20ms is 1.5 times too fast.  Only as much gets through as
+			// the three seconds of real time allow, plus the tolerance: about 3.3s, 110 inputs.
+			name:         "speed hack",
+			inputs:       steadyInputs(0, 150, 20*ms, 30*ms),
+			wantAccepted: 110,
+		},
+		{
+			name:         "burst all at once",
+			inputs:       steadyInputs(0, 10, 0, 50*ms),
+			wantAccepted: 2,
+		},
+		{
+			name: "burst then time to refill",
+			inputs: append(steadyInputs(0, 10, 0, 50*ms),
+				budgetInput{at: 200 * ms, dt: 50 * ms},
+				budgetInput{at: 200 * ms, dt: 50 * ms}),
+			wantAccepted: 4,
+		},
+		{
+			// Standing still for ten seconds doesn't bank ten seconds of movement, only the
+			// window's worth plus one max frame (and the tolerance)
+			name: "no banking time while idle",
+			inputs: append([]budgetInput{{at: 0, dt: 20 * ms}},
+				steadyInputs(10*time.Second, 40, 0, 50*ms)...),
+			wantAccepted: 1 + 23,
+		},
+		{
+			name:         "jittery but honest",
+			inputs:       []budgetInput{{0, 20 * ms}, {10 * ms, 20 * ms}, {15 * ms, 20 * ms}, {70 * ms, 20 * ms}, {80 * ms, 20 * ms}},
+			wantAccepted: 5,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			mb := CreateMovementBudget(time.Second, shared.FloatVector{})
+
+			accepted := 0
+			for _, input := range test.inputs {
+				if mb.Allow(start.Add(input.at), input.dt) {
+					accepted++
+				}
+			}
+			if accepted != test.wantAccepted {
+				t.Errorf("%v of %v inputs accepted, wanted %v", accepted, len(test.inputs), test.wantAccepted)
+			}
+		})
+	}
+}
+
+func TestMovementBudgetScore(t *testing.T) {
+	start := time.Now()
+	mb := CreateMovementBudget(time.Second, shared.FloatVector{X: 1, Y: 2})
+
+	if score := mb.AddViolation(start, VIOLATION_WEIGHT_OVERBUDGET); score != 3 {
+		t.Errorf("score %v after one violation, wanted 3", score)
+	}
+	if score := mb.AddViolation(start, VIOLATION_WEIGHT_BAD_DELTA); score != 4 {
+		t.Errorf("score %v after two violations, wanted 4", score)
+	}
+
+	tests := []struct {
+		after time.Duration
+		score float64
+	}{
+		{time.Second, 3},
+		{2500 * time.Millisecond, 1.5},
+		{10 * time.Second, 0},
+	}
+	for _, test := range tests {
+		if score := mb.Score(start.Add(test.after)); score != test.score {
+			t.Errorf("score %v after %v, wanted %v", score, test.after, test.score)
+		}
+	}
+
+	// Only a clean score moves the safe position along
+	mb.AddViolation(start.Add(10*time.Second), 1)
+	mb.RecordPosition(start.Add(10*time.Second), shared.FloatVector{X: 50, Y: 50})
+	if mb.safePosition != (shared.FloatVector{X: 1, Y: 2}) {
+		t.Errorf("safe position moved to %v while the score wasn't clean", mb.safePosition)
+	}
+	mb.RecordPosition(start.Add(12*time.Second), shared.FloatVector{X: 60, Y: 60})
+	if mb.safePosition != (shared.FloatVector{X: 60, Y: 60}) {
+		t.Errorf("safe position %v didn't move once the score was clean", mb.safePosition)
+	}
+
+	mb.AddViolation(start.Add(12*time.Second), 5)
+	mb.Reset(start.Add(12 * time.Second))
+	if score := mb.Score(start.Add(12 * time.Second)); score != 0 {
+		t.Errorf("score %v after a reset", score)
+	}
+}
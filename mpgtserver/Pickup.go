@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+const (
+	// How long a speed boost lasts and how many times faster it makes its player move.  Picking
+	// up another while boosted starts the time over rather than stacking.
+	SPEED_BOOST_TIME   time.Duration = 5 * time.Second
+	SPEED_BOOST_FACTOR float32       = 1.5
+
+	// How much health a health pickup gives back
+	HEALTH_PICKUP_AMOUNT int = 25
+
+	// Points for picking up a score token
+	SCORE_PICKUP_POINTS int = 1
+
+	// How long the pickup at one of the map's placements takes to come back when the map doesn't
+	// say
+	DEFAULT_PICKUP_RESPAWN time.Duration = 15 * time.Second
+
+	// How many random spots are tried when dropping a pickup before giving up until next time
+	PICKUP_DROP_TRIES int = 20
+)
+
+// Something lying in a room's world for players to pick up by running over it
+type Pickup struct {
+	id       int64
+	kind     protocol.PickupKind
+	position shared.FloatVector
+
+	// Which of the map's placements it's at, -1 if it was dropped at random or by an admin
+	placement int
+}
+
+// What each kind of pickup does to whoever runs over it.  Returns false if it wouldn't do them
+// any good, in which case the pickup is left for somebody else.  Called from the room's loop.
+var pickupEffects = map[protocol.PickupKind]func(room *Room, ent *PlayerEntity, now time.Time) bool{
+	protocol.PICKUP_SPEED: func(room *Room, ent *PlayerEntity, now time.Time) bool {
+		room.BoostSpeed(ent, SPEED_BOOST_FACTOR, now.Add(SPEED_BOOST_TIME))
+		return true
+	},
+	protocol.PICKUP_HEALTH: func(room *Room, ent *PlayerEntity, now time.Time) bool {
+		if ent.health >= shared.MAX_HEALTH {
+			return false
+		}
+		ent.health = min(ent.health+HEALTH_PICKUP_AMOUNT, shared.MAX_HEALTH)
+		return true
+	},
+	protocol.PICKUP_SCORE: func(room *Room, ent *PlayerEntity, now time.Time) bool {
+		room.scoreboard.AddScore(ent, SCORE_PICKUP_POINTS)
+		return true
+	},
+}
+
+// The kinds which get dropped at random and can go on a map.  Health is left out: nothing in the
+// game hurts players yet, so a health pickup would only ever sit there.  An admin can still put
+// one down, for anyone whose health was set lower with the "health" command.
+var placedPickupKinds = []protocol.PickupKind{protocol.PICKUP_SPEED, protocol.PICKUP_SCORE}
+
+// Check the name of a pickup kind from a map file or the admin console
+func checkPickupKind(kind string) error {
+	if _, ok := pickupEffects[protocol.PickupKind(kind)]; !ok {
+		names := make([]string, 0, len(protocol.PickupKinds))
+		for _, kind := range protocol.PickupKinds {
+			names = append(names, string(kind))
+		}
+		return fmt.Errorf("unknown pickup kind %q, try %v", kind, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Check the kind of a pickup a map wants placed
+func checkPlacedPickupKind(kind string) error {
+	if err := checkPickupKind(kind); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(placedPickupKinds))
+	for _, placed := range placedPickupKinds {
+		if protocol.PickupKind(kind) == placed {
+			return nil
+		}
+		names = append(names, string(placed))
+	}
+	return fmt.Errorf("%v pickups can't go on maps yet, try %v", kind, strings.Join(names, ", "))
+}
+
+// The square a pickup at the given position takes up
+func pickupRect(pos shared.FloatVector) shared.FloatRect {
+	return shared.FloatRect{X: pos.X, Y: pos.Y, Width: shared.PICKUP_SIZE, Height: shared.PICKUP_SIZE}
+}
+
+// Looks after the pickups in a room's world.  It keeps a pickup at each of the map's placements,
+// bringing it back a while after it's taken, and if the server was started with -pickup-interval
+// it drops a random one somewhere free every so often, up to -max-pickups of them.  The server
+// decides who gets what - a pickup goes to the first entity found over it, in ID order.  Not thread
+// safe - only the room's loop uses it.
+type PickupSpawner struct {
+	gameMap *GameMap
+
+	// Everything lying around right now, oldest first
+	pickups []*Pickup
+
+	// When each of the map's placements gets its pickup back, by placement.  Zero while the
+	// pickup is there.
+	respawnAt []time.Time
+
+	// When the next random pickup is due
+	nextDrop time.Time
+}
+
+// Bring back the pickups which are due, drop a random one if it's time, and hand out every pickup
+// an entity is over.  Called once a tick, after everyone has moved.
+func (ps *PickupSpawner) Update(room *Room, now time.Time) {
+	for i, placement := range ps.gameMap.Pickups {
+		if !ps.respawnAt[i].IsZero() && !now.Before(ps.respawnAt[i]) {
+			ps.respawnAt[i] = time.Time{}
+			ps.add(placement.Kind, placement.Position(), i)
+		}
+	}
+
+	ents := room.spawnedExcept(nil)
+	sort.Slice(ents, func(i, j int) bool { return ents[i].entityId < ents[j].entityId })
+
+	if config.pickupInterval > 0 && !now.Before(ps.nextDrop) {
+		ps.nextDrop = now.Add(config.pickupInterval)
+		ps.drop(ents)
+	}
+
+	kept := ps.pickups[:0]
+	for _, pickup := range ps.pickups {
+		if taker := ps.takerOf(room, pickup, ents, now); taker != nil {
+			gameLog.Info("Pickup taken", logging.PLAYER_ID, taker.entityId, "room", room.name, "kind", pickup.kind)
+			if pickup.placement >= 0 {
+				ps.respawnAt[pickup.placement] = now.Add(ps.gameMap.Pickups[pickup.placement].RespawnTime())
+			}
+			continue
+		}
+		kept = append(kept, pickup)
+	}
+	ps.pickups = kept
+}
+
+// Find the first entity over the pickup which it does some good, and give it to them.  Returns
+// nil if nobody took it.
+func (ps *PickupSpawner) takerOf(room *Room, pickup *Pickup, ents []*PlayerEntity, now time.Time) *PlayerEntity {
+	rect := pickupRect(pickup.position)
+	for _, ent := range ents {
+		if shared.EntityRect(ent.position).Intersects(rect) && pickupEffects[pickup.kind](room, ent, now) {
+			return ent
+		}
+	}
+	return nil
+}
+
+// Drop a pickup of a random kind somewhere free, unless there are already as many random pickups
+// as there can be or nowhere free turns up
+func (ps *PickupSpawner) drop(ents []*PlayerEntity) {
+	dropped := 0
+	for _, pickup := range ps.pickups {
+		if pickup.placement < 0 {
+			dropped++
+		}
+	}
+	if dropped >= config.maxPickups {
+		return
+	}
+
+	for i := 0; i < PICKUP_DROP_TRIES; i++ {
+		pos := shared.FloatVector{
+			X: rand.Float32() * (ps.gameMap.Width - shared.PICKUP_SIZE),
+			Y: rand.Float32() * (ps.gameMap.Height - shared.PICKUP_SIZE),
+		}
+		if ps.isFree(pos, ents) {
+			ps.add(placedPickupKinds[rand.Intn(len(placedPickupKinds))], pos, -1)
+			return
+		}
+	}
+}
+
+// Whether a pickup at the position would be clear of the obstacles, the entities and the other
+// pickups.  Dropping a pickup right on somebody would be a bit of a giveaway.
+func (ps *PickupSpawner) isFree(pos shared.FloatVector, ents []*PlayerEntity) bool {
+	rect := pickupRect(pos)
+	if ps.gameMap.blockedRect(rect) {
+		return false
+	}
+	for _, ent := range ents {
+		if shared.EntityRect(ent.position).Intersects(rect) {
+			return false
+		}
+	}
+	for _, pickup := range ps.pickups {
+		if pickupRect(pickup.position).Intersects(rect) {
+			return false
+		}
+	}
+	return true
+}
+
+// Put a pickup in the world at the given position, which has to be inside the map.  For the
+// admin console - it never comes back once it's taken.
+func (ps *PickupSpawner) Place(kind protocol.PickupKind, pos shared.FloatVector) (*Pickup, error) {
+	if err := checkPickupKind(string(kind)); err != nil {
+		return nil, err
+	}
+	if pos.X < 0 || pos.Y < 0 || pos.X > ps.gameMap.Width-shared.PICKUP_SIZE || pos.Y > ps.gameMap.Height-shared.PICKUP_SIZE {
+		return nil, fmt.Errorf("%v,%v is outside the map", pos.X, pos.Y)
+	}
+	return ps.add(kind, pos, -1), nil
+}
+
+// Put a pickup in the world
+func (ps *PickupSpawner) add(kind protocol.PickupKind, pos shared.FloatVector, placement int) *Pickup {
+	pickup := &Pickup{id: idGen.GetNextId(), kind: kind, position: pos, placement: placement}
+	ps.pickups = append(ps.pickups, pickup)
+	return pickup
+}
+
+// Everything lying around right now, oldest first
+func (ps *PickupSpawner) Pickups() []*Pickup {
+	return ps.pickups
+}
+
+// The pickups in the form they're sent to clients in
+func (ps *PickupSpawner) MessagePickups() []protocol.MessagePickup {
+	msgPickups := make([]protocol.MessagePickup, 0, len(ps.pickups))
+	for _, pickup := range ps.pickups {
+		msgPickups = append(msgPickups, protocol.MessagePickup{Id: pickup.id, Kind: pickup.kind, Position: pickup.position})
+	}
+	return msgPickups
+}
+
+// Create the pickups for a map.  The ones at its placements appear on the first update, and the
+// first random one after -pickup-interval.
+func CreatePickupSpawner(gameMap *GameMap, now time.Time) *PickupSpawner {
+	ps := &PickupSpawner{
+		gameMap:   gameMap,
+		pickups:   make([]*Pickup, 0),
+		respawnAt: make([]time.Time, len(gameMap.Pickups)),
+		nextDrop:  now.Add(config.pickupInterval),
+	}
+	for i := range ps.respawnAt {
+		ps.respawnAt[i] = now
+	}
+	return ps
+}
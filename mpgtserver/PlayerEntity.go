@@ -6,14 +6,55 @@ import (
 	"github.com/gabriel-comeau/multiplayer-game-test/shared"
 )
 
+// How far back in time a player's movement is added up when checking it against real time
+const MOVEMENT_BUDGET_WINDOW time.Duration = time.Second
+
 // A simpler, server-side version of the client-side Unit structure.  This one doesn't worry
-// about textures but does keep track of the owning player's UUID, position and the last acknowledged
-// sequence number.
+// about textures but does keep track of the owning player's UUID and username, position and the
+// last acknowledged sequence number.
 type PlayerEntity struct {
 	entityId    int64
+	username    string
 	position    shared.FloatVector
 	lastSeq     int64
 	lastSeqTime time.Time
+
+	// The team the entity is on in its room, empty if the room has no teams.  Use
+	// Room.ChangeTeam to move it to another.
+	team string
+
+	// False for a brand new entity, which hasn't been given a place in the world yet.  Its room
+	// puts it somewhere at the start of the next tick, before anyone gets to see it.
+	spawned bool
+
+	// Keeps track of how much the player has moved lately, to catch speed hacks
+	budget *MovementBudget
+
+	// How much health the entity has left, out of shared.MAX_HEALTH.  Only health pickups and the
+	// admin "health" command change it for now.
+	health int
+
+	// How the entity moves, leaving aside any speed boost.  Its max speed is the room's speed
+	// unless an admin has changed it.  Use Room.SetMovement so the change gets recorded.
+	movement shared.MovementParams
+
+	// How many times its usual speed the entity moves at, and when its speed boost wears off.
+	// The factor is 1 without a boost.  Use Room.BoostSpeed so the change gets recorded.
+	speedFactor    float32
+	speedBoostEnds time.Time
+
+	// How fast the entity is going and in which direction, in pixels per second.  Each input
+	// steps it forward along with the position, see shared.GetMovement.  Use Room.Knockback to
+	// push the entity so the change gets recorded.
+	velocity shared.FloatVector
+
+	// Set if the entity is a bot, which the server moves itself, nil for a player.  See Bot.go
+	bot *Bot
+}
+
+// How the entity moves right now, speed boost and all
+func (p *PlayerEntity) Movement() shared.MovementParams {
+	return p.movement.Scaled(p.speedFactor)
 }
 
 // Move the entity by a given offset.
@@ -26,11 +67,25 @@ func (p *PlayerEntity) GetTimeOffset(current time.Time) time.Duration {
 	return p.lastSeqTime.Sub(current)
 }
 
-// Create a new entity and return a pointer to it.
-func CreatePlayerEntity(id int64, initialPos shared.FloatVector) *PlayerEntity {
+// Put the entity somewhere else without it having moved there.  It arrives standing still, and the
+// movement budget starts over, or the jump would count against it.
+func (p *PlayerEntity) Teleport(pos shared.FloatVector, now time.Time) {
+	p.position = pos
+	p.velocity = shared.FloatVector{}
+	p.budget.Reset(now)
+	p.budget.safePosition = pos
+}
+
+// Create a new entity and return a pointer to it.  It doesn't have a position until the room it
+// goes into spawns it.
+func CreatePlayerEntity(id int64, username string) *PlayerEntity {
 	return &PlayerEntity{
-		position: initialPos,
-		entityId: id,
-		lastSeq:  0,
+		entityId:    id,
+		username:    username,
+		lastSeq:     0,
+		budget:      CreateMovementBudget(MOVEMENT_BUDGET_WINDOW, shared.FloatVector{}),
+		health:      shared.MAX_HEALTH,
+		movement:    shared.DefaultMovementParams(),
+		speedFactor: 1,
 	}
 }
@@ -0,0 +1,859 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/pathfinding"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+const (
+	// Limits on the settings a client can ask for when creating a room
+	MAX_ROOM_PLAYERS     int = 64
+	MIN_ROOM_TICK_MILLIS int = 10
+	MAX_ROOM_TICK_MILLIS int = 200
+
+	// Slowest and fastest a room can make its players move, in pixels per second
+	MIN_ROOM_SPEED float32 = 50
+	MAX_ROOM_SPEED float32 = 2000
+
+	// Rooms have the same limits on their names as players do on theirs
+	MAX_ROOM_NAME_LENGTH = MAX_USERNAME_LENGTH
+
+	// How often bot paths are sent out with -debug-paths
+	BOT_PATHS_INTERVAL time.Duration = 500 * time.Millisecond
+)
+
+// A Room is one game world.  Each has its own entities, its own queue of input messages and its own
+// loop running in a goroutine, so nothing that happens in one room can be seen from another.  The
+// clients in a room, players and spectators both, are its members - they're the ones who get its
+// world state.
+type Room struct {
+	name string
+
+	// The settings can be changed by an admin while the room runs.  Use Settings / SetSettings.
+	settings     protocol.RoomSettings
+	settingsLock *sync.RWMutex
+
+	// The default room is always there.  Any other room is torn down once it's empty.
+	persistent bool
+
+	entities     *EntityHolder
+	members      *ClientHolder
+	messageQueue *protocol.MessageQueue
+
+	// Work handed to the room's loop from outside, run at the start of the next tick.  Anything
+	// which touches the entities directly has to go through here.  Use Do.
+	tasks     []func()
+	tasksLock *sync.Mutex
+
+	// Finds places for players coming into the room, on the map the room is playing.  Both
+	// change when the room moves on to the next map.  Only used by the room's loop.
+	spawner  *Spawner
+	mapIndex int
+
+	// The rules the room is played by, picked when the room opens and never changed, and where
+	// the room is in its round.  Only used by the room's loop.
+	mode  GameMode
+	round *Round
+
+	// The entities the mode has been told have come into the room, by ID, and the pairs of
+	// entities which were touching at the end of the last tick, lowest ID first.  Kept so the
+	// mode only hears about each arrival, departure and touch once.  Only used by the room's loop.
+	joined   map[int64]*PlayerEntity
+	touching map[[2]int64]bool
+
+	// Everyone's score and the rest of their stats.  Only used by the room's loop.
+	scoreboard *Scoreboard
+
+	// What's lying around the map for players to pick up.  Replaced when the map changes.  Only
+	// used by the room's loop.
+	pickups *PickupSpawner
+
+	// Paths the room's bots have found on the current map, thrown out when the map changes, and
+	// when they were last sent out for -debug-paths.  Only used by the room's loop.
+	paths          *pathfinding.PathCache
+	botPathsSentAt time.Time
+
+	// Writes the room's match to disk if the server was started with -record, nil otherwise
+	recorder *MatchRecorder
+
+	// Set by the RoomHolder when the room is torn down.  Only touched with the RoomHolder locked.
+	closed bool
+}
+
+// The room's loop.  Runs in its own goroutine until the room is torn down.
+func (r *Room) Run() {
+	settings := r.Settings()
+	gameLog.Info("Room opened", "room", r.name, "mode", r.mode.Name(), "max_players", settings.MaxPlayers, "tick_ms", settings.TickMillis, "speed", settings.Speed)
+
+	var tick int64
+	for {
+		// Only the work done in the loop counts towards the tick, not the sleep at the end of it
+		tickStart := time.Now()
+		tick++
+		r.recorder.StartTick(tick)
+
+		r.tick()
+
+		if roomHolder.RemoveIfEmpty(r) {
+			r.writeStats()
+			r.recorder.Close()
+			gameLog.Info("Room closed", "room", r.name)
+			return
+		}
+
+		// Get how long it took to do all of this
+		dt := time.Since(tickStart)
+		metrics.tickDuration.Observe(dt.Seconds())
+
+		// If it took less long than the tick, sleep for the difference, otherwise this ends up
+		// sending A LOT of messages with no changes to the clients.
+		//
+		// Alternatively, we could check to see if the world state has changed and only send it out
+		// when something new has happened.
+		if dt < r.TickInterval() {
+			time.Sleep(r.TickInterval() - dt)
+		}
+	}
+}
+
+// One iteration of the room's loop: apply every input which came in since the last one, move the
+// round along, then send everyone the new world state
+func (r *Room) tick() {
+	r.tasksLock.Lock()
+	tasks := r.tasks
+	r.tasks = nil
+	r.tasksLock.Unlock()
+	for _, task := range tasks {
+		task()
+	}
+	r.noticeLeavers()
+	r.spawnNewEntities()
+	r.noticeJoiners()
+
+	messages := r.messageQueue.PopAll()
+	metrics.messagesPerTick.Observe(float64(len(messages)))
+	for _, message := range messages {
+
+		// The only message expected FROM the client is the move message
+		// so lets look for that one
+		if message.GetMessageType() != protocol.SEND_INPUT_MESSAGE {
+			gameHotLog.Warn("Got an invalid message type from client", logging.MESSAGE_TYPE, message.GetMessageType())
+			continue
+		}
+
+		typed, ok := message.(*protocol.SendInputMessage)
+		if !ok {
+			gameHotLog.Error("Message couldn't be asserted into SendInputMessage")
+			continue
+		}
+
+		ent := r.entities.GetEntity(typed.PlayerId)
+		if ent == nil {
+			continue
+		}
+
+		// An input message which decodes fine can still be missing its input altogether, which
+		// no honest client ever sends
+		if typed.Input == nil {
+			if ent.lastSeqTime.Before(typed.GetRcvdTime()) {
+				ent.lastSeqTime = typed.GetRcvdTime()
+			}
+			r.handleViolation(ent, VIOLATION_WEIGHT_MALFORMED, "input message without any input")
+			metrics.CountRejectedInput("no_input")
+			continue
+		}
+
+		// Based on the client-provided frame delta and the time between recieved messages from
+		// this particular client, we decide if the client is telling the truth or not about
+		// their delta.
+		if !validateMessage(ent, typed) {
+
+			// Still want this to happen even if we reject this message
+			if ent.lastSeqTime.Before(typed.GetRcvdTime()) {
+				ent.lastSeqTime = typed.GetRcvdTime()
+			}
+			r.handleViolation(ent, VIOLATION_WEIGHT_BAD_DELTA, "frame delta longer than time between messages")
+			metrics.CountRejectedInput("bad_delta")
+			continue
+		}
+
+		// A delta outside the sane range gets clamped so the move can still go through, but
+		// it shouldn't have been sent in the first place
+		clampedDt := clampDeltaTime(typed.Dt)
+		if clampedDt != typed.Dt {
+			r.handleViolation(ent, VIOLATION_WEIGHT_BAD_DELTA, "frame delta out of range")
+		}
+
+		// Even if every message looks fine on its own, the deltas can't add up to more time
+		// than has really passed
+		if !ent.budget.Allow(typed.GetRcvdTime(), clampedDt.Duration) {
+			if ent.lastSeqTime.Before(typed.GetRcvdTime()) {
+				ent.lastSeqTime = typed.GetRcvdTime()
+			}
+			r.handleViolation(ent, VIOLATION_WEIGHT_OVERBUDGET, "movement budget exceeded")
+			metrics.CountRejectedInput("over_budget")
+			continue
+		}
+
+		// Get the vector for the move
+		moveVec := shared.GetMovement(typed.Input, clampedDt, ent.Movement(), &ent.velocity)
+
+		// Get the seq
+		seq := typed.Seq
+
+		// Move the unit
+		ent.Move(moveVec)
+		r.scoreboard.AddDistance(ent, moveVec)
+		ent.budget.RecordPosition(typed.GetRcvdTime(), ent.position)
+		r.recorder.RecordInput(typed, clampedDt)
+
+		// Apply the new last sequence number and rcvd time
+		if ent.lastSeq < seq {
+			ent.lastSeq = seq
+		}
+		if ent.lastSeqTime.Before(typed.GetRcvdTime()) {
+			ent.lastSeqTime = typed.GetRcvdTime()
+		}
+	}
+
+	now := time.Now()
+	r.moveBots(now)
+	r.updatePickups(now)
+	r.detectTouches()
+	r.updateRound(now)
+	r.updateScoreboard(now)
+	r.sendBotPaths(now)
+
+	// OK, all messages processed for this tick, send out an entity message
+	// We'll take stock of where all the entities are and send out an updated world state.  Players
+	// can join and leave from other goroutines, so the recording gets the world state before
+	// anyone else can come or go - otherwise a keyframe could miss a player whose join is already
+	// in the recording, or have one whose leave is.
+	msgEnts := make([]protocol.MessageEntity, 0)
+	r.entities.View(func(entities []*PlayerEntity) {
+		for _, ent := range entities {
+			msgEnt := protocol.CreateMessageEntity(ent.entityId, ent.username, ent.team, ent.position, ent.lastSeq)
+			msgEnt.Health = ent.health
+			msgEnt.Movement = ent.Movement()
+			msgEnt.Velocity = ent.velocity
+			msgEnts = append(msgEnts, msgEnt)
+		}
+		r.recorder.EndTick(msgEnts)
+	})
+
+	worldStateMessage := protocol.CreateWorldStateMessage(msgEnts, r.pickups.MessagePickups())
+	r.Broadcast(worldStateMessage)
+}
+
+// Let every bot which has been spawned decide on its move and make it.  Bots get moved exactly the
+// way players do, just without the checks, since the server can trust itself.
+func (r *Room) moveBots(now time.Time) {
+	ents := r.entities.GetEntities()
+	sort.Slice(ents, func(i, j int) bool { return ents[i].entityId < ents[j].entityId })
+
+	for _, ent := range ents {
+		if ent.bot == nil || !ent.spawned {
+			continue
+		}
+
+		input := ent.bot.NextInput(r, ent, now)
+		dt := clampDeltaTime(input.Dt)
+		moveVec := shared.GetMovement(input.Input, dt, ent.Movement(), &ent.velocity)
+
+		ent.Move(moveVec)
+		r.scoreboard.AddDistance(ent, moveVec)
+		r.recorder.RecordInput(input, dt)
+		ent.lastSeq = input.Seq
+	}
+}
+
+// Wear off every speed boost whose time is up, then let the pickups take care of themselves
+func (r *Room) updatePickups(now time.Time) {
+	for _, ent := range r.entities.GetEntities() {
+		if ent.speedFactor != 1 && !now.Before(ent.speedBoostEnds) {
+			r.BoostSpeed(ent, 1, time.Time{})
+		}
+	}
+	r.pickups.Update(r, now)
+}
+
+// Make an entity move at factor times its usual speed until the given time, or back to normal
+// with a factor of 1.  Only call this from the room's loop.
+func (r *Room) BoostSpeed(ent *PlayerEntity, factor float32, until time.Time) {
+	changed := ent.speedFactor != factor
+	ent.speedFactor, ent.speedBoostEnds = factor, until
+	if changed {
+		r.recorder.RecordMovement(ent)
+	}
+}
+
+// Change the way an entity moves.  Only call this from the room's loop.
+func (r *Room) SetMovement(ent *PlayerEntity, movement shared.MovementParams) {
+	ent.movement = movement
+	r.recorder.RecordMovement(ent)
+}
+
+// Give an entity a push, adding the impulse (in pixels per second) to its velocity.  Its own
+// friction and drag slow it back down over the next few inputs.  Only call this from the room's
+// loop.
+func (r *Room) Knockback(ent *PlayerEntity, impulse shared.FloatVector) {
+	ent.velocity = shared.ClampVelocity(ent.velocity.Plus(impulse))
+	r.recorder.RecordKnockback(ent)
+}
+
+// Put a bot in the room, driven by the behavior.  It gets spawned at the start of the next tick
+// like a player would.  Safe to call from any goroutine.
+func (r *Room) AddBot(behavior BotBehavior) *PlayerEntity {
+	ent := CreateBotEntity(idGen.GetNextId(), behavior)
+	r.entities.AddEntity(ent)
+	gameLog.Info("Bot added", logging.PLAYER_ID, ent.entityId, "room", r.name, "behavior", behavior.Name())
+	return ent
+}
+
+// Count a violation against a player and, once their score is over the configured threshold,
+// respond the way the server is set up to.  The offending input has already been dropped by the
+// time this gets called.
+func (r *Room) handleViolation(ent *PlayerEntity, weight float64, reason string) {
+	now := time.Now()
+	score := ent.budget.AddViolation(now, weight)
+	validationLog.Info("Violation", logging.PLAYER_ID, ent.entityId, "reason", reason, "score", score)
+
+	if score < config.cheatThreshold {
+		return
+	}
+
+	switch config.cheatResponse {
+	case "rubberband":
+		validationLog.Warn("Rubber-banding player", logging.PLAYER_ID, ent.entityId, "x", ent.budget.safePosition.X, "y", ent.budget.safePosition.Y)
+		ent.Teleport(ent.budget.safePosition, now)
+		r.recorder.RecordTeleport(ent)
+	case "kick":
+		kickPlayer(ent.entityId, "kicked for moving too fast")
+	case "ban":
+		banPlayer(ent.entityId, "banned for moving too fast", config.cheatBanDuration)
+	}
+}
+
+// Queue up a message from one of the room's members for the next tick
+func (r *Room) PushMessage(msg protocol.Message) {
+	r.messageQueue.PushMessage(msg)
+}
+
+// Send a message to everyone in the room
+func (r *Room) Broadcast(msg protocol.Message) {
+	encoded := msg.Encode()
+	for _, c := range r.members.GetClients() {
+		c.conn.Write(encoded)
+		metrics.CountSent(msg.GetMessageType(), len(encoded))
+	}
+}
+
+// Give every entity which has just come into the room a place in the world.  Runs at the start of
+// a tick so nobody gets to see a player before it has been put somewhere.
+func (r *Room) spawnNewEntities() {
+	placed := make([]*PlayerEntity, 0)
+	fresh := make([]*PlayerEntity, 0)
+	for _, ent := range r.entities.GetEntities() {
+		if ent.spawned {
+			placed = append(placed, ent)
+		} else {
+			fresh = append(fresh, ent)
+		}
+	}
+
+	// Whoever came in first gets first pick
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i].entityId < fresh[j].entityId })
+	for _, ent := range fresh {
+		if len(r.mode.Teams()) > 0 {
+			r.setTeam(ent, r.smallestTeam())
+		}
+
+		ent.position = r.spawner.Place(ent.team, placed)
+		ent.velocity = shared.FloatVector{}
+		ent.budget.safePosition = ent.position
+		ent.spawned = true
+		r.recorder.RecordTeleport(ent)
+		placed = append(placed, ent)
+
+		// Everyone moves at the room's speed to begin with
+		movement := ent.movement
+		movement.MaxSpeed = r.Settings().Speed
+		r.SetMovement(ent, movement)
+
+		gameLog.Debug("Player spawned", logging.PLAYER_ID, ent.entityId, "room", r.name, "x", ent.position.X, "y", ent.position.Y)
+	}
+}
+
+// Move a player to another team, and back to one of that team's spawns.  Unless it's forced, the
+// move is refused if it would put the new team more than -team-max-imbalance players ahead of the
+// smallest one.  Only call this from the room's loop.
+func (r *Room) ChangeTeam(ent *PlayerEntity, team string, forced bool) error {
+	if len(r.mode.Teams()) == 0 {
+		return fmt.Errorf("there are no teams in %v", r.name)
+	}
+	if !hasTeam(r.mode, team) {
+		return fmt.Errorf("there's no %v team, try %v", team, strings.Join(r.mode.Teams(), " or "))
+	}
+	if ent.team == team {
+		return fmt.Errorf("already on the %v team", team)
+	}
+
+	if !forced {
+		counts := r.teamCounts()
+		counts[ent.team]--
+		counts[team]++
+		for _, other := range r.mode.Teams() {
+			if counts[team]-counts[other] > config.teamMaxImbalance {
+				return fmt.Errorf("the %v team has too many players already", team)
+			}
+		}
+	}
+
+	r.setTeam(ent, team)
+	ent.Teleport(r.spawner.Place(ent.team, r.spawnedExcept(ent)), time.Now())
+	r.recorder.RecordTeleport(ent)
+	return nil
+}
+
+// Put a player on a team, letting everything which cares know about it
+func (r *Room) setTeam(ent *PlayerEntity, team string) {
+	old := ent.team
+	ent.team = team
+	if client := r.members.GetClient(ent.entityId); client != nil {
+		client.SetTeam(team)
+	}
+
+	r.recorder.RecordTeam(ent)
+	r.mode.OnEvent(r, GameEvent{Type: GAME_EVENT_TEAM_CHANGED, Entity: ent, OldTeam: old})
+}
+
+// Tell the mode about the players who have gone since the last tick
+func (r *Room) noticeLeavers() {
+	for id, ent := range r.joined {
+		if r.entities.GetEntity(id) != ent {
+			delete(r.joined, id)
+			r.scoreboard.Leave(ent, time.Now())
+			r.mode.OnPlayerLeave(r, ent)
+		}
+	}
+}
+
+// Tell the mode about the players who have come in since the last tick.  They've been spawned by
+// this point.
+func (r *Room) noticeJoiners() {
+	ents := r.entities.GetEntities()
+	sort.Slice(ents, func(i, j int) bool { return ents[i].entityId < ents[j].entityId })
+	for _, ent := range ents {
+		if r.joined[ent.entityId] != ent {
+			r.joined[ent.entityId] = ent
+			r.scoreboard.Join(ent, time.Now())
+			r.mode.OnPlayerJoin(r, ent)
+		}
+	}
+}
+
+// Tell the mode about every pair of players who have run into each other this tick
+func (r *Room) detectTouches() {
+	ents := r.spawnedExcept(nil)
+	sort.Slice(ents, func(i, j int) bool { return ents[i].entityId < ents[j].entityId })
+
+	touching := make(map[[2]int64]bool)
+	for i, a := range ents {
+		for _, b := range ents[i+1:] {
+			if !overlaps(a.position, b.position) {
+				continue
+			}
+
+			pair := [2]int64{a.entityId, b.entityId}
+			touching[pair] = true
+			if !r.touching[pair] {
+				r.mode.OnEvent(r, GameEvent{Type: GAME_EVENT_TOUCH, Entity: a, Other: b})
+				r.bounceApart(a, b)
+			}
+		}
+	}
+	r.touching = touching
+}
+
+// Knock two entities which have just run into each other away from each other, as hard as
+// -knockback says.  Two entities right on top of each other get pushed apart sideways.
+func (r *Room) bounceApart(a, b *PlayerEntity) {
+	if config.knockback == 0 {
+		return
+	}
+
+	dx, dy := float64(a.position.X-b.position.X), float64(a.position.Y-b.position.Y)
+	distance := math.Hypot(dx, dy)
+	if distance == 0 {
+		dx, distance = 1, 1
+	}
+
+	impulse := shared.FloatVector{X: float32(dx / distance * config.knockback), Y: float32(dy / distance * config.knockback)}
+	r.Knockback(a, impulse)
+	r.Knockback(b, shared.FloatVector{X: -impulse.X, Y: -impulse.Y})
+}
+
+// Move the round on to its next state if it's time to, and keep the members up to date with it.
+// A round goes from warmup, which waits for enough players and then counts down, to being played,
+// to showing the result, to moving on to the next map, and back to warmup.
+func (r *Room) updateRound(now time.Time) {
+	players := r.countPlayers()
+
+	switch r.round.state {
+	case protocol.ROUND_STATE_WARMUP:
+		switch {
+		case players < r.mode.MinPlayers():
+			// Not enough players, so there's no countdown until there are
+			if !r.round.ends.IsZero() {
+				r.setRoundState(protocol.ROUND_STATE_WARMUP, 0, now)
+			}
+		case r.round.ends.IsZero():
+			r.setRoundState(protocol.ROUND_STATE_WARMUP, config.warmupTime, now)
+		case r.round.TimeUp(now):
+			r.startRound(now)
+		}
+
+	case protocol.ROUND_STATE_IN_PROGRESS:
+		r.mode.OnTick(r, now)
+
+		if players < r.mode.MinPlayers() {
+			r.endRound("", now)
+			break
+		}
+		timeUp := r.round.TimeUp(now)
+		if winner, over := r.mode.CheckWinCondition(r, timeUp); over || timeUp {
+			r.endRound(winner, now)
+		}
+
+	case protocol.ROUND_STATE_POST_ROUND:
+		if r.round.TimeUp(now) {
+			r.changeMap(now)
+		}
+
+	case protocol.ROUND_STATE_MAP_CHANGE:
+		if r.round.TimeUp(now) {
+			r.round.winner = ""
+			r.setRoundState(protocol.ROUND_STATE_WARMUP, 0, now)
+		}
+	}
+
+	if r.round.DueToSend(now) {
+		r.Broadcast(r.round.Message(r.mode.Name(), now))
+	}
+}
+
+// Start a round, with everyone back at a spawn
+func (r *Room) startRound(now time.Time) {
+	r.round.number++
+	r.round.winner = ""
+	r.respawnAll(now)
+	r.setRoundState(protocol.ROUND_STATE_IN_PROGRESS, r.mode.TimeLimit(), now)
+	gameLog.Info("Round started", "room", r.name, "round", r.round.number, "mode", r.mode.Name(), "players", len(r.entities.GetEntities()))
+
+	r.mode.OnEvent(r, GameEvent{Type: GAME_EVENT_ROUND_STARTED})
+}
+
+// Finish the round and show who won it, if anyone did
+func (r *Room) endRound(winner string, now time.Time) {
+	r.round.winner = winner
+	r.round.status = ""
+	r.setRoundState(protocol.ROUND_STATE_POST_ROUND, config.postRoundTime, now)
+	gameLog.Info("Round over", "room", r.name, "round", r.round.number, "winner", winner)
+
+	r.mode.OnEvent(r, GameEvent{Type: GAME_EVENT_ROUND_ENDED})
+}
+
+// Move on to the next map in the rotation and put everyone at one of its spawns.  With only one
+// map this just gives everyone a fresh start.
+func (r *Room) changeMap(now time.Time) {
+	r.mapIndex = (r.mapIndex + 1) % len(gameMaps)
+	r.spawner = CreateSpawner(gameMaps[r.mapIndex], config.spawnStrategy)
+	r.pickups = CreatePickupSpawner(gameMaps[r.mapIndex], now)
+	r.paths.Invalidate()
+	r.respawnAll(now)
+	r.setRoundState(protocol.ROUND_STATE_MAP_CHANGE, config.mapChangeTime, now)
+	gameLog.Info("Map changed", "room", r.name, "map", gameMaps[r.mapIndex].Name)
+}
+
+// Put the round in another state and tell everyone straight away
+func (r *Room) setRoundState(state protocol.RoundState, length time.Duration, now time.Time) {
+	r.round.Set(state, length, now)
+	r.Broadcast(r.round.Message(r.mode.Name(), now))
+}
+
+// Put every player who has already been spawned back at a spawn, in the order they came in
+func (r *Room) respawnAll(now time.Time) {
+	ents := r.spawnedExcept(nil)
+	sort.Slice(ents, func(i, j int) bool { return ents[i].entityId < ents[j].entityId })
+
+	placed := make([]*PlayerEntity, 0, len(ents))
+	for _, ent := range ents {
+		ent.Teleport(r.spawner.Place(ent.team, placed), now)
+		r.recorder.RecordTeleport(ent)
+		placed = append(placed, ent)
+	}
+}
+
+// Every so often, sample the players' round trip times and send everyone the scoreboard
+func (r *Room) updateScoreboard(now time.Time) {
+	if !r.scoreboard.DueToSend(now) {
+		return
+	}
+
+	for _, c := range r.members.GetClients() {
+		if !c.spectator {
+			r.scoreboard.SampleRTT(c.clientId, c.GetRTT())
+		}
+	}
+	r.Broadcast(r.scoreboard.Message(now))
+}
+
+// If the server was started with -debug-paths, every so often send everyone the paths the bots
+// are following and where the map's obstacles are, so the client can draw them
+func (r *Room) sendBotPaths(now time.Time) {
+	if !config.debugPaths || now.Sub(r.botPathsSentAt) < BOT_PATHS_INTERVAL {
+		return
+	}
+	r.botPathsSentAt = now
+
+	paths := make([]protocol.BotPath, 0)
+	for _, ent := range r.entities.GetEntities() {
+		if ent.bot != nil && ent.spawned && len(ent.bot.Path()) > 0 {
+			paths = append(paths, protocol.BotPath{Id: ent.entityId, Points: ent.bot.Path()})
+		}
+	}
+	r.Broadcast(protocol.CreateBotPathsMessage(paths, r.spawner.gameMap.Obstacles))
+}
+
+// Write the room's stats to a file in the -stats directory, if there is one.  Called when the
+// room's match is over, which is when the room closes or the server shuts down.  Only call this
+// from the room's loop.
+func (r *Room) writeStats() {
+	if config.statsPath == "" {
+		return
+	}
+
+	r.noticeLeavers()
+	now := time.Now()
+	path := filepath.Join(config.statsPath, fmt.Sprintf("%v-%v.json", r.name, now.Format("20060102-150405")))
+	if err := r.scoreboard.WriteFile(path, r.name, r.mode.Name(), now); err != nil {
+		gameLog.Error("Couldn't write stats", "room", r.name, "path", path, logging.ERROR, err)
+		return
+	}
+	gameLog.Info("Stats written", "room", r.name, "path", path)
+}
+
+// Change what the room's members are told by the game mode, like who is "it" in tag.  Only call
+// this from the room's loop.
+func (r *Room) SetRoundStatus(status string) {
+	if status == r.round.status {
+		return
+	}
+	r.round.status = status
+	r.Broadcast(r.round.Message(r.mode.Name(), time.Now()))
+}
+
+// Where the room is in its round.  Only call this from the room's loop.
+func (r *Room) RoundState() protocol.RoundState {
+	return r.round.state
+}
+
+// How many players are on each of the room's teams
+func (r *Room) teamCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, ent := range r.entities.GetEntities() {
+		if ent.team != "" {
+			counts[ent.team]++
+		}
+	}
+	return counts
+}
+
+// The team with the fewest players, the first one listed if there's a tie
+func (r *Room) smallestTeam() string {
+	counts := r.teamCounts()
+	smallest := ""
+	for _, team := range r.mode.Teams() {
+		if smallest == "" || counts[team] < counts[smallest] {
+			smallest = team
+		}
+	}
+	return smallest
+}
+
+// How many people are playing in the room: bots don't count, and neither does anyone who hasn't
+// been spawned yet
+func (r *Room) countPlayers() int {
+	players := 0
+	for _, ent := range r.spawnedExcept(nil) {
+		if ent.bot == nil {
+			players++
+		}
+	}
+	return players
+}
+
+// Every entity which has been put somewhere in the world, apart from the given one, which can be
+// nil
+func (r *Room) spawnedExcept(except *PlayerEntity) []*PlayerEntity {
+	spawned := make([]*PlayerEntity, 0)
+	for _, ent := range r.entities.GetEntities() {
+		if ent.spawned && ent != except {
+			spawned = append(spawned, ent)
+		}
+	}
+	return spawned
+}
+
+// Hand a function to the room's loop, to be run at the start of the next tick
+func (r *Room) Do(task func()) {
+	r.tasksLock.Lock()
+	defer r.tasksLock.Unlock()
+	r.tasks = append(r.tasks, task)
+}
+
+// Get the room's current settings
+func (r *Room) Settings() protocol.RoomSettings {
+	r.settingsLock.RLock()
+	defer r.settingsLock.RUnlock()
+	return r.settings
+}
+
+// Change the room's settings while it runs.  They should have been through normalizeRoomSettings
+// already.  Everyone in the room is told, and a new speed is given to every entity in the room,
+// overriding any an admin gave them.  The mode stays the one the room opened with.
+func (r *Room) SetSettings(settings protocol.RoomSettings) {
+	r.settingsLock.Lock()
+	settings.Mode = r.settings.Mode
+	oldSpeed := r.settings.Speed
+	r.settings = settings
+	r.settingsLock.Unlock()
+
+	if settings.Speed != oldSpeed {
+		r.Do(func() {
+			for _, ent := range r.spawnedExcept(nil) {
+				movement := ent.movement
+				movement.MaxSpeed = settings.Speed
+				r.SetMovement(ent, movement)
+			}
+		})
+	}
+
+	r.recorder.RecordSettings(settings)
+	r.Broadcast(protocol.CreateRoomChangedMessage(r.name, "", settings, r.mode.Teams()))
+
+	// Reconnecting players get the room back the way it is now, if it was torn down meanwhile
+	for _, c := range r.members.GetClients() {
+		if !c.spectator {
+			sessionHolder.SetRoom(c.sessionToken, r, nil)
+		}
+	}
+}
+
+// How long each tick of the room's loop should take
+func (r *Room) TickInterval() time.Duration {
+	return time.Duration(r.Settings().TickMillis) * time.Millisecond
+}
+
+// Whether another player would go over the room's limit.  Bots don't take up player slots.
+func (r *Room) IsFull() bool {
+	maxPlayers := r.Settings().MaxPlayers
+	if maxPlayers == 0 {
+		return false
+	}
+
+	return r.PlayerCount() >= maxPlayers
+}
+
+// How many players have entities in the room, not counting bots.  Safe to call from any goroutine.
+func (r *Room) PlayerCount() int {
+	count := 0
+	for _, ent := range r.entities.GetEntities() {
+		if ent.bot == nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Describe the room for a RoomListMessage
+func (r *Room) Info() protocol.RoomInfo {
+	return protocol.CreateRoomInfo(r.name, r.PlayerCount(), r.Settings())
+}
+
+// Check the settings a client asked for and fill in the defaults.  Returns an error describing the
+// problem if they're out of range.
+func normalizeRoomSettings(settings protocol.RoomSettings) (protocol.RoomSettings, error) {
+	if settings.MaxPlayers < 0 || settings.MaxPlayers > MAX_ROOM_PLAYERS {
+		return settings, fmt.Errorf("max players must be between 0 and %v", MAX_ROOM_PLAYERS)
+	}
+
+	if settings.TickMillis == 0 {
+		settings.TickMillis = int(SLEEP_TIME / time.Millisecond)
+	}
+	if settings.TickMillis < MIN_ROOM_TICK_MILLIS || settings.TickMillis > MAX_ROOM_TICK_MILLIS {
+		return settings, fmt.Errorf("tick must be between %vms and %vms", MIN_ROOM_TICK_MILLIS, MAX_ROOM_TICK_MILLIS)
+	}
+
+	if settings.Speed == 0 {
+		settings.Speed = shared.SPEED
+	}
+	if settings.Speed < MIN_ROOM_SPEED || settings.Speed > MAX_ROOM_SPEED {
+		return settings, fmt.Errorf("speed must be between %v and %v", MIN_ROOM_SPEED, MAX_ROOM_SPEED)
+	}
+
+	if settings.Mode == "" {
+		settings.Mode = DEFAULT_GAME_MODE
+	}
+	if err := checkGameMode(settings.Mode); err != nil {
+		return settings, err
+	}
+
+	return settings, nil
+}
+
+// Create a new room, starting its recording if the server is recording matches.  The room's loop
+// isn't started - that's up to the RoomHolder.
+func CreateRoom(name string, settings protocol.RoomSettings, persistent bool) *Room {
+	room := &Room{
+		name:         name,
+		settings:     settings,
+		settingsLock: new(sync.RWMutex),
+		persistent:   persistent,
+		entities:     CreateEntityHolder(),
+		members:      CreateClientHolder(),
+		messageQueue: protocol.CreateMessageQueue(),
+		tasksLock:    new(sync.Mutex),
+		spawner:      CreateSpawner(gameMaps[0], config.spawnStrategy),
+		pickups:      CreatePickupSpawner(gameMaps[0], time.Now()),
+		mode:         CreateGameMode(settings.Mode),
+		round:        CreateRound(),
+		joined:       make(map[int64]*PlayerEntity),
+		touching:     make(map[[2]int64]bool),
+		scoreboard:   CreateScoreboard(),
+		paths:        pathfinding.CreatePathCache(),
+	}
+
+	if config.recordPath != "" {
+		path := filepath.Join(config.recordPath, fmt.Sprintf("%v-%v.rec", name, time.Now().Format("20060102-150405")))
+		recorder, err := CreateMatchRecorder(path, room.entities, settings)
+		if err != nil {
+			gameLog.Error("Couldn't start recording", "room", name, logging.ERROR, err)
+		} else {
+			gameLog.Info("Recording room", "room", name, "path", path)
+			room.recorder = recorder
+		}
+	}
+
+	return room
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+)
+
+// What Move does about the room it's asked to move a client into
+type RoomEntryMode int
+
+const (
+	// The room has to exist already
+	ROOM_JOIN_EXISTING RoomEntryMode = iota
+
+	// The room must not exist yet, it gets created with the given settings
+	ROOM_CREATE
+
+	// Join the room if it exists, create it with the given settings if it doesn't.  Used to put
+	// a reconnecting player back in a room which was torn down while they were away.
+	ROOM_JOIN_OR_CREATE
+)
+
+var (
+	ErrNoSuchRoom    = errors.New("no such room")
+	ErrRoomExists    = errors.New("a room with that name already exists")
+	ErrRoomFull      = errors.New("room is full")
+	ErrTooManyRooms  = errors.New("too many rooms")
+	ErrAlreadyInRoom = errors.New("already in that room")
+)
+
+// Thread safe store of the open rooms, keyed by name.  Everything which moves clients in and out
+// of rooms or opens and closes them goes through here, under the one lock, so a room can't be torn
+// down at the same moment someone is walking into it.
+type RoomHolder struct {
+	lock  *sync.Mutex
+	rooms map[string]*Room
+	max   int
+}
+
+// Move a client into a room, out of whichever room it's in now.  Players bring the entity they'll
+// have in the new room, spectators pass nil.  If the move can't be made the client stays where it
+// was and the error says why.
+func (rh *RoomHolder) Move(client *Client, entity *PlayerEntity, name string, mode RoomEntryMode, settings protocol.RoomSettings) (*Room, error) {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	room, exists := rh.rooms[name]
+	switch {
+	case exists && mode == ROOM_CREATE:
+		return nil, ErrRoomExists
+	case !exists && mode == ROOM_JOIN_EXISTING:
+		return nil, ErrNoSuchRoom
+	case !exists && len(rh.rooms) >= rh.max:
+		return nil, ErrTooManyRooms
+	case !exists:
+		room = rh.open(name, settings, false)
+	}
+
+	if client.GetRoom() == room {
+		return nil, ErrAlreadyInRoom
+	}
+	// A reconnecting player whose old connection hasn't been cleaned up yet is already counted
+	if entity != nil && room.entities.GetEntity(entity.entityId) == nil && room.IsFull() {
+		return nil, ErrRoomFull
+	}
+
+	rh.leave(client, true)
+	room.members.AddClient(client)
+	if entity != nil {
+		// A fresh entity gets its team when it spawns.  One coming back with a reconnecting
+		// player already has it.
+		client.SetTeam(entity.team)
+		room.entities.AddEntity(entity)
+	}
+	client.SetRoom(room)
+
+	return room, nil
+}
+
+// Take a client out of its room, if it's in one.  If withEntity is false the player's entity is
+// left behind, for when a reconnected client has already taken it over.
+func (rh *RoomHolder) Leave(client *Client, withEntity bool) {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+	rh.leave(client, withEntity)
+}
+
+// Called by a room's loop after every tick.  If the room isn't persistent and nobody is in it any
+// more it's torn down, and true is returned to tell the loop to stop.  Bots don't keep a room open
+// on their own.
+func (rh *RoomHolder) RemoveIfEmpty(room *Room) bool {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+
+	if room.persistent || len(room.members.GetClients()) > 0 || room.PlayerCount() > 0 {
+		return false
+	}
+
+	delete(rh.rooms, room.name)
+	room.closed = true
+	return true
+}
+
+// Open a room which never gets torn down, used for the default room every player starts in
+func (rh *RoomHolder) OpenPersistent(name string, settings protocol.RoomSettings) *Room {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+	return rh.open(name, settings, true)
+}
+
+// Get a room by name.  Returns nil if there's no such room open.
+func (rh *RoomHolder) GetRoom(name string) *Room {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+	return rh.rooms[name]
+}
+
+// Get all of the rooms as a slice
+func (rh *RoomHolder) GetRooms() []*Room {
+	rh.lock.Lock()
+	defer rh.lock.Unlock()
+	rSlice := make([]*Room, 0, len(rh.rooms))
+	for _, room := range rh.rooms {
+		rSlice = append(rSlice, room)
+	}
+
+	return rSlice
+}
+
+// Describe all of the rooms for a RoomListMessage, sorted by name
+func (rh *RoomHolder) List() []protocol.RoomInfo {
+	infos := make([]protocol.RoomInfo, 0)
+	for _, room := range rh.GetRooms() {
+		infos = append(infos, room.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	return infos
+}
+
+// Create a room and start its loop.  Must be called with the lock held.
+func (rh *RoomHolder) open(name string, settings protocol.RoomSettings, persistent bool) *Room {
+	room := CreateRoom(name, settings, persistent)
+	rh.rooms[name] = room
+	go room.Run()
+
+	return room
+}
+
+// Take a client out of its room.  Must be called with the lock held.
+func (rh *RoomHolder) leave(client *Client, withEntity bool) {
+	room := client.GetRoom()
+	if room == nil {
+		return
+	}
+
+	room.members.RemoveClient(client)
+	if withEntity && !client.spectator {
+		room.entities.RemoveEntity(client.clientId)
+	}
+	client.SetRoom(nil)
+	client.SetTeam("")
+}
+
+// Check a room name a client asked for
+func checkRoomName(name string) error {
+	if name == "" {
+		return errors.New("room name can't be empty")
+	}
+	if len(name) > MAX_ROOM_NAME_LENGTH {
+		return fmt.Errorf("room name longer than %v characters", MAX_ROOM_NAME_LENGTH)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return errors.New("room names can only have letters, numbers, - and _")
+		}
+	}
+
+	return nil
+}
+
+// Constructor to init the holder.  No more than max rooms can be open at once.
+func CreateRoomHolder(max int) *RoomHolder {
+	return &RoomHolder{
+		lock:  new(sync.Mutex),
+		rooms: make(map[string]*Room),
+		max:   max,
+	}
+}
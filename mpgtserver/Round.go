@@ -0,0 +1,72 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// How often a room sends its round state to its members when nothing has changed, so newcomers
+// find out what's going on and everyone's countdown stays in step
+const ROUND_STATE_INTERVAL time.Duration = time.Second
+
+// Where a room is in its round, and what its members are told about it.  Not thread safe - only
+// the room's loop uses it.
+type Round struct {
+	// Counts up from 1 for each round the room has started.  0 until the first one starts.
+	number int
+
+	state protocol.RoundState
+
+	// When the state is up, zero if it lasts until something happens rather than for a set time
+	ends time.Time
+
+	// Who won the last round, empty if nobody did.  Only meaningful after it's over.
+	winner string
+
+	// Whatever the game mode wants players to know.  Set with Room.SetRoundStatus.
+	status string
+
+	// When the state was last sent to the room's members
+	lastSent time.Time
+}
+
+// Move on to another state, lasting the given time or, with zero, until something happens
+func (r *Round) Set(state protocol.RoundState, length time.Duration, now time.Time) {
+	r.state = state
+	r.ends = time.Time{}
+	if length > 0 {
+		r.ends = now.Add(length)
+	}
+}
+
+// Whether the state has a time limit and it has passed
+func (r *Round) TimeUp(now time.Time) bool {
+	return !r.ends.IsZero() && !now.Before(r.ends)
+}
+
+// How long the state has left, zero if it has no time limit
+func (r *Round) Remaining(now time.Time) time.Duration {
+	if r.ends.IsZero() || now.After(r.ends) {
+		return 0
+	}
+	return r.ends.Sub(now)
+}
+
+// Whether it's time to send the state to the room's members again, because nothing has been sent
+// for a while
+func (r *Round) DueToSend(now time.Time) bool {
+	return now.Sub(r.lastSent) >= ROUND_STATE_INTERVAL
+}
+
+// Build the message telling the room's members about the round, and note that it's been sent
+func (r *Round) Message(mode string, now time.Time) *protocol.RoundStateMessage {
+	r.lastSent = now
+	return protocol.CreateRoundStateMessage(mode, r.number, r.state, shared.MDuration{Duration: r.Remaining(now)}, r.winner, r.status)
+}
+
+// Constructor for a room's round, which starts out in warmup
+func CreateRound() *Round {
+	return &Round{state: protocol.ROUND_STATE_WARMUP}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// How often a room sends its scoreboard to its members, which is also how often it samples their
+// round trip times for it
+const SCOREBOARD_INTERVAL time.Duration = 2 * time.Second
+
+// Everything a room keeps count of for one player.  The counts carry on if the player leaves and
+// comes back.
+type PlayerStats struct {
+	// The player's entity, for their ID, name and team.  It's left as it was once they've gone.
+	entity *PlayerEntity
+
+	score  int
+	kills  int
+	deaths int
+
+	// Pixels moved by the player's own inputs
+	distance float64
+
+	// Time spent in the room before the last time the player came in, and when that was.  since is
+	// zero while they're away.
+	connected time.Duration
+	since     time.Time
+
+	// Round trip times sampled while the player was in the room, for the average
+	rttTotal   time.Duration
+	rttSamples int
+}
+
+// How long the player has spent in the room, up to now if they're still there
+func (ps *PlayerStats) Connected(now time.Time) time.Duration {
+	if ps.since.IsZero() {
+		return ps.connected
+	}
+	return ps.connected + now.Sub(ps.since)
+}
+
+// The player's average round trip time, zero if it was never sampled
+func (ps *PlayerStats) AverageRTT() time.Duration {
+	if ps.rttSamples == 0 {
+		return 0
+	}
+	return ps.rttTotal / time.Duration(ps.rttSamples)
+}
+
+// Turn the stats into a line of the scoreboard
+func (ps *PlayerStats) Entry(now time.Time) protocol.ScoreEntry {
+	return protocol.ScoreEntry{
+		Id:        ps.entity.entityId,
+		Username:  ps.entity.username,
+		Team:      ps.entity.team,
+		Score:     ps.score,
+		Kills:     ps.kills,
+		Deaths:    ps.deaths,
+		Distance:  float32(ps.distance),
+		Connected: shared.MDuration{Duration: ps.Connected(now).Round(time.Second)},
+		RTT:       shared.MDuration{Duration: ps.AverageRTT()},
+	}
+}
+
+// What's written to the stats file at the end of a room's match
+type statsFile struct {
+	Room    string
+	Mode    string
+	Started time.Time
+	Ended   time.Time
+	Players []protocol.ScoreEntry
+}
+
+// The stats of every player who has been in a room, by entity ID.  Game modes add to the score,
+// kills and deaths, and the room takes care of the rest.  Not thread safe - only the room's loop
+// uses it.
+type Scoreboard struct {
+	stats   map[int64]*PlayerStats
+	started time.Time
+
+	// When the scoreboard was last sent to the room's members
+	lastSent time.Time
+}
+
+// Start or carry on counting for a player coming into the room
+func (sb *Scoreboard) Join(ent *PlayerEntity, now time.Time) {
+	ps, ok := sb.stats[ent.entityId]
+	if !ok {
+		ps = new(PlayerStats)
+		sb.stats[ent.entityId] = ps
+	}
+	ps.entity = ent
+	ps.since = now
+}
+
+// Stop the clock for a player who has left the room
+func (sb *Scoreboard) Leave(ent *PlayerEntity, now time.Time) {
+	ps, ok := sb.stats[ent.entityId]
+	if !ok || ps.since.IsZero() {
+		return
+	}
+	ps.connected += now.Sub(ps.since)
+	ps.since = time.Time{}
+}
+
+// Add to how far a player has moved
+func (sb *Scoreboard) AddDistance(ent *PlayerEntity, offset shared.FloatVector) {
+	if ps, ok := sb.stats[ent.entityId]; ok {
+		ps.distance += math.Hypot(float64(offset.X), float64(offset.Y))
+	}
+}
+
+// Add points to a player's score.  Points can be negative.
+func (sb *Scoreboard) AddScore(ent *PlayerEntity, points int) {
+	if ps, ok := sb.stats[ent.entityId]; ok {
+		ps.score += points
+	}
+}
+
+// Count a kill for one player and a death for the other.  Either can be nil, for a death nobody
+// gets the credit for.
+func (sb *Scoreboard) AddKill(killer, victim *PlayerEntity) {
+	if killer != nil {
+		if ps, ok := sb.stats[killer.entityId]; ok {
+			ps.kills++
+		}
+	}
+	if victim != nil {
+		if ps, ok := sb.stats[victim.entityId]; ok {
+			ps.deaths++
+		}
+	}
+}
+
+// Take a round trip time measurement for a player's average
+func (sb *Scoreboard) SampleRTT(id int64, rtt time.Duration) {
+	if ps, ok := sb.stats[id]; ok && rtt > 0 {
+		ps.rttTotal += rtt
+		ps.rttSamples++
+	}
+}
+
+// Get the scoreboard's lines, best score first, then most kills, then fewest deaths.  Unless all
+// is true only the players still in the room are included.
+func (sb *Scoreboard) Entries(now time.Time, all bool) []protocol.ScoreEntry {
+	entries := make([]protocol.ScoreEntry, 0, len(sb.stats))
+	for _, ps := range sb.stats {
+		if all || !ps.since.IsZero() {
+			entries = append(entries, ps.Entry(now))
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case a.Kills != b.Kills:
+			return a.Kills > b.Kills
+		case a.Deaths != b.Deaths:
+			return a.Deaths < b.Deaths
+		}
+		return a.Id < b.Id
+	})
+	return entries
+}
+
+// Whether it's time to send the scoreboard to the room's members again
+func (sb *Scoreboard) DueToSend(now time.Time) bool {
+	return now.Sub(sb.lastSent) >= SCOREBOARD_INTERVAL
+}
+
+// Build the message with the scoreboard for the room's members, and note that it's been sent
+func (sb *Scoreboard) Message(now time.Time) *protocol.ScoreboardMessage {
+	sb.lastSent = now
+	return protocol.CreateScoreboardMessage(sb.Entries(now, false))
+}
+
+// Write everyone who has been in the room, gone or not, to a JSON file
+func (sb *Scoreboard) WriteFile(path, room, mode string, now time.Time) error {
+	raw, err := json.MarshalIndent(statsFile{
+		Room:    room,
+		Mode:    mode,
+		Started: sb.started,
+		Ended:   now,
+		Players: sb.Entries(now, true),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(raw, '\n'), 0644)
+}
+
+// Constructor for an empty scoreboard, for a room opening now
+func CreateScoreboard() *Scoreboard {
+	return &Scoreboard{
+		stats:   make(map[int64]*PlayerStats),
+		started: time.Now(),
+	}
+}
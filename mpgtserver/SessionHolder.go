@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+)
+
+// A Session ties a player's ID and entity to the token they were handed when they first joined.
+// When the player's connection drops the session hangs on to the entity for a while so that a
+// reconnecting client can pick up exactly where it left off.
+type Session struct {
+	token          string
+	playerId       int64
+	entity         *PlayerEntity
+	client         *Client
+	disconnectedAt time.Time
+
+	// The room the entity is in, empty if the player isn't in one.  The settings are kept so the
+	// room can be opened again if it got torn down while the player was away.
+	roomName     string
+	roomSettings protocol.RoomSettings
+}
+
+// Thread safe store of sessions, keyed by their token.
+type SessionHolder struct {
+	lock     *sync.Mutex
+	sessions map[string]*Session
+}
+
+// Create a brand new session for a freshly created player entity which is being driven by the
+// given client.  Returns the session so the token can be sent to the client.
+func (sh *SessionHolder) CreateSession(entity *PlayerEntity, client *Client) *Session {
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	session := &Session{
+		token:    generateSessionToken(),
+		playerId: entity.entityId,
+		entity:   entity,
+		client:   client,
+	}
+	sh.sessions[session.token] = session
+
+	return session
+}
+
+// Whether any session, including one whose player is away and might still come back, belongs to a
+// player with the given username, ignoring case
+func (sh *SessionHolder) HasUsername(username string) bool {
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	for _, session := range sh.sessions {
+		if strings.EqualFold(session.entity.username, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hand an existing session over to a new client.  The caller puts the entity back into the
+// session's room.  If the session was still attached to an older client (the old connection
+// hasn't noticed it's dead yet) that client is returned so the caller can close it.  Returns a nil
+// session if the token is unknown or has already expired.  The session returned is a copy, safe
+// to read without the lock.
+func (sh *SessionHolder) Attach(token string, client *Client) (*Session, *Client) {
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	session, ok := sh.sessions[token]
+	if !ok {
+		return nil, nil
+	}
+
+	previous := session.client
+	session.client = client
+	session.disconnectedAt = time.Time{}
+
+	copied := *session
+	return &copied, previous
+}
+
+// Called when a client's connection goes away.  If the client is still the one attached to the
+// session, the session starts waiting to be reclaimed or to expire, and true is returned so the
+// caller knows to pull the entity out of the world.  Returns false if some other client has
+// already taken the session over.
+func (sh *SessionHolder) Detach(token string, client *Client) bool {
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	session, ok := sh.sessions[token]
+	if !ok || session.client != client {
+		return false
+	}
+
+	session.client = nil
+	session.disconnectedAt = time.Now()
+
+	return true
+}
+
+// Remember which room the player is in now, and the entity they have there.  Pass a nil room when
+// they've left rooms altogether, and a nil entity to keep the one the session already has.
+func (sh *SessionHolder) SetRoom(token string, room *Room, entity *PlayerEntity) {
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	session, ok := sh.sessions[token]
+	if !ok {
+		return
+	}
+
+	if entity != nil {
+		session.entity = entity
+	}
+	session.roomName = ""
+	if room != nil {
+		session.roomName = room.name
+		session.roomSettings = room.Settings()
+	}
+}
+
+// End a session for good, whether or not it's attached to a client.  Used when a player is kicked
+// so they can't just reconnect with their token.  Returns false if there was no such session.
+func (sh *SessionHolder) End(token string) bool {
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	_, ok := sh.sessions[token]
+	delete(sh.sessions, token)
+	return ok
+}
+
+// Throw away every detached session that has been waiting longer than the grace period.  Returns
+// the player IDs of the sessions which were removed.
+func (sh *SessionHolder) ExpireSessions(now time.Time, grace time.Duration) []int64 {
+	sh.lock.Lock()
+	defer sh.lock.Unlock()
+
+	expired := make([]int64, 0)
+	for token, session := range sh.sessions {
+		if session.client == nil && now.Sub(session.disconnectedAt) > grace {
+			expired = append(expired, session.playerId)
+			delete(sh.sessions, token)
+		}
+	}
+
+	return expired
+}
+
+// Constructor to init the holder
+func CreateSessionHolder() *SessionHolder {
+	return &SessionHolder{
+		lock:     new(sync.Mutex),
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Make an unguessable token.  If the system can't give us random bytes something is very wrong
+// so we don't try to carry on.
+func generateSessionToken() string {
+	raw := make([]byte, 16)
+	_, err := rand.Read(raw)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return hex.EncodeToString(raw)
+}
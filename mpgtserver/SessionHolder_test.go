@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionReattach(t *testing.T) {
+	sh := CreateSessionHolder()
+	first := &Client{clientId: 1}
+	session := sh.CreateSession(CreatePlayerEntity(1, "alice"), first)
+
+	if session.token == "" || len(session.token) != 32 {
+		t.Fatalf("token %q isn't 16 random bytes in hex", session.token)
+	}
+	if other := sh.CreateSession(CreatePlayerEntity(2, "bob"), &Client{clientId: 2}); other.token == session.token {
+		t.Fatalf("two sessions got the same token")
+	}
+
+	// A new connection takes over before the old one has noticed it's dead
+	second := &Client{clientId: 1}
+	attached, previous := sh.Attach(session.token, second)
+	if attached == nil || attached.playerId != 1 || attached.entity.username != "alice" {
+		t.Fatalf("Attach gave %+v", attached)
+	}
+	if previous != first {
+		t.Errorf("Attach didn't hand back the old client to close")
+	}
+
+	// The old connection going away mustn't detach the new one
+	if sh.Detach(session.token, first) {
+		t.Errorf("stale client detached a session it no longer has")
+	}
+	if !sh.Detach(session.token, second) {
+		t.Errorf("current client couldn't detach its session")
+	}
+
+	if unknown, _ := sh.Attach("not a token", second); unknown != nil {
+		t.Errorf("attached to a session which doesn't exist")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	grace := 30 * time.Second
+
+	tests := []struct {
+		name     string
+		detached bool
+		away     time.Duration
+		expired  bool
+	}{
+		{"still connected", false, time.Hour, false},
+		{"just left", true, 0, false},
+		{"inside the grace period", true, grace - time.Second, false},
+		{"past the grace period", true, grace + time.Second, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sh := CreateSessionHolder()
+			client := &Client{clientId: 7}
+			session := sh.CreateSession(CreatePlayerEntity(7, "alice"), client)
+			if test.detached {
+				sh.Detach(session.token, client)
+			}
+
+			expired := sh.ExpireSessions(time.Now().Add(test.away), grace)
+			if (len(expired) == 1) != test.expired {
+				t.Fatalf("expired %v, wanted expired=%v", expired, test.expired)
+			}
+			if test.expired && expired[0] != 7 {
+				t.Errorf("expired player %v, wanted 7", expired[0])
+			}
+
+			// Whatever expired is gone for good, and its name is free again
+			attached, _ := sh.Attach(session.token, client)
+			if (attached == nil) != test.expired {
+				t.Errorf("Attach after expiry gave %+v", attached)
+			}
+			if sh.HasUsername("ALICE") == test.expired {
+				t.Errorf("HasUsername = %v after expired=%v", !test.expired, test.expired)
+			}
+		})
+	}
+}
+
+func TestSessionEnd(t *testing.T) {
+	sh := CreateSessionHolder()
+	session := sh.CreateSession(CreatePlayerEntity(3, "carol"), &Client{clientId: 3})
+
+	if !sh.End(session.token) {
+		t.Fatalf("End didn't find the session")
+	}
+	if sh.End(session.token) {
+		t.Errorf("ended the same session twice")
+	}
+	if attached, _ := sh.Attach(session.token, &Client{clientId: 3}); attached != nil {
+		t.Errorf("reattached to an ended session")
+	}
+}
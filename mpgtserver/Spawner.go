@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+const (
+	// How many random spots are tried inside each spawn region when looking for a good one
+	SPAWN_REGION_SAMPLES int = 8
+
+	// How far out, in player sizes, to look for free ground when every spawn is taken
+	SPAWN_SEARCH_RINGS int = 8
+)
+
+// The ways a Spawner can choose between the map's spawns:
+//
+//	random       any spawn, picked at random
+//	round-robin  each spawn in turn, in the order the map lists them
+//	farthest     the spot farthest from the enemy, which is everyone else without teams
+//	team         the spawns marked with the player's team, farthest from the enemy
+var spawnStrategies = map[string]bool{
+	"random":      true,
+	"round-robin": true,
+	"farthest":    true,
+	"team":        true,
+}
+
+// Check a spawn strategy name from the command line
+func checkSpawnStrategy(strategy string) error {
+	if !spawnStrategies[strategy] {
+		return fmt.Errorf("unknown spawn strategy %q, try random, round-robin, farthest or team", strategy)
+	}
+	return nil
+}
+
+// Decides where new players go in a room's world.  Whatever the strategy, a player is never put
+// on top of somebody else or on an obstacle if there's any free ground to be found.  Not thread safe - only the
+// room's loop uses it.
+type Spawner struct {
+	gameMap  *GameMap
+	strategy string
+
+	// The next spawn for the round-robin strategy
+	next int
+}
+
+// Find a spot for a new player on the given team (empty for none), given the entities already in
+// the world.  Returns the spot closest to what the strategy wants which is clear of everyone and
+// everything.
+func (s *Spawner) Place(team string, others []*PlayerEntity) shared.FloatVector {
+	candidates := s.candidates(team, others)
+	for _, spot := range candidates {
+		if s.isFree(spot, others) {
+			return spot
+		}
+	}
+
+	// Every spawn is taken, so look for free ground around the best one.  If even that fails the
+	// world is packed solid and there's nothing for it but to double up.
+	if spot, ok := s.searchAround(candidates[0], others); ok {
+		return spot
+	}
+	return candidates[0]
+}
+
+// Get the spots the strategy would put a player, best first
+func (s *Spawner) candidates(team string, others []*PlayerEntity) []shared.FloatVector {
+	areas := make([]SpawnArea, len(s.gameMap.Spawns))
+	copy(areas, s.gameMap.Spawns)
+
+	switch s.strategy {
+	case "random":
+		rand.Shuffle(len(areas), func(i, j int) { areas[i], areas[j] = areas[j], areas[i] })
+		return spotsIn(areas)
+
+	case "round-robin":
+		start := s.next % len(areas)
+		s.next++
+		return spotsIn(append(areas[start:], areas[:start]...))
+
+	case "team":
+		areas = teamAreas(areas, team)
+	}
+
+	// Farthest from everyone else first.  The spots are shuffled beforehand so that an empty
+	// world, where every spot is as good as any other, doesn't always get the same one.
+	spots := spotsIn(areas)
+	rand.Shuffle(len(spots), func(i, j int) { spots[i], spots[j] = spots[j], spots[i] })
+
+	enemies := enemiesOf(team, others)
+	distances := make(map[shared.FloatVector]float64, len(spots))
+	for _, spot := range spots {
+		distances[spot] = nearestDistance(spot, enemies)
+	}
+	sort.SliceStable(spots, func(i, j int) bool { return distances[spots[i]] > distances[spots[j]] })
+	return spots
+}
+
+// Look for free ground in rings around a spot, one player size apart, without leaving the map
+func (s *Spawner) searchAround(origin shared.FloatVector, others []*PlayerEntity) (shared.FloatVector, bool) {
+	maxX, maxY := s.gameMap.Width-shared.ENTITY_SIZE, s.gameMap.Height-shared.ENTITY_SIZE
+
+	for ring := 1; ring <= SPAWN_SEARCH_RINGS; ring++ {
+		for dy := -ring; dy <= ring; dy++ {
+			for dx := -ring; dx <= ring; dx++ {
+				// Only the edge of the ring, the inside was covered by the smaller rings
+				if dx != -ring && dx != ring && dy != -ring && dy != ring {
+					continue
+				}
+
+				spot := shared.FloatVector{
+					X: origin.X + float32(dx)*shared.ENTITY_SIZE,
+					Y: origin.Y + float32(dy)*shared.ENTITY_SIZE,
+				}
+				if spot.X < 0 || spot.Y < 0 || spot.X > maxX || spot.Y > maxY {
+					continue
+				}
+				if s.isFree(spot, others) {
+					return spot, true
+				}
+			}
+		}
+	}
+
+	return shared.FloatVector{}, false
+}
+
+// Whether a player put at the spot would be clear of the entities and the map's obstacles
+func (s *Spawner) isFree(spot shared.FloatVector, others []*PlayerEntity) bool {
+	return !overlapsAny(spot, others) && !s.gameMap.Blocked(spot)
+}
+
+// Turn spawn areas into spots, in the same order.  A point is one spot, a region gives a few
+// random spots inside it so there's a choice if some of it is taken.
+func spotsIn(areas []SpawnArea) []shared.FloatVector {
+	spots := make([]shared.FloatVector, 0, len(areas))
+	for _, area := range areas {
+		if area.IsPoint() {
+			spots = append(spots, area.RandomSpot())
+			continue
+		}
+
+		for i := 0; i < SPAWN_REGION_SAMPLES; i++ {
+			spots = append(spots, area.RandomSpot())
+		}
+	}
+
+	return spots
+}
+
+// The spawns a player on the given team should use: the ones marked with their team if there are
+// any, otherwise the ones marked with no team, otherwise the lot
+func teamAreas(areas []SpawnArea, team string) []SpawnArea {
+	for _, want := range []string{team, ""} {
+		matching := make([]SpawnArea, 0, len(areas))
+		for _, area := range areas {
+			if area.Team == want {
+				matching = append(matching, area)
+			}
+		}
+		if len(matching) > 0 {
+			return matching
+		}
+	}
+
+	return areas
+}
+
+// The entities which aren't on the given team.  Without a team, that's all of them.
+func enemiesOf(team string, entities []*PlayerEntity) []*PlayerEntity {
+	if team == "" {
+		return entities
+	}
+
+	enemies := make([]*PlayerEntity, 0, len(entities))
+	for _, entity := range entities {
+		if entity.team != team {
+			enemies = append(enemies, entity)
+		}
+	}
+	return enemies
+}
+
+// Distance from a spot to the closest of the entities, infinite if there aren't any
+func nearestDistance(spot shared.FloatVector, entities []*PlayerEntity) float64 {
+	nearest := math.Inf(1)
+	for _, entity := range entities {
+		d := math.Hypot(float64(spot.X-entity.position.X), float64(spot.Y-entity.position.Y))
+		nearest = math.Min(nearest, d)
+	}
+
+	return nearest
+}
+
+// Whether a player put at the spot would overlap any of the entities
+func overlapsAny(spot shared.FloatVector, entities []*PlayerEntity) bool {
+	for _, entity := range entities {
+		if overlaps(spot, entity.position) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether players at the two positions would overlap
+func overlaps(a, b shared.FloatVector) bool {
+	return abs32(a.X-b.X) < shared.ENTITY_SIZE && abs32(a.Y-b.Y) < shared.ENTITY_SIZE
+}
+
+// Absolute value of a float32, which the math package only does for float64
+func abs32(f float32) float32 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+// Create a spawner for the map using one of the strategies in spawnStrategies
+func CreateSpawner(gameMap *GameMap, strategy string) *Spawner {
+	return &Spawner{gameMap: gameMap, strategy: strategy}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+)
+
+// Points for tagging somebody, and for winning the round
+const (
+	TAG_SCORE     int = 1
+	TAG_WIN_SCORE int = 5
+)
+
+// How long a player who has just been tagged has to wait before they can tag back the one who
+// tagged them, so two players standing on top of each other don't pass it back and forth every tick
+const TAG_BACK_DELAY time.Duration = 2 * time.Second
+
+// Tag, built on nothing more than where the players are.  One player is "it", and running into
+// anyone else makes them "it" instead.  When time runs out, whoever spent the least time being
+// "it" wins.  This is the reference for how a mode uses the hooks.
+//
+// On the scoreboard a tag counts as a kill for the tagger and a death for the one tagged.
+type tagMode struct {
+	timeLimit time.Duration
+
+	// Who is "it", nil between rounds or when nobody has been picked yet
+	it *PlayerEntity
+
+	// When it was last passed on, and who passed it
+	taggedAt time.Time
+	taggedBy *PlayerEntity
+
+	// How long each player has been "it" this round, not counting the current "it" since
+	// taggedAt.  The key is the entity ID.
+	itTime map[int64]time.Duration
+}
+
+// GameMode interface
+func (m *tagMode) Name() string {
+	return "tag"
+}
+
+// GameMode interface
+func (m *tagMode) Teams() []string {
+	return nil
+}
+
+// GameMode interface
+func (m *tagMode) MinPlayers() int {
+	return 2
+}
+
+// GameMode interface
+func (m *tagMode) TimeLimit() time.Duration {
+	return m.timeLimit
+}
+
+// GameMode interface.  Latecomers start with a clean sheet, which is a bit of an advantage, but
+// they've missed their chance to be "it" for the start of the round too.
+func (m *tagMode) OnPlayerJoin(room *Room, entity *PlayerEntity) {
+	m.itTime[entity.entityId] = 0
+}
+
+// GameMode interface.  If "it" runs away for good, somebody else has to be "it" instead.
+func (m *tagMode) OnPlayerLeave(room *Room, entity *PlayerEntity) {
+	delete(m.itTime, entity.entityId)
+	if m.taggedBy == entity {
+		m.taggedBy = nil
+	}
+	if m.it == entity {
+		m.it = nil
+		if room.RoundState() == protocol.ROUND_STATE_IN_PROGRESS {
+			m.pickIt(room, time.Now())
+		}
+	}
+}
+
+// GameMode interface
+func (m *tagMode) OnTick(room *Room, now time.Time) {}
+
+// GameMode interface
+func (m *tagMode) OnEvent(room *Room, event GameEvent) {
+	switch event.Type {
+	case GAME_EVENT_ROUND_STARTED:
+		for id := range m.itTime {
+			m.itTime[id] = 0
+		}
+		m.taggedBy = nil
+		m.pickIt(room, time.Now())
+
+	case GAME_EVENT_ROUND_ENDED:
+		m.it, m.taggedBy = nil, nil
+
+	case GAME_EVENT_TOUCH:
+		if room.RoundState() != protocol.ROUND_STATE_IN_PROGRESS || m.it == nil {
+			return
+		}
+
+		// Touches come in either order, all that matters is whether "it" was one of them
+		var tagged *PlayerEntity
+		switch m.it {
+		case event.Entity:
+			tagged = event.Other
+		case event.Other:
+			tagged = event.Entity
+		default:
+			return
+		}
+
+		now := time.Now()
+		if tagged == m.taggedBy && now.Sub(m.taggedAt) < TAG_BACK_DELAY {
+			return
+		}
+		m.tag(room, m.it, tagged, now)
+	}
+}
+
+// GameMode interface.  The round only ends when time runs out.
+func (m *tagMode) CheckWinCondition(room *Room, timeUp bool) (string, bool) {
+	if !timeUp {
+		return "", false
+	}
+
+	m.addItTime(time.Now())
+
+	// Least time being "it" wins, with the first to have come in winning a tie
+	ents := room.entities.GetEntities()
+	sort.Slice(ents, func(i, j int) bool { return ents[i].entityId < ents[j].entityId })
+	var winner *PlayerEntity
+	for _, ent := range ents {
+		if winner == nil || m.itTime[ent.entityId] < m.itTime[winner.entityId] {
+			winner = ent
+		}
+	}
+
+	if winner == nil {
+		return "", true
+	}
+	room.scoreboard.AddScore(winner, TAG_WIN_SCORE)
+	return winner.username, true
+}
+
+// Make somebody at random "it", to start the round or because "it" left
+func (m *tagMode) pickIt(room *Room, now time.Time) {
+	ents := room.entities.GetEntities()
+	if len(ents) == 0 {
+		room.SetRoundStatus("")
+		return
+	}
+	m.tag(room, nil, ents[rand.Intn(len(ents))], now)
+}
+
+// Pass "it" on from one player to another.  From is nil when "it" is being picked by the mode
+// rather than by somebody getting caught.
+func (m *tagMode) tag(room *Room, from, to *PlayerEntity, now time.Time) {
+	m.addItTime(now)
+	m.it, m.taggedBy, m.taggedAt = to, from, now
+
+	if from != nil {
+		gameLog.Info("Tagged", logging.PLAYER_ID, to.entityId, "room", room.name, "by", from.entityId)
+		room.scoreboard.AddKill(from, to)
+		room.scoreboard.AddScore(from, TAG_SCORE)
+	}
+	room.SetRoundStatus(to.username + " is it")
+}
+
+// Add the time the current "it" has been "it" since they were tagged to their total
+func (m *tagMode) addItTime(now time.Time) {
+	if m.it != nil {
+		m.itTime[m.it.entityId] += now.Sub(m.taggedAt)
+	}
+	m.taggedAt = now
+}
+
+// Create a tag mode with rounds lasting timeLimit
+func CreateTagMode(timeLimit time.Duration) *tagMode {
+	return &tagMode{
+		timeLimit: timeLimit,
+		itTime:    make(map[int64]time.Duration),
+	}
+}
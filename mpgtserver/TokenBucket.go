@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+)
+
+// A classic token bucket.  Tokens drip in at a fixed rate up to a maximum (the burst size), and
+// every unit of work takes some out.  Each connection's reader goroutine owns its own buckets,
+// so there is no locking here.
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Take n tokens if they're there.  Returns false, taking nothing, if there aren't enough.
+func (tb *TokenBucket) Take(now time.Time, n float64) bool {
+	tb.refill(now)
+	if tb.tokens < n {
+		return false
+	}
+
+	tb.tokens -= n
+	return true
+}
+
+// How long until n tokens will be available.  Zero if they already are.
+func (tb *TokenBucket) WaitTime(now time.Time, n float64) time.Duration {
+	tb.refill(now)
+	if tb.tokens >= n {
+		return 0
+	}
+
+	// More than the bucket can ever hold - it's never going to happen
+	if n > tb.burst {
+		return time.Duration(1<<63 - 1)
+	}
+
+	return time.Duration((n - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// Add however many tokens have dripped in since the last call
+func (tb *TokenBucket) refill(now time.Time) {
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+}
+
+// Create a full bucket which refills at rate tokens per second and holds at most burst tokens
+func CreateTokenBucket(rate, burst float64) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
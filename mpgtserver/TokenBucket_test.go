@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Now()
+
+	// Each step takes tokens (or asks how long until it could) some time after the bucket was made
+	type step struct {
+		after time.Duration
+		take  float64
+		ok    bool
+		wait  time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		rate  float64
+		burst float64
+		steps []step
+	}{
+		{
+			name: "burst then empty", rate: 10, burst: 3,
+			steps: []step{
+				{0, 1, true, 0},
+				{0, 1, true, 0},
+				{0, 1, true, 0},
+				{0, 1, false, 100 * time.Millisecond},
+			},
+		},
+		{
+			name: "refills over time", rate: 10, burst: 2,
+			steps: []step{
+				{0, 2, true, 0},
+				{50 * time.Millisecond, 1, false, 50 * time.Millisecond},
+				{100 * time.Millisecond, 1, true, 0},
+			},
+		},
+		{
+			name: "never fills past the burst", rate: 100, burst: 5,
+			steps: []step{
+				{time.Hour, 5, true, 0},
+				{time.Hour, 1, false, 10 * time.Millisecond},
+			},
+		},
+		{
+			name: "more than the bucket holds", rate: 10, burst: 4,
+			steps: []step{
+				{0, 5, false, time.Duration(1<<63 - 1)},
+				{0, 4, true, 0},
+			},
+		},
+		{
+			name: "failed take takes nothing", rate: 1, burst: 3,
+			steps: []step{
+				{0, 2, true, 0},
+				{0, 2, false, time.Second},
+				{0, 1, true, 0},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tb := CreateTokenBucket(test.rate, test.burst)
+			tb.last = start
+
+			for i, s := range test.steps {
+				now := start.Add(s.after)
+				if wait := tb.WaitTime(now, s.take); wait != s.wait {
+					t.Errorf("step %v: WaitTime(%v) = %v, wanted %v", i, s.take, wait, s.wait)
+				}
+				if ok := tb.Take(now, s.take); ok != s.ok {
+					t.Errorf("step %v: Take(%v) = %v, wanted %v", i, s.take, ok, s.ok)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Checks usernames and passwords against a local file.  The file has one user per line in the
+// form "username:bcrypt-hash" (the same layout htpasswd -B produces).  Blank lines and lines
+// starting with # are ignored.
+type UserFileAuthenticator struct {
+	users map[string][]byte
+
+	// Hash compared against when the user doesn't exist, so missing users take as long to reject
+	// as wrong passwords do
+	dummyHash []byte
+}
+
+// Authenticator interface
+func (a *UserFileAuthenticator) Authenticate(username, credential string) (string, error) {
+	hash, ok := a.users[username]
+	if !ok {
+		bcrypt.CompareHashAndPassword(a.dummyHash, []byte(credential))
+		return "", ErrBadCredentials
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(credential)) != nil {
+		return "", ErrBadCredentials
+	}
+
+	return checkUsername(username)
+}
+
+// Read the user file at the given path and build an authenticator from it
+func LoadUserFileAuthenticator(path string) (*UserFileAuthenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dummy, err := bcrypt.GenerateFromPassword([]byte(path), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &UserFileAuthenticator{users: make(map[string][]byte), dummyHash: dummy}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Usernames can have colons in them but hashes can't, so the last one is the separator
+		sep := strings.LastIndex(line, ":")
+		if sep <= 0 || sep == len(line)-1 {
+			return nil, fmt.Errorf("%v:%v: expected username:hash", path, lineNum)
+		}
+
+		auth.users[line[:sep]] = []byte(line[sep+1:])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
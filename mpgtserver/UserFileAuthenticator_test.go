@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Write a user file into a temporary directory and return its path
+func writeUserFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "users")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Hash a password as cheaply as bcrypt allows, to keep the tests quick
+func cheapHash(t *testing.T, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
+
+func TestUserFileAuthenticator(t *testing.T) {
+	path := writeUserFile(t,
+		"# comments and blank lines are skipped",
+		"",
+		"alice:"+cheapHash(t, "wonderland"),
+		"  bob:"+cheapHash(t, "builder")+"  ",
+		"c:d:"+cheapHash(t, "colons"),
+	)
+	auth, err := LoadUserFileAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username string
+		password string
+		ok       bool
+	}{
+		{"alice", "wonderland", true},
+		{"bob", "builder", true},
+		{"c:d", "colons", true},
+		{"alice", "builder", false},
+		{"alice", "", false},
+		{"Alice", "wonderland", false},
+		{"carol", "wonderland", false},
+		{"c", "colons", false},
+	}
+
+	for _, test := range tests {
+		username, err := auth.Authenticate(test.username, test.password)
+		if (err == nil) != test.ok {
+			t.Errorf("Authenticate(%q, %q) gave %v, wanted ok=%v", test.username, test.password, err, test.ok)
+		}
+		if test.ok && username != test.username {
+			t.Errorf("Authenticate(%q) let them in as %q", test.username, username)
+		}
+		if !test.ok && err != ErrBadCredentials {
+			t.Errorf("Authenticate(%q) gave %v, wanted the vague ErrBadCredentials", test.username, err)
+		}
+	}
+}
+
+func TestUserFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"no separator", "alice"},
+		{"no username", ":$2a$04$abcdef"},
+		{"no hash", "alice:"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeUserFile(t, "# fine", test.line)
+			_, err := LoadUserFileAuthenticator(path)
+			if err == nil || !strings.Contains(err.Error(), ":2:") {
+				t.Errorf("got %v, wanted an error pointing at line 2", err)
+			}
+		})
+	}
+
+	if _, err := LoadUserFileAuthenticator(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("loaded a user file which doesn't exist")
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Everything about the server which can be changed from the command line.  Defaults match how
+// the server behaved before any of this was configurable.
+type ServerConfig struct {
+	// Which Authenticator to use: none, secret, hmac or userfile
+	authMode string
+
+	// Shared secret for the "secret" auth mode
+	authSecret string
+
+	// Signing key for the "hmac" auth mode
+	authHMACKey string
+
+	// Path to the user file for the "userfile" auth mode
+	authUserFile string
+
+	// Serve over TLS instead of plain TCP
+	useTLS bool
+
+	// Certificate and key files for TLS
+	tlsCert string
+	tlsKey  string
+
+	// Generate a self-signed development certificate if the certificate file doesn't exist
+	tlsSelfSigned bool
+
+	// What to do with a player whose violation score reaches cheatThreshold: ignore, rubberband,
+	// kick or ban.  Offending inputs are always dropped, whatever the response.
+	cheatResponse string
+
+	// How long a "ban" cheatResponse lasts, 0 for forever
+	cheatBanDuration time.Duration
+
+	// File the bans are kept in, empty to only keep them in memory.  See BanList.go
+	banFile string
+
+	// Violation score at which cheatResponse kicks in
+	cheatThreshold float64
+
+	// Longest line (message) a client may send, in bytes.  Clients sending longer ones get
+	// disconnected.
+	maxLineLength int
+
+	// Sustained messages per second and bytes per second allowed from each connection, plus how
+	// many messages can come in one burst.  Bytes can burst up to one second's worth.
+	maxMessageRate  float64
+	maxMessageBurst float64
+	maxByteRate     float64
+
+	// Longest line of chat a client may send, in characters, and how many lines per second it can
+	// send with how many in one burst.  Clients which keep going over the rate get muted for
+	// chatMuteTime.
+	chatMaxLength int
+	chatRate      float64
+	chatBurst     float64
+	chatMuteTime  time.Duration
+
+	// File of words to star out of chat, empty to not filter
+	chatFilter string
+
+	// How many spectators can be connected at once.  They're counted separately from players.
+	maxSpectators int
+
+	// How many players the server takes (0 for no limit), counting the ones who dropped out and
+	// might reconnect, and how many more can wait in line for a slot.  See JoinQueue.go
+	maxPlayers   int
+	maxJoinQueue int
+
+	// How many connections one IP address can have open at once, 0 for no limit
+	maxConnsPerIP int
+
+	// Directory to record each room's matches into, empty to not record
+	recordPath string
+
+	// Directory to write each room's stats into at the end of its match, empty to not write them
+	statsPath string
+
+	// The room every player starts out in, which is always open, and how many players it takes
+	// (0 for no limit)
+	defaultRoom           string
+	defaultRoomMaxPlayers int
+
+	// The game modes the default room and match rooms are played with.  See GameMode.go
+	defaultRoomMode string
+	matchMode       string
+
+	// How long each part of a round lasts.  The round itself is only limited for modes which have
+	// a time limit, like tag.
+	warmupTime    time.Duration
+	roundTime     time.Duration
+	postRoundTime time.Duration
+	mapChangeTime time.Duration
+
+	// Furthest apart teams can get through players switching.  Admins can go past it.
+	teamMaxImbalance int
+
+	// Comma separated JSON map files, played in turn, or empty for the default map.  See GameMap.go
+	mapPath string
+
+	// How players are spread over the map's spawns.  See Spawner.go
+	spawnStrategy string
+
+	// Comma separated behaviors of the bots to put in the default room at startup.  See
+	// BotBehavior.go
+	bots string
+
+	// Whether rooms send their bots' paths to the clients, for the client's debug overlay
+	debugPaths bool
+
+	// How often a pickup is dropped somewhere at random, zero for never, and the most of those
+	// which can be lying around a room at once.  See Pickup.go
+	pickupInterval time.Duration
+	maxPickups     int
+
+	// How hard two entities bounce off each other when they run into each other, as a speed in
+	// pixels per second, zero for not at all
+	knockback float64
+
+	// Most rooms which can be open at once, the default room included
+	maxRooms int
+
+	// How the matchmaker groups players, and the file to read their ratings from
+	matchRules   MatchRules
+	matchRatings string
+
+	// Address for the HTTP metrics and status listener, empty to not run it
+	metricsAddr string
+
+	// Take admin commands on stdin, and/or from remote admins who connect to adminAddr and send
+	// adminPassword.  See AdminConsole.go
+	adminConsole  bool
+	adminAddr     string
+	adminPassword string
+
+	// If set, print a signed token for this user (using -auth-hmac-key) and exit
+	mintToken string
+
+	// How long tokens printed by -mint-token stay valid
+	tokenTTL time.Duration
+
+	// If set, read a password from stdin, print its bcrypt hash for the user file and exit
+	hashPassword bool
+
+	// -log-level and -log-format
+	logFlags *logging.Flags
+
+	// Whatever was left on the command line after the flags, for the subcommands
+	args []string
+}
+
+// Parse the command line flags into a ServerConfig
+func parseConfig() *ServerConfig {
+	cfg := new(ServerConfig)
+
+	flag.StringVar(&cfg.authMode, "auth", "none", "how players authenticate: none, secret, hmac or userfile")
+	flag.StringVar(&cfg.authSecret, "auth-secret", "", "shared secret for -auth secret")
+	flag.StringVar(&cfg.authHMACKey, "auth-hmac-key", "", "token signing key for -auth hmac")
+	flag.StringVar(&cfg.authUserFile, "auth-users", "", "user file (username:bcrypt-hash lines) for -auth userfile")
+	flag.BoolVar(&cfg.useTLS, "tls", false, "accept TLS connections instead of plain TCP")
+	flag.StringVar(&cfg.tlsCert, "tls-cert", "", "PEM certificate file for -tls")
+	flag.StringVar(&cfg.tlsKey, "tls-key", "", "PEM private key file for -tls")
+	flag.BoolVar(&cfg.tlsSelfSigned, "tls-self-signed", false, "generate a self-signed development certificate (written to -tls-cert/-tls-key if they don't exist)")
+	flag.StringVar(&cfg.cheatResponse, "cheat-response", "rubberband", "what to do with players caught moving too fast: ignore, rubberband, kick or ban")
+	flag.DurationVar(&cfg.cheatBanDuration, "cheat-ban-duration", 0, "how long -cheat-response ban lasts, 0 for forever")
+	flag.StringVar(&cfg.banFile, "ban-file", "", "JSON file the bans are kept in (created when needed), empty to forget them on restart")
+	flag.Float64Var(&cfg.cheatThreshold, "cheat-threshold", 10, "violation score at which -cheat-response is applied")
+	flag.IntVar(&cfg.maxLineLength, "max-line", 4096, "longest message a client may send, in bytes")
+	flag.Float64Var(&cfg.maxMessageRate, "max-msg-rate", 120, "messages per second allowed from each connection")
+	flag.Float64Var(&cfg.maxMessageBurst, "max-msg-burst", 30, "messages a connection can send in one burst")
+	flag.Float64Var(&cfg.maxByteRate, "max-byte-rate", 64*1024, "bytes per second allowed from each connection")
+	flag.IntVar(&cfg.chatMaxLength, "chat-max-length", 200, "longest line of chat a client may send, in characters")
+	flag.Float64Var(&cfg.chatRate, "chat-rate", 1, "lines of chat per second allowed from each client")
+	flag.Float64Var(&cfg.chatBurst, "chat-burst", 5, "lines of chat a client can send in one burst")
+	flag.DurationVar(&cfg.chatMuteTime, "chat-mute-time", 30*time.Second, "how long clients which keep going over -chat-rate are muted for")
+	flag.StringVar(&cfg.chatFilter, "chat-filter", "", "file of words (one per line) to star out of chat")
+	flag.IntVar(&cfg.maxSpectators, "max-spectators", 16, "spectators allowed at once, 0 to not allow spectating")
+	flag.IntVar(&cfg.maxPlayers, "max-players", 0, "players allowed on the server at once, 0 for no limit")
+	flag.IntVar(&cfg.maxJoinQueue, "max-join-queue", 32, "players who can wait for a slot when the server is full, 0 to turn them away straight away")
+	flag.IntVar(&cfg.maxConnsPerIP, "max-conns-per-ip", 0, "connections allowed from a single IP address, 0 for no limit")
+	flag.StringVar(&cfg.recordPath, "record", "", "record every room's matches into this directory, for replaying later")
+	flag.StringVar(&cfg.statsPath, "stats", "", "write every room's player stats into this directory when its match ends")
+	flag.StringVar(&cfg.defaultRoom, "default-room", "main", "name of the room players start in")
+	flag.IntVar(&cfg.defaultRoomMaxPlayers, "default-room-max-players", 0, "players allowed in the default room, 0 for no limit")
+	flag.IntVar(&cfg.maxRooms, "max-rooms", 32, "most rooms which can be open at once")
+	flag.StringVar(&cfg.defaultRoomMode, "default-room-mode", DEFAULT_GAME_MODE, "game mode of the default room: ffa, tag or teams")
+	flag.StringVar(&cfg.matchMode, "match-mode", DEFAULT_GAME_MODE, "game mode of match rooms: ffa, tag or teams")
+	flag.DurationVar(&cfg.warmupTime, "warmup-time", 10*time.Second, "countdown to the start of a round once there are enough players")
+	flag.DurationVar(&cfg.roundTime, "round-time", 3*time.Minute, "how long a round lasts in modes with a time limit")
+	flag.DurationVar(&cfg.postRoundTime, "post-round-time", 5*time.Second, "how long the result of a round is shown for")
+	flag.DurationVar(&cfg.mapChangeTime, "map-change-time", 3*time.Second, "pause while moving on to the next map between rounds")
+	flag.IntVar(&cfg.teamMaxImbalance, "team-max-imbalance", 1, "most players one team can be ahead of another after a player switches")
+	flag.StringVar(&cfg.mapPath, "map", "", "JSON map files to play in turn, comma separated, empty for an open map the size of the client's window")
+	flag.StringVar(&cfg.bots, "bots", "", "bots to put in the default room at startup, as comma separated behaviors: wander, chase, flee or patrol")
+	flag.DurationVar(&cfg.pickupInterval, "pickup-interval", 20*time.Second, "how often a random pickup is dropped in each room, 0 for only the map's own pickups")
+	flag.IntVar(&cfg.maxPickups, "max-pickups", 3, "most random pickups lying around a room at once")
+	flag.Float64Var(&cfg.knockback, "knockback", 0, "how hard entities bounce off each other when they touch, in pixels per second, 0 to let them pass through each other")
+	flag.BoolVar(&cfg.debugPaths, "debug-paths", false, "send bot paths and map obstacles to clients so they can be drawn with the client's debug overlay")
+	flag.StringVar(&cfg.spawnStrategy, "spawn-strategy", "farthest", "how players are spread over the map's spawns: random, round-robin, farthest or team")
+	flag.IntVar(&cfg.matchRules.size, "match-size", 2, "players in each match")
+	flag.BoolVar(&cfg.matchRules.useSkill, "match-skill", false, "only match players of similar rating")
+	flag.Float64Var(&cfg.matchRules.skillWindow, "match-skill-window", 100, "with -match-skill, how far apart two ratings can be to start with")
+	flag.Float64Var(&cfg.matchRules.relaxPerSecond, "match-relax-rate", 25, "with -match-skill, how much the rating window widens per second of waiting")
+	flag.DurationVar(&cfg.matchRules.readyDelay, "match-ready-delay", 3*time.Second, "time between a match being found and it starting")
+	flag.DurationVar(&cfg.matchRules.length, "match-length", 5*time.Minute, "how long each match lasts before everyone goes back to the lobby")
+	flag.StringVar(&cfg.matchRatings, "match-ratings", "", "file of \"username rating\" lines for -match-skill, unlisted players are rated 1000")
+	flag.StringVar(&cfg.metricsAddr, "metrics-addr", "", "serve Prometheus metrics on /metrics and a JSON status page on /status at this address (e.g. :9100)")
+	flag.BoolVar(&cfg.adminConsole, "admin-console", false, "read admin commands from stdin (type help for the list)")
+	flag.StringVar(&cfg.adminAddr, "admin-addr", "", "accept remote admin connections at this address (e.g. localhost:1340), using TLS if -tls is on")
+	flag.StringVar(&cfg.adminPassword, "admin-password", "", "password remote admins have to send first, required with -admin-addr")
+	flag.StringVar(&cfg.mintToken, "mint-token", "", "print a signed token for this username (needs -auth-hmac-key) and exit")
+	flag.DurationVar(&cfg.tokenTTL, "token-ttl", 24*time.Hour, "how long tokens printed by -mint-token are valid for")
+	flag.BoolVar(&cfg.hashPassword, "hash-password", false, "read a password on stdin, print its bcrypt hash and exit")
+
+	cfg.logFlags = logging.RegisterFlags()
+
+	flag.Parse()
+	cfg.args = flag.Args()
+	return cfg
+}
+
+// Make sure the options which only take certain values have one of them
+func validateConfig(cfg *ServerConfig) error {
+	switch cfg.cheatResponse {
+	case "ignore", "rubberband", "kick", "ban":
+	default:
+		return fmt.Errorf("unknown -cheat-response %q", cfg.cheatResponse)
+	}
+
+	// A full line has to fit in both the read buffer and the byte bucket or it could never pass
+	if cfg.maxLineLength < 256 {
+		return fmt.Errorf("-max-line must be at least 256")
+	}
+	if cfg.maxByteRate < float64(cfg.maxLineLength) {
+		return fmt.Errorf("-max-byte-rate must be at least -max-line")
+	}
+	if err := checkRoomName(cfg.defaultRoom); err != nil {
+		return fmt.Errorf("bad -default-room: %v", err)
+	}
+	if err := checkSpawnStrategy(cfg.spawnStrategy); err != nil {
+		return err
+	}
+	for _, behavior := range botList(cfg.bots) {
+		if err := checkBotBehavior(behavior); err != nil {
+			return fmt.Errorf("bad -bots: %v", err)
+		}
+	}
+	if err := checkGameMode(cfg.defaultRoomMode); err != nil {
+		return fmt.Errorf("bad -default-room-mode: %v", err)
+	}
+	if err := checkGameMode(cfg.matchMode); err != nil {
+		return fmt.Errorf("bad -match-mode: %v", err)
+	}
+	if cfg.teamMaxImbalance < 1 {
+		return fmt.Errorf("-team-max-imbalance must be at least 1")
+	}
+	if cfg.warmupTime <= 0 || cfg.roundTime <= 0 || cfg.postRoundTime <= 0 || cfg.mapChangeTime <= 0 {
+		return fmt.Errorf("-warmup-time, -round-time, -post-round-time and -map-change-time must be positive")
+	}
+	if cfg.pickupInterval < 0 || cfg.maxPickups < 0 {
+		return fmt.Errorf("-pickup-interval and -max-pickups can't be negative")
+	}
+	if cfg.knockback < 0 || cfg.knockback > float64(shared.MAX_VELOCITY) {
+		return fmt.Errorf("-knockback must be between 0 and %v", shared.MAX_VELOCITY)
+	}
+	if cfg.maxRooms < 1 {
+		return fmt.Errorf("-max-rooms must be at least 1")
+	}
+	if cfg.matchRules.size < 1 || cfg.matchRules.size > MAX_ROOM_PLAYERS {
+		return fmt.Errorf("-match-size must be between 1 and %v", MAX_ROOM_PLAYERS)
+	}
+	if cfg.matchRules.length <= 0 {
+		return fmt.Errorf("-match-length must be positive")
+	}
+	// A character can take up to four bytes once it's encoded, and the longest chat line still has
+	// to fit in one message
+	if cfg.chatMaxLength < 1 || cfg.chatMaxLength > cfg.maxLineLength/4 {
+		return fmt.Errorf("-chat-max-length must be between 1 and a quarter of -max-line")
+	}
+	if cfg.chatRate <= 0 || cfg.chatBurst < 1 {
+		return fmt.Errorf("-chat-rate must be positive and -chat-burst at least 1")
+	}
+	if cfg.adminAddr != "" && cfg.adminPassword == "" {
+		return fmt.Errorf("-admin-addr needs -admin-password")
+	}
+	if cfg.maxSpectators < 0 {
+		return fmt.Errorf("-max-spectators can't be negative")
+	}
+	if cfg.maxPlayers < 0 {
+		return fmt.Errorf("-max-players can't be negative")
+	}
+	if cfg.maxJoinQueue < 0 {
+		return fmt.Errorf("-max-join-queue can't be negative")
+	}
+	if cfg.maxMessageRate <= 0 || cfg.maxMessageBurst < 1 {
+		return fmt.Errorf("-max-msg-rate must be positive and -max-msg-burst at least 1")
+	}
+
+	return nil
+}
+
+// The server binary doubles as the tool for making credentials and managing bans.  If one of the
+// tool flags or subcommands was given, do that job and return true so main knows to exit instead of
+// starting the server.
+func runConfigTools(cfg *ServerConfig) (bool, error) {
+	if len(cfg.args) > 0 {
+		if cfg.args[0] != "bans" {
+			return true, fmt.Errorf("unknown subcommand %q", cfg.args[0])
+		}
+		return true, runBanTool(cfg.banFile, cfg.args[1:])
+	}
+
+	if cfg.mintToken != "" {
+		if cfg.authHMACKey == "" {
+			return true, fmt.Errorf("-mint-token needs -auth-hmac-key")
+		}
+		if _, err := checkUsername(cfg.mintToken); err != nil {
+			return true, err
+		}
+		auth := CreateHMACAuthenticator(cfg.authHMACKey)
+		fmt.Println(auth.MintToken(cfg.mintToken, time.Now().Add(cfg.tokenTTL)))
+		return true, nil
+	}
+
+	if cfg.hashPassword {
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			return true, err
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(strings.TrimRight(password, "\r\n")), bcrypt.DefaultCost)
+		if err != nil {
+			return true, err
+		}
+		fmt.Println(string(hash))
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// The "bans" subcommand, for managing the ban file from the command line:
+//
+//	mpgtserver -ban-file bans.json bans list
+//	mpgtserver -ban-file bans.json bans user <username> <length> [reason]
+//	mpgtserver -ban-file bans.json bans ip <address or CIDR range> <length> [reason]
+//	mpgtserver -ban-file bans.json bans remove <username, address or range>
+//	mpgtserver -ban-file bans.json bans allow <address or CIDR range>
+//	mpgtserver -ban-file bans.json bans unallow <address or CIDR range>
+//
+// The ban file has to be the one the server was started with.  Lengths are things like 30m, 12h
+// or 7d, or forever.  A running server picks the changes up by
+// itself within a second or so.
+func runBanTool(path string, args []string) error {
+	if path == "" {
+		return fmt.Errorf("the bans subcommand needs a -ban-file")
+	}
+
+	bans, err := LoadBanList(path)
+	if err != nil {
+		return err
+	}
+
+	usage := fmt.Errorf("usage: bans list | user <username> <length> [reason] | ip <address/range> <length> [reason] | remove <target> | allow <range> | unallow <range>")
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch {
+	case args[0] == "list":
+		bans.Dump(os.Stdout)
+
+	case (args[0] == "user" || args[0] == "ip") && len(args) >= 3:
+		duration, err := parseBanDuration(args[2])
+		if err != nil {
+			return err
+		}
+		reason := reasonArg(args[3:], "banned")
+		if args[0] == "user" {
+			err = bans.BanUsername(args[1], reason, duration)
+		} else {
+			err = bans.BanNetwork(args[1], reason, duration)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("banned %v\n", args[1])
+
+	case args[0] == "remove" && len(args) == 2:
+		removed, err := bans.Remove(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("lifted %v bans\n", removed)
+
+	case args[0] == "allow" && len(args) == 2:
+		if err := bans.Allow(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("allowed %v\n", args[1])
+
+	case args[0] == "unallow" && len(args) == 2:
+		found, err := bans.Disallow(args[1])
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("%v wasn't on the allow list", args[1])
+		}
+		fmt.Printf("unallowed %v\n", args[1])
+
+	default:
+		return usage
+	}
+
+	return nil
+}
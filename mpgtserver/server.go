@@ -2,24 +2,126 @@ package main
 
 import (
 	"bufio"
-	"log"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
 	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
 	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+	"github.com/gabriel-comeau/multiplayer-game-test/transport"
 )
 
 // Link a client-id to a network connection
 type Client struct {
-	clientId int64
-	conn     net.Conn
+	clientId     int64
+	conn         net.Conn
+	sessionToken string
+	username     string
+
+	// Spectators watch the game without an entity of their own, and can't send inputs
+	spectator bool
+
+	// How many of this client's messages had to wait for the rate limiter, and how many it threw
+	// away.  Use sync/atomic to read them from outside the client's goroutine.
+	throttled int64
+	dropped   int64
+
+	// Chat gets its own, much slower, rate limit.  Every line which doesn't fit in the bucket is a
+	// strike, and enough strikes in a row get the client muted.  Only the client's own goroutine
+	// touches these.
+	chatBucket  *TokenBucket
+	chatStrikes int
+
+	// Dropped messages, with each one wearing off over time at FLOOD_DECAY_PER_SECOND, so an
+	// honest client which goes over the limit now and then never adds up to a kick.  Only the
+	// client's own goroutine touches these.
+	floodScore     float64
+	floodScoreTime time.Time
+
+	// Last measured round trip time, in nanoseconds.  Use GetRTT / SetRTT.
+	rtt int64
+
+	// The room the client is in, nil if it isn't in one.  Use GetRoom / SetRoom.
+	room atomic.Pointer[Room]
+
+	// The team the client's entity is on, so it can be checked without going through the room's
+	// loop.  Empty if it's not on one.  Use GetTeam / SetTeam.
+	team atomic.Pointer[string]
+}
+
+// Get the last measured round trip time to the client.  Safe to call from any goroutine.
+func (c *Client) GetRTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.rtt))
+}
+
+// Record a new round trip time measurement
+func (c *Client) SetRTT(rtt time.Duration) {
+	atomic.StoreInt64(&c.rtt, int64(rtt))
+}
+
+// Get the room the client is in, nil if none.  Safe to call from any goroutine.
+func (c *Client) GetRoom() *Room {
+	return c.room.Load()
+}
+
+// Change the room the client is in.  Only the RoomHolder should call this.
+func (c *Client) SetRoom(room *Room) {
+	c.room.Store(room)
+}
+
+// Get the team the client's entity is on, empty if none.  Safe to call from any goroutine.
+func (c *Client) GetTeam() string {
+	if team := c.team.Load(); team != nil {
+		return *team
+	}
+	return ""
+}
+
+// Change the team the client's entity is on.  Only the client's room should call this, when it
+// changes the entity's team, and the RoomHolder.
+func (c *Client) SetTeam(team string) {
+	c.team.Store(&team)
 }
 
 const (
 	// How long we want to have between iterations of the main server loop.  The loop will sleep
 	// for this time minus however long it took (assuming that difference is positive of course)
 	SLEEP_TIME time.Duration = 33 * time.Millisecond
+
+	// How long a newly accepted connection has to send its JoinMessage before we give up on it
+	JOIN_TIMEOUT time.Duration = 5 * time.Second
+
+	// How often a player waiting in the join queue is checked on, to see whether they've been let
+	// in or have gone away
+	JOIN_QUEUE_POLL time.Duration = 250 * time.Millisecond
+
+	// How long a disconnected player's entity is kept around waiting for them to reconnect
+	SESSION_GRACE_PERIOD time.Duration = 30 * time.Second
+
+	// Longest a message will be held back waiting for the rate limiter.  If it would have to wait
+	// any longer than this it gets dropped instead.
+	THROTTLE_MAX_WAIT time.Duration = 50 * time.Millisecond
+
+	// A client whose flood score (one point for every dropped message) gets this high is flooding
+	// us on purpose, and how many points wear off per second
+	FLOOD_KICK_SCORE       float64 = 500
+	FLOOD_DECAY_PER_SECOND float64 = 10
+
+	// How often every client gets pinged to measure its round trip time
+	PING_INTERVAL time.Duration = time.Second
+
+	// How many lines of chat in a row a client can have refused for going too fast before it gets
+	// muted
+	CHAT_MUTE_STRIKES int = 3
 )
 
 var (
@@ -29,157 +131,735 @@ var (
 	// The thread-safe client holder.  See ClientHolder.go
 	clientHolder *ClientHolder
 
-	// The thread-safe map of entities present in the game
-	entityHolder *EntityHolder
+	// The open rooms, each with its own world.  See RoomHolder.go and Room.go
+	roomHolder *RoomHolder
+
+	// Sessions for connected players and recently disconnected ones.  See SessionHolder.go
+	sessionHolder *SessionHolder
+
+	// Command line configuration.  See config.go
+	config *ServerConfig
+
+	// Decides who gets to join.  See Authenticator.go
+	authenticator Authenticator
+
+	// The server's player slots and the line of players waiting for one.  See JoinQueue.go
+	joinQueue *JoinQueue
+
+	// The maps rooms are played on.  Every room starts on the first one and moves on to the next
+	// after each round.  See GameMap.go
+	gameMaps []*GameMap
+
+	// Players and addresses which have been banned.  See BanList.go
+	banList *BanList
+
+	// Stars out bad words and keeps track of who's muted.  See ChatFilter.go
+	chatFilter *ChatFilter
+
+	// Puts the players waiting in the lobby into matches.  See Matchmaker.go
+	matchmaker *Matchmaker
+
+	// Open connections per IP address.  See ConnectionCounter.go
+	connCounter *ConnectionCounter
+
+	// Counters, histograms and the HTTP endpoint to read them from.  See Metrics.go
+	metrics *Metrics
+
+	// Loggers for each part of the server.  The hot ones, which can fire on every message, only
+	// write each distinct line once a second.  See the logging package.
+	netLog        = logging.For("net")
+	netHotLog     = logging.RateLimited(netLog, time.Second)
+	authLog       = logging.For("auth")
+	gameLog       = logging.For("game")
+	gameHotLog    = logging.RateLimited(gameLog, time.Second)
+	validationLog = logging.RateLimited(logging.For("validation"), time.Second)
 
-	// The queue of messages to process each iteration of the main loop
-	messageQueue *protocol.MessageQueue
+	// Every line of chat which gets through is written here, which makes it the chat log
+	chatLog = logging.For("chat")
+
+	// Totals of throttled and dropped messages over all clients, for as long as the server has
+	// been up.  Use sync/atomic to touch these.
+	totalThrottled int64
+	totalDropped   int64
 )
 
 func init() {
 	idGen = CreateIdGenerator()
 	clientHolder = CreateClientHolder()
-	entityHolder = CreateEntityHolder()
-	messageQueue = protocol.CreateMessageQueue()
+	sessionHolder = CreateSessionHolder()
+	connCounter = CreateConnectionCounter()
+	metrics = CreateMetrics()
 }
 
 func main() {
+	config = parseConfig()
+
+	err := config.logFlags.Apply()
+	if err != nil {
+		logging.Fatal(gameLog, "Bad logging configuration", logging.ERROR, err)
+	}
+
+	done, err := runConfigTools(config)
+	if err != nil {
+		logging.Fatal(gameLog, "Tool failed", logging.ERROR, err)
+	}
+	if done {
+		return
+	}
+
+	err = validateConfig(config)
+	if err != nil {
+		logging.Fatal(gameLog, "Bad configuration", logging.ERROR, err)
+	}
+
+	joinQueue = CreateJoinQueue(config.maxPlayers, config.maxJoinQueue)
+
+	authenticator, err = createAuthenticator(config)
+	if err != nil {
+		logging.Fatal(authLog, "Couldn't set up authentication", logging.ERROR, err)
+	}
+
+	gameMaps, err = LoadGameMaps(config.mapPath)
+	if err != nil {
+		logging.Fatal(gameLog, "Couldn't load the maps", logging.ERROR, err)
+	}
+	for _, gm := range gameMaps {
+		gameLog.Info("Map loaded", "map", gm.Name, "spawns", len(gm.Spawns), "spawn_strategy", config.spawnStrategy)
+	}
+
+	banList, err = LoadBanList(config.banFile)
+	if err != nil {
+		logging.Fatal(netLog, "Couldn't load the ban list", logging.ERROR, err)
+	}
+
+	chatFilter, err = LoadChatFilter(config.chatFilter)
+	if err != nil {
+		logging.Fatal(chatLog, "Couldn't load the chat filter", logging.ERROR, err)
+	}
+
+	if config.recordPath != "" {
+		err = os.MkdirAll(config.recordPath, 0755)
+		if err != nil {
+			logging.Fatal(gameLog, "Couldn't create the recording directory", logging.ERROR, err)
+		}
+	}
+	if config.statsPath != "" {
+		err = os.MkdirAll(config.statsPath, 0755)
+		if err != nil {
+			logging.Fatal(gameLog, "Couldn't create the stats directory", logging.ERROR, err)
+		}
+	}
+
+	// Every player starts out in the default room
+	roomHolder = CreateRoomHolder(config.maxRooms)
+	defaultSettings, err := normalizeRoomSettings(protocol.RoomSettings{MaxPlayers: config.defaultRoomMaxPlayers, Mode: config.defaultRoomMode})
+	if err != nil {
+		logging.Fatal(gameLog, "Bad default room settings", logging.ERROR, err)
+	}
+	defaultRoom := roomHolder.OpenPersistent(config.defaultRoom, defaultSettings)
+	for _, name := range botList(config.bots) {
+		behavior, err := CreateBotBehavior(name, nil, gameMaps[0])
+		if err != nil {
+			logging.Fatal(gameLog, "Couldn't create bot", logging.ERROR, err)
+		}
+		defaultRoom.AddBot(behavior)
+	}
+
+	ratings, err := LoadRatings(config.matchRatings)
+	if err != nil {
+		logging.Fatal(matchLog, "Couldn't load the ratings file", logging.ERROR, err)
+	}
+	matchmaker = CreateMatchmaker(config.matchRules, ratings)
+	go matchmaker.Run()
+
+	// Make sure the recordings get finished properly when we're told to stop
+	go closeOnSignal()
+
+	var tlsConfig *tls.Config
+	if config.useTLS {
+		tlsConfig, err = transport.ServerConfig(config.tlsCert, config.tlsKey, config.tlsSelfSigned)
+		if err != nil {
+			logging.Fatal(netLog, "Couldn't set up TLS", logging.ERROR, err)
+		}
+		netLog.Info("TLS enabled", "fingerprint", transport.Fingerprint(tlsConfig.Certificates[0]))
+	}
 
 	// Start listening on the socket for incoming connections
-	go listenForConns()
+	go listenForConns(tlsConfig)
+
+	if config.adminConsole || config.adminAddr != "" {
+		console := CreateAdminConsole(config.adminPassword)
+		if config.adminConsole {
+			go console.Serve(os.Stdin, os.Stdout, "stdin")
+		}
+		if config.adminAddr != "" {
+			go console.ListenAndServe(config.adminAddr, tlsConfig)
+		}
+	}
+
+	if config.metricsAddr != "" {
+		go metrics.ListenAndServe(config.metricsAddr)
+	}
 
-	// Preset up the timestep stuff so there's a value for the first iteration of the loop
-	lastTick := time.Now()
-	var dt time.Duration
+	// Keep measuring everyone's round trip time
+	go pingClients()
 
+	// The rooms run themselves, all that's left here is housekeeping
 	for {
-		messages := messageQueue.PopAll()
-		for _, message := range messages {
+		time.Sleep(time.Second)
 
-			// The only message expected FROM the client is the move message
-			// so lets look for that one
-			if message.GetMessageType() != protocol.SEND_INPUT_MESSAGE {
-				log.Print("Got an invalid message type from client:", string(message.GetMessageType()))
-				continue
-			}
+		// Anyone who has been gone for longer than the grace period isn't coming back
+		for _, playerId := range sessionHolder.ExpireSessions(time.Now(), SESSION_GRACE_PERIOD) {
+			gameLog.Info("Session expired", logging.PLAYER_ID, playerId)
+			joinQueue.Release()
+		}
+
+		// Pick up bans made with the bans tool while we've been running
+		reloaded, err := banList.Reload()
+		if err != nil {
+			netLog.Error("Couldn't reload the ban list", logging.ERROR, err)
+		} else if reloaded {
+			netLog.Info("Ban list reloaded")
+			enforceBans()
+		}
+	}
+}
+
+// Wait for SIGINT or SIGTERM, then finish off the rooms' recordings and stats (if there are any)
+// and exit.  Without this the last part of each recording would still be sitting in a buffer, and
+// the matches still going would have no stats at all.
+func closeOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+
+	gameLog.Info("Shutting down", "signal", sig.String())
+	for _, room := range roomHolder.GetRooms() {
+		// Both happen on the room's loop, between ticks, so nothing is halfway through being
+		// recorded.  If the room doesn't answer in time its recording just ends at the last
+		// keyframe, which replays fine.
+		err := runInRoom(room, func() error {
+			room.writeStats()
+			room.recorder.Close()
+			return nil
+		})
+		if err != nil {
+			gameLog.Warn("Couldn't write stats or finish the recording", "room", room.name, logging.ERROR, err)
+		}
+	}
+	os.Exit(0)
+}
 
-			typed, ok := message.(*protocol.SendInputMessage)
-			if !ok {
-				log.Print("Message couldn't be asserted into SendInputMessage")
+// Concurrent function which spins in a loop, listening for new connections on the socket.  Each
+// new connection gets handed off to its own goroutine, which takes care of the join handshake.
+// Connections are TLS if tlsConfig isn't nil.
+func listenForConns(tlsConfig *tls.Config) {
+	server, err := transport.Listen(":"+shared.PORT, tlsConfig)
+	if server == nil || err != nil {
+		panic("couldn't start listening: " + err.Error())
+	}
+
+	netLog.Info("Server listening", logging.ADDR, server.Addr().String())
+
+	for {
+		newConn, err := server.Accept()
+
+		if err != nil {
+			netLog.Error("Error during accept", logging.ERROR, err)
+		}
+
+		if newConn != nil {
+			if reason, banned := banList.IsIPBanned(remoteIP(newConn)); banned {
+				netLog.Info("Refused banned address", logging.ADDR, newConn.RemoteAddr().String(), "reason", reason)
+				newConn.Close()
 				continue
 			}
 
-			ent := entityHolder.GetEntity(typed.PlayerId)
-			if ent == nil {
+			if !connCounter.Acquire(remoteIP(newConn), config.maxConnsPerIP) {
+				netHotLog.Warn("Refused connection, too many from this address", logging.ADDR, newConn.RemoteAddr().String())
+				newConn.Close()
 				continue
 			}
 
-			// Based on the client-provided frame delta and the time between recieved messages from
-			// this particular client, we decide if the client is telling the truth or not about
-			// their delta.
-			if !validateMessage(typed) {
+			netLog.Debug("Accepted connection", logging.ADDR, newConn.RemoteAddr().String())
+			go handleClient(newConn)
+		}
+	}
+}
 
-				// Still want this to happen even if we reject this message
-				if ent.lastSeqTime.Before(typed.GetRcvdTime()) {
-					ent.lastSeqTime = typed.GetRcvdTime()
-				}
-				continue
-			}
+// Wait for the JoinMessage which has to be the first thing a new connection sends.  If it carries
+// the token of a session which is still around, the client takes that session's player back.
+// Otherwise the client has to get past the authenticator, after which it generates an ID for the
+// new user and creates a new entity and session for it.  Either way the client object gets put
+// into the ClientHolder and is sent its ID and token.
+func joinClient(conn net.Conn, b *bufio.Reader) (*Client, error) {
+	conn.SetReadDeadline(time.Now().Add(JOIN_TIMEOUT))
+	defer conn.SetReadDeadline(time.Time{})
+
+	line, err := b.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
 
-			// Get the vector for the move
-			moveVec := shared.GetVectorFromInputAndDt(typed.Input, clampDeltaTime(typed.Dt))
+	message, err := protocol.DecodeMessage(line)
+	if err != nil {
+		return nil, err
+	}
 
-			// Get the seq
-			seq := typed.Seq
+	joinMsg, ok := message.(*protocol.JoinMessage)
+	if !ok {
+		return nil, errors.New("expected JOIN_MESSAGE as the first message")
+	}
 
-			// Move the unit
-			ent.Move(moveVec)
+	client := new(Client)
+	client.conn = conn
 
-			// Apply the new last sequence number and rcvd time
-			if ent.lastSeq < seq {
-				ent.lastSeq = seq
+	if joinMsg.SessionToken != "" && !joinMsg.Spectator {
+		client.sessionToken = joinMsg.SessionToken
+		session, previous := sessionHolder.Attach(joinMsg.SessionToken, client)
+		if session != nil {
+			client.clientId = session.playerId
+			client.username = session.entity.username
+			if reason, banned := banList.IsUsernameBanned(client.username); banned {
+				if previous != nil {
+					kickPlayer(previous.clientId, "banned: "+reason)
+				}
+				endSession(joinMsg.SessionToken)
+				writeMessage(conn, protocol.CreateJoinRejectedMessage("banned: "+reason))
+				return nil, errors.New("banned username " + client.username)
 			}
-			if ent.lastSeqTime.Before(typed.GetRcvdTime()) {
-				ent.lastSeqTime = typed.GetRcvdTime()
+			if previous != nil {
+				// The old connection is probably half-dead, but make sure it's gone
+				previous.conn.Close()
 			}
-		}
+			clientHolder.AddClient(client)
+			authLog.Info("Player reconnected", logging.PLAYER_ID, client.clientId, "username", client.username)
 
-		// OK, all messages processed for this tick, send out an entity message
-		// We'll take stock of where all the entities are and send out an updated world state.
-		msgEnts := make([]protocol.MessageEntity, 0)
-		for _, ent := range entityHolder.GetEntities() {
-			msgEnts = append(msgEnts, protocol.MessageEntity{Id: ent.entityId, Position: ent.position, LastSeq: ent.lastSeq})
+			sendUUIDToPlayer(client.clientId, client)
+			rejoinRoom(client, session)
+			return client, nil
 		}
+		authLog.Info("Unknown or expired session token, joining as a new player", logging.ADDR, conn.RemoteAddr().String())
+	}
+
+	username, err := authenticator.Authenticate(joinMsg.Username, joinMsg.Credential)
+	if err != nil {
+		writeMessage(conn, protocol.CreateJoinRejectedMessage(err.Error()))
+		return nil, err
+	}
+
+	if reason, banned := banList.IsUsernameBanned(username); banned {
+		writeMessage(conn, protocol.CreateJoinRejectedMessage("banned: "+reason))
+		return nil, errors.New("banned username " + username)
+	}
+
+	// A player who dropped out still has their name until their session runs out, so they can
+	// come back to it.  The players and spectators on right now are checked again as they're
+	// added, in case somebody else gets in first.
+	if username != "" && (sessionHolder.HasUsername(username) || clientHolder.GetClientByUsername(username) != nil) {
+		writeMessage(conn, protocol.CreateJoinRejectedMessage(ErrUsernameTaken.Error()))
+		return nil, ErrUsernameTaken
+	}
+
+	if joinMsg.Spectator {
+		return joinSpectator(client, username)
+	}
+
+	err = waitForSlot(conn, b)
+	if err != nil {
+		return nil, err
+	}
+
+	playerId := idGen.GetNextId()
+	if username == "" {
+		username = fmt.Sprintf("player%v", playerId)
+	}
+	authLog.Info("Player joined", logging.PLAYER_ID, playerId, "username", username, logging.ADDR, conn.RemoteAddr().String())
 
-		worldStateMessage := protocol.CreateWorldStateMessage(msgEnts)
-		broadcastMessage(worldStateMessage)
+	player := CreatePlayerEntity(playerId, username)
+	client.clientId = playerId
+	client.username = username
 
-		// Get how long it took to do all of this
-		now := time.Now()
-		dt = now.Sub(lastTick)
-		lastTick = now
+	if err := clientHolder.AddPlayer(client); err != nil {
+		joinQueue.Release()
+		writeMessage(conn, protocol.CreateJoinRejectedMessage(err.Error()))
+		return nil, err
+	}
+
+	room, err := roomHolder.Move(client, player, config.defaultRoom, ROOM_JOIN_EXISTING, protocol.RoomSettings{})
+	if err != nil {
+		clientHolder.RemoveClient(client)
+		joinQueue.Release()
+		writeMessage(conn, protocol.CreateJoinRejectedMessage(err.Error()))
+		return nil, err
+	}
+
+	client.sessionToken = sessionHolder.CreateSession(player, client).token
+	sessionHolder.SetRoom(client.sessionToken, room, player)
+
+	sendUUIDToPlayer(playerId, client)
+	sendRoomChanged(client, room, "")
+	return client, nil
+}
 
-		// If it took less long than SLEEP_TIME, sleep for the difference, otherwise this ends
-		// up sending A LOT of messages with no changes to the clients.
-		//
-		// Alternatively, we could check to see if the world state has changed and only send it out
-		// when something new has happened.
-		if dt < SLEEP_TIME {
-			time.Sleep(SLEEP_TIME - dt)
+// Take one of the server's player slots for a new player, waiting in the join queue if they're all
+// taken.  While the player waits they're told their place in the queue every time it changes.
+// Returns an error if the queue is full too, or if the player goes away before their turn.
+func waitForSlot(conn net.Conn, b *bufio.Reader) error {
+	ticket, err := joinQueue.Enter()
+	if err != nil {
+		writeMessage(conn, protocol.CreateJoinRejectedMessage(err.Error()))
+		return err
+	}
+	if ticket == nil {
+		return nil
+	}
+
+	netLog.Info("Server full, player queued", logging.ADDR, conn.RemoteAddr().String())
+	lastPosition := 0
+	for {
+		position, length := joinQueue.Position(ticket)
+		if position == 0 {
+			netLog.Info("Queued player let in", logging.ADDR, conn.RemoteAddr().String())
+			return nil
+		}
+		if position != lastPosition {
+			writeMessage(conn, protocol.CreateQueueStatusMessage(position, length))
+			lastPosition = position
+		}
+
+		// Nothing the client sends means anything until it's in, but reading is the only way to
+		// find out it has hung up
+		conn.SetReadDeadline(time.Now().Add(JOIN_QUEUE_POLL))
+		_, err := b.ReadSlice('\n')
+		var netErr net.Error
+		if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+			joinQueue.Leave(ticket)
+			return err
 		}
 	}
 }
 
-// Concurrent function which spins in a loop, listening for new connections on the socket.  When it
-// gets one, it generates an ID for the new user, creates a client object which gets put into the
-// ClientHolder and then sends that client their ID.
-func listenForConns() {
-	server, err := net.Listen("tcp", ":"+shared.PORT)
-	if server == nil || err != nil {
-		panic("couldn't start listening: " + err.Error())
+// Put a reconnected player back into the room they were in.  If it was torn down while they were
+// away it gets opened again with the same settings.  If there's no room for them any more they
+// end up outside of all rooms.
+func rejoinRoom(client *Client, session *Session) {
+	if session.roomName == "" {
+		sendRoomChanged(client, nil, "")
+		return
 	}
 
-	log.Print("SERVER LISTENING")
+	// A match room which has gone away means the match is over, so it's back to the lobby.  Any
+	// other room gets opened again.
+	name, mode := session.roomName, ROOM_JOIN_OR_CREATE
+	if strings.HasPrefix(name, MATCH_ROOM_PREFIX) && roomHolder.GetRoom(name) == nil {
+		name, mode = config.defaultRoom, ROOM_JOIN_EXISTING
+	}
 
-	for {
-		newConn, err := server.Accept()
+	room, err := roomHolder.Move(client, session.entity, name, mode, session.roomSettings)
+	if err != nil {
+		gameLog.Info("Couldn't put player back in their room", logging.PLAYER_ID, client.clientId, "room", session.roomName, logging.ERROR, err)
+		sessionHolder.SetRoom(client.sessionToken, nil, nil)
+		sendRoomChanged(client, nil, err.Error())
+		return
+	}
 
+	sendRoomChanged(client, room, "")
+}
+
+// Deal with a client asking to see, create, join or leave rooms.  These are answered straight
+// away instead of going through a room's loop.  Returns false if the message isn't about rooms.
+func handleRoomMessage(client *Client, message protocol.Message) bool {
+	switch typed := message.(type) {
+	case *protocol.ListRoomsMessage:
+		writeMessage(client.conn, protocol.CreateRoomListMessage(roomHolder.List()))
+
+	case *protocol.CreateRoomMessage:
+		settings, err := normalizeRoomSettings(typed.Settings)
+		if err == nil {
+			err = checkRoomName(typed.Room)
+		}
+		if err == nil && strings.HasPrefix(typed.Room, MATCH_ROOM_PREFIX) {
+			err = errors.New("room names starting with " + MATCH_ROOM_PREFIX + " are kept for matches")
+		}
 		if err != nil {
-			log.Printf("ERROR DURING ACCEPT: %v", err)
+			refuseRoomChange(client, err)
+			break
 		}
+		changeRoom(client, typed.Room, ROOM_CREATE, settings)
 
-		if newConn != nil {
-			playerId := idGen.GetNextId()
-			log.Printf("ACCEPTED: %v <-> %v\n", newConn.LocalAddr(), newConn.RemoteAddr())
-			log.Printf("Player # is: %v\n", playerId)
+	case *protocol.JoinRoomMessage:
+		changeRoom(client, typed.Room, ROOM_JOIN_EXISTING, protocol.RoomSettings{})
 
-			player := CreatePlayerEntity(playerId, shared.FloatVector{X: 30, Y: 30})
-			entityHolder.AddEntity(player)
+	case *protocol.LeaveRoomMessage:
+		roomHolder.Leave(client, true)
+		sessionHolder.SetRoom(client.sessionToken, nil, nil)
+		gameLog.Info("Player left their room", logging.PLAYER_ID, client.clientId)
+		sendRoomChanged(client, nil, "")
 
-			client := new(Client)
-			client.conn = newConn
-			client.clientId = playerId
-			clientHolder.AddClient(client)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Move a client into another room.  Players get a fresh entity there.  Returns the room, or nil if
+// the client was refused.
+func changeRoom(client *Client, name string, mode RoomEntryMode, settings protocol.RoomSettings) *Room {
+	var entity *PlayerEntity
+	if !client.spectator {
+		entity = CreatePlayerEntity(client.clientId, client.username)
+
+		// The client's sequence numbers keep counting up across rooms.  The old room's loop is
+		// still moving its entity, so the loop is asked for the number.  If it doesn't answer in
+		// time the new entity starts from zero, the same as in a brand new room.
+		if old := client.GetRoom(); old != nil {
+			seqs := make(chan int64, 1)
+			old.Do(func() {
+				if oldEntity := old.entities.GetEntity(client.clientId); oldEntity != nil {
+					seqs <- oldEntity.lastSeq
+				}
+				close(seqs)
+			})
+			select {
+			case seq := <-seqs:
+				entity.lastSeq = seq
+			case <-time.After(ADMIN_TASK_TIMEOUT):
+			}
+		}
+	}
+
+	room, err := roomHolder.Move(client, entity, name, mode, settings)
+	if err != nil {
+		refuseRoomChange(client, err)
+		return nil
+	}
+
+	if entity != nil {
+		sessionHolder.SetRoom(client.sessionToken, room, entity)
+	}
+	gameLog.Info("Player changed room", logging.PLAYER_ID, client.clientId, "room", room.name)
+	sendRoomChanged(client, room, "")
+	return room
+}
+
+// Tell a client why it couldn't have the room it asked for.  It stays where it was.
+func refuseRoomChange(client *Client, err error) {
+	sendRoomChanged(client, client.GetRoom(), err.Error())
+}
+
+// Tell a client which room it's in now, and how that room is set up.  A nil room means none.
+func sendRoomChanged(client *Client, room *Room, reason string) {
+	if room == nil {
+		writeMessage(client.conn, protocol.CreateRoomChangedMessage("", reason, protocol.RoomSettings{}, nil))
+		return
+	}
+
+	writeMessage(client.conn, protocol.CreateRoomChangedMessage(room.name, reason, room.Settings(), room.mode.Teams()))
+}
+
+// Deal with a line of chat from a client.  Chat skips the rooms' loops too, going straight out to
+// whoever it's for once it has been checked and filtered.  Anything which stops it is explained to
+// the sender with a system line.  Returns false if the message isn't chat.
+func handleChatMessage(client *Client, message protocol.Message) bool {
+	typed, ok := message.(*protocol.SendChatMessage)
+	if !ok {
+		return false
+	}
+
+	if left := chatFilter.MutedFor(client.username, time.Now()); left > 0 {
+		sendChatNotice(client, fmt.Sprintf("You're muted for another %v", left.Round(time.Second)))
+		return true
+	}
+
+	if !client.chatBucket.Take(time.Now(), 1) {
+		client.chatStrikes++
+		if client.chatStrikes < CHAT_MUTE_STRIKES {
+			sendChatNotice(client, "You're sending messages too quickly")
+			return true
+		}
 
-			sendUUIDToPlayer(playerId, client)
+		client.chatStrikes = 0
+		chatFilter.Mute(client.username, time.Now().Add(config.chatMuteTime))
+		chatLog.Info("Muted for flooding", logging.PLAYER_ID, client.clientId, "username", client.username, "duration", config.chatMuteTime)
+		sendChatNotice(client, fmt.Sprintf("You've been muted for %v for flooding the chat", config.chatMuteTime))
+		return true
+	}
+	client.chatStrikes = 0
+
+	text := sanitizeChat(typed.Text)
+	if text == "" {
+		return true
+	}
+	if utf8.RuneCountInString(text) > config.chatMaxLength {
+		sendChatNotice(client, fmt.Sprintf("Messages can't be longer than %v characters", config.chatMaxLength))
+		return true
+	}
+	text = chatFilter.Clean(text)
+
+	var recipients []*Client
+	target := ""
+	switch typed.Scope {
+	case protocol.CHAT_SCOPE_GLOBAL:
+		recipients = clientHolder.GetClients()
+
+	case protocol.CHAT_SCOPE_TEAM:
+		if client.spectator {
+			sendChatNotice(client, "Spectators aren't on a team")
+			return true
+		}
+		if client.GetTeam() == "" {
+			sendChatNotice(client, "You're not on a team")
+			return true
+		}
+		recipients = teammates(client)
+
+	case protocol.CHAT_SCOPE_WHISPER:
+		other := clientHolder.GetClientByUsername(typed.Target)
+		if other == nil {
+			sendChatNotice(client, fmt.Sprintf("Nobody called %v is here", typed.Target))
+			return true
+		}
+
+		// The sender gets a copy so they can see what they whispered
+		target = other.username
+		recipients = []*Client{other}
+		if other != client {
+			recipients = append(recipients, client)
+		}
+
+	default:
+		sendChatNotice(client, "Unknown chat scope")
+		return true
+	}
+
+	chatLog.Info("Chat", "scope", typed.Scope, logging.PLAYER_ID, client.clientId, "username", client.username, "target", target, "text", text)
+	msg := protocol.CreateChatMessage(typed.Scope, client.clientId, client.username, target, text)
+	for _, c := range recipients {
+		writeMessage(c.conn, msg)
+	}
+	return true
+}
 
-			go handleClient(client)
+// Get the players in the same room and on the same team as a client, the client included
+func teammates(client *Client) []*Client {
+	room, team := client.GetRoom(), client.GetTeam()
+	if room == nil || team == "" {
+		return []*Client{client}
+	}
+
+	mates := make([]*Client, 0)
+	for _, c := range room.members.GetClients() {
+		if !c.spectator && c.GetTeam() == team {
+			mates = append(mates, c)
 		}
 	}
+	return mates
+}
+
+// Deal with a player asking to switch teams.  The switch happens in the room's loop, since that's
+// where the entity lives, and the player is told if it couldn't be made.  Returns false if the
+// message isn't about teams.
+func handleTeamMessage(client *Client, message protocol.Message) bool {
+	typed, ok := message.(*protocol.ChooseTeamMessage)
+	if !ok {
+		return false
+	}
+
+	room := client.GetRoom()
+	if room == nil || client.spectator {
+		sendChatNotice(client, "You have to be playing in a room to pick a team")
+		return true
+	}
+
+	room.Do(func() {
+		ent := room.entities.GetEntity(client.clientId)
+		if ent == nil {
+			return
+		}
+
+		if err := room.ChangeTeam(ent, typed.Team, false); err != nil {
+			sendChatNotice(client, "Can't switch teams: "+err.Error())
+		}
+	})
+	return true
+}
+
+// Send a system line of chat to a single client
+func sendChatNotice(client *Client, text string) {
+	writeMessage(client.conn, protocol.CreateChatMessage(protocol.CHAT_SCOPE_SYSTEM, 0, "", "", text))
+}
+
+// Finish letting in a client which only wants to watch.  Spectators get an ID like everyone else,
+// so they can be told apart and kicked, but no entity and no session - there's nothing for them
+// to come back to after a reconnect.
+func joinSpectator(client *Client, username string) (*Client, error) {
+	client.clientId = idGen.GetNextId()
+	client.spectator = true
+	client.username = username
+	if client.username == "" {
+		client.username = fmt.Sprintf("spectator%v", client.clientId)
+	}
+
+	if err := clientHolder.AddSpectator(client, config.maxSpectators); err != nil {
+		writeMessage(client.conn, protocol.CreateJoinRejectedMessage(err.Error()))
+		return nil, err
+	}
+	authLog.Info("Spectator joined", logging.PLAYER_ID, client.clientId, "username", client.username, logging.ADDR, client.conn.RemoteAddr().String())
+
+	room, err := roomHolder.Move(client, nil, config.defaultRoom, ROOM_JOIN_EXISTING, protocol.RoomSettings{})
+	if err != nil {
+		clientHolder.RemoveClient(client)
+		writeMessage(client.conn, protocol.CreateJoinRejectedMessage(err.Error()))
+		return nil, err
+	}
+
+	sendUUIDToPlayer(client.clientId, client)
+	sendRoomChanged(client, room, "")
+	return client, nil
 }
 
 // Handle an individual client connection.  Runs concurrently in a goroutine.  As it recieves new
 // input messages, it puts them in the global MessageQueue so they'll be processed by the main server
 // loop.  Also responsible for handling client disconnection.
-func handleClient(client *Client) {
-	log.Println("Handlin' client")
-	b := bufio.NewReader(client.conn)
+func handleClient(conn net.Conn) {
+	defer connCounter.Release(remoteIP(conn))
+
+	// The reader's buffer is the cap on line length - ReadSlice gives up with ErrBufferFull
+	// rather than growing it.  Lines it returns are only good until the next read, which is fine
+	// since they get decoded straight away.
+	b := bufio.NewReaderSize(conn, config.maxLineLength)
+
+	client, err := joinClient(conn, b)
+	if err != nil {
+		authLog.Info("Join failed", logging.ADDR, conn.RemoteAddr().String(), logging.ERROR, err)
+		conn.Close()
+		return
+	}
+
+	messageBucket := CreateTokenBucket(config.maxMessageRate, config.maxMessageBurst)
+	byteBucket := CreateTokenBucket(config.maxByteRate, config.maxByteRate)
+	client.chatBucket = CreateTokenBucket(config.chatRate, config.chatBurst)
+
 	for {
-		line, err := b.ReadBytes('\n')
+		line, err := b.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			netLog.Warn("Line too long, disconnecting", logging.PLAYER_ID, client.clientId, "max", config.maxLineLength)
+			break
+		}
 		if err != nil {
 			break
 		}
 
+		if !rateLimit(client, messageBucket, byteBucket, len(line)) {
+			if client.addFloodDrop(time.Now()) >= FLOOD_KICK_SCORE {
+				kickPlayer(client.clientId, "kicked for flooding")
+				break
+			}
+			continue
+		}
+
 		if string(line) == "" || string(line) == "\n" {
 			continue
 		}
@@ -187,22 +867,95 @@ func handleClient(client *Client) {
 		// Dispatch client messages
 		message, err := protocol.DecodeMessage(line)
 		if err != nil {
-			log.Println("Error when reading message:", err.Error())
+			netHotLog.Warn("Error when reading message", logging.PLAYER_ID, client.clientId, logging.ERROR, err)
+			continue
+		}
+		metrics.CountReceived(message.GetMessageType(), len(line))
+
+		// Pongs are answered right here rather than going through the main loop
+		if pong, ok := message.(*protocol.PongMessage); ok {
+			client.SetRTT(time.Since(pong.PingSentTime))
+			continue
+		}
+
+		if handleRoomMessage(client, message) || handleMatchmakingMessage(client, message) ||
+			handleChatMessage(client, message) || handleTeamMessage(client, message) {
+			continue
+		}
+
+		// Spectators only watch, anything else they send is thrown away
+		if client.spectator {
+			if message.GetMessageType() == protocol.SEND_INPUT_MESSAGE {
+				validationLog.Info("Input from spectator", logging.PLAYER_ID, client.clientId)
+				metrics.CountRejectedInput("spectator")
+			}
 			continue
 		}
 
-		if validateMessageClientId(message, client.clientId) {
+		// Inputs go to the client's room.  Outside of a room there's nothing to move.
+		room := client.GetRoom()
+		if room != nil && validateMessageClientId(message, client.clientId) {
 			message.SetRcvdTime(time.Now())
-			messageQueue.PushMessage(message)
+			room.PushMessage(message)
 		}
 	}
 
 	// EOF happened - this client has disconnected
-	log.Printf("Player: %v left\n", client.clientId)
+	netLog.Info("Player left", logging.PLAYER_ID, client.clientId,
+		"throttled", atomic.LoadInt64(&client.throttled), "dropped", atomic.LoadInt64(&client.dropped))
+	conn.Close()
 	clientHolder.RemoveClient(client)
 
-	// remove the entity from the holder
-	entityHolder.RemoveEntity(client.clientId)
+	// Park the entity in its session until the player comes back or the grace period runs out.
+	// If a reconnect already took the session over, the entity stays in the world for the new
+	// client.
+	detached := sessionHolder.Detach(client.sessionToken, client)
+	roomHolder.Leave(client, detached)
+
+	// Nobody waits for a match on a connection that's gone, unless it has been replaced already
+	if clientHolder.GetClient(client.clientId) == nil {
+		matchmaker.Dequeue(client.clientId)
+	}
+}
+
+// Count a dropped message towards the client's flood score, after letting the score wear off for
+// the time since the last one, and return the new score
+func (c *Client) addFloodDrop(now time.Time) float64 {
+	if !c.floodScoreTime.IsZero() {
+		c.floodScore = max(c.floodScore-now.Sub(c.floodScoreTime).Seconds()*FLOOD_DECAY_PER_SECOND, 0)
+	}
+	c.floodScoreTime = now
+	c.floodScore++
+	return c.floodScore
+}
+
+// Check one incoming line of the given size against a client's message and byte buckets.  If the
+// buckets are only a little short, wait for them to refill (throttling the client, since we stop
+// reading its socket meanwhile).  If they're far short, drop the message.  Returns false if the
+// message was dropped.
+func rateLimit(client *Client, messageBucket, byteBucket *TokenBucket, size int) bool {
+	now := time.Now()
+	wait := messageBucket.WaitTime(now, 1)
+	if byteWait := byteBucket.WaitTime(now, float64(size)); byteWait > wait {
+		wait = byteWait
+	}
+
+	if wait > THROTTLE_MAX_WAIT {
+		atomic.AddInt64(&client.dropped, 1)
+		atomic.AddInt64(&totalDropped, 1)
+		return false
+	}
+
+	if wait > 0 {
+		atomic.AddInt64(&client.throttled, 1)
+		atomic.AddInt64(&totalThrottled, 1)
+		time.Sleep(wait)
+		now = time.Now()
+	}
+
+	messageBucket.Take(now, 1)
+	byteBucket.Take(now, float64(size))
+	return true
 }
 
 // Attempt to use the time difference between when the latest and previous messages were
@@ -213,24 +966,81 @@ func handleClient(client *Client) {
 // A potential for improvement would be to look at the average time between sends for a client
 // and start to do some prediction.  It could allow for flexibility since both the network
 // and the client app can hit unexpected latency (network because network and client because GC hits)
-func validateMessage(msg *protocol.SendInputMessage) bool {
-
-	player := entityHolder.GetEntity(msg.PlayerId)
-	if player == nil {
-		log.Printf("Trying to validate message from disconnected player: %v", msg.PlayerId)
-		return false
-	}
-
+func validateMessage(player *PlayerEntity, msg *protocol.SendInputMessage) bool {
 	timeDiff := shared.MDuration{msg.GetRcvdTime().Sub(player.lastSeqTime)}
 
 	if msg.Dt.Milliseconds() > timeDiff.Milliseconds()+shared.MAX_DT_DIFF_MILLIS {
-		log.Printf("Message from player %v with seq: %v rejected because delta %v ms is longer than diff between last msg rcv %v + max added %v.",
-			msg.PlayerId, msg.Seq, msg.Dt.Milliseconds(), timeDiff.Milliseconds(), shared.MAX_DT_DIFF_MILLIS)
+		validationLog.Info("Message rejected, delta longer than time since last message",
+			logging.PLAYER_ID, msg.PlayerId, logging.SEQ, msg.Seq, "dt_ms", msg.Dt.Milliseconds(),
+			"since_last_ms", timeDiff.Milliseconds(), "allowed_extra_ms", shared.MAX_DT_DIFF_MILLIS)
 		return false
 	}
 	return true
 }
 
+// Throw a player off the server.  Their session ends with them so they can't come straight back
+// to the same entity.
+func kickPlayer(id int64, reason string) {
+	client := clientHolder.GetClient(id)
+	if client == nil {
+		return
+	}
+
+	netLog.Warn("Kicking player", logging.PLAYER_ID, id, "reason", reason)
+	writeMessage(client.conn, protocol.CreateDisconnectMessage(reason))
+	endSession(client.sessionToken)
+	roomHolder.Leave(client, true)
+	client.conn.Close()
+}
+
+// End a player's session for good, giving their slot to whoever is next in the join queue
+func endSession(token string) {
+	if sessionHolder.End(token) {
+		joinQueue.Release()
+	}
+}
+
+// Ban a player's username and address for the given duration (0 for forever), then kick them.
+// The player still gets kicked if the ban couldn't be written to the ban file.
+func banPlayer(id int64, reason string, duration time.Duration) {
+	client := clientHolder.GetClient(id)
+	if client == nil {
+		return
+	}
+
+	if err := banList.BanNetwork(remoteIP(client.conn), reason, duration); err != nil {
+		netLog.Error("Couldn't ban address", logging.PLAYER_ID, id, logging.ERROR, err)
+	}
+	if err := banList.BanUsername(client.username, reason, duration); err != nil {
+		netLog.Error("Couldn't ban username", logging.PLAYER_ID, id, logging.ERROR, err)
+	}
+	kickPlayer(id, reason)
+}
+
+// Kick everyone who is connected but banned, by username or by address.  Called whenever bans get
+// added from somewhere other than banPlayer.
+func enforceBans() {
+	for _, client := range clientHolder.GetClients() {
+		reason, banned := banList.IsUsernameBanned(client.username)
+		if !banned {
+			reason, banned = banList.IsIPBanned(remoteIP(client.conn))
+		}
+		if banned {
+			kickPlayer(client.clientId, "banned: "+reason)
+		}
+	}
+}
+
+// Get just the IP part of a connection's remote address
+func remoteIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+
+	return host
+}
+
 // Clamp a delta to the max allowed value for sanity's sake
 func clampDeltaTime(in shared.MDuration) shared.MDuration {
 	maxDT := shared.MDuration{shared.MAX_DT}
@@ -249,7 +1059,7 @@ func validateMessageClientId(message protocol.Message, clientId int64) bool {
 	if message.GetMessageType() == protocol.SEND_INPUT_MESSAGE {
 		typed, ok := message.(*protocol.SendInputMessage)
 		if !ok {
-			log.Println("Message couldn't be asserted into SendInputMessage")
+			netHotLog.Error("Message couldn't be asserted into SendInputMessage")
 			return false
 		}
 
@@ -261,14 +1071,14 @@ func validateMessageClientId(message protocol.Message, clientId int64) bool {
 	}
 
 	// The other messages don't come from players so this doesn't make any sense.
-	log.Println("Someone sent a bad message to the server - only expecting SEND_INPUT_MESSAGE, got: ", message.GetMessageType())
+	netHotLog.Warn("Someone sent a bad message to the server, only expecting SEND_INPUT_MESSAGE", logging.PLAYER_ID, clientId, logging.MESSAGE_TYPE, message.GetMessageType())
 	return false
 }
 
 // Sends a UUID message to a player.
 func sendUUIDToPlayer(id int64, client *Client) {
-	msg := protocol.CreatePlayerUUIDMessage(id)
-	sendMessageToClient(msg, id)
+	msg := protocol.CreatePlayerUUIDMessage(id, client.sessionToken)
+	writeMessage(client.conn, msg)
 }
 
 // Send a message to all players
@@ -276,6 +1086,7 @@ func broadcastMessage(msg protocol.Message) {
 	encoded := msg.Encode()
 	for _, c := range clientHolder.GetClients() {
 		c.conn.Write(encoded)
+		metrics.CountSent(msg.GetMessageType(), len(encoded))
 	}
 }
 
@@ -283,6 +1094,22 @@ func broadcastMessage(msg protocol.Message) {
 func sendMessageToClient(msg protocol.Message, cid int64) {
 	c := clientHolder.GetClient(cid)
 	if c != nil {
-		c.conn.Write(msg.Encode())
+		writeMessage(c.conn, msg)
+	}
+}
+
+// Write a message to a connection, counting it in the metrics
+func writeMessage(conn net.Conn, msg protocol.Message) {
+	encoded := msg.Encode()
+	conn.Write(encoded)
+	metrics.CountSent(msg.GetMessageType(), len(encoded))
+}
+
+// Concurrent function which pings every client once per PING_INTERVAL, forever.  The pongs come
+// back through handleClient.
+func pingClients() {
+	for {
+		time.Sleep(PING_INTERVAL)
+		broadcastMessage(protocol.CreatePingMessage())
 	}
 }
@@ -0,0 +1,117 @@
+package pathfinding
+
+import (
+	"math"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// One square of a Grid, by column and row
+type Cell struct {
+	X int
+	Y int
+}
+
+// The navigation grid for a map: the positions an entity can be at, rounded to cells cellSize
+// pixels across, and whether it's allowed to be there.  A cell stands for an entity with its top
+// left corner at the cell's top left corner, the same way entity positions work, so a walkable
+// cell means the entity's whole square is clear.  Once created a grid never changes, so it can be
+// shared between goroutines.
+type Grid struct {
+	cols     int
+	rows     int
+	cellSize float32
+	walkable []bool
+}
+
+// Number of columns and rows in the grid
+func (g *Grid) Size() (int, int) {
+	return g.cols, g.rows
+}
+
+// Whether the cell is inside the grid
+func (g *Grid) Contains(c Cell) bool {
+	return c.X >= 0 && c.Y >= 0 && c.X < g.cols && c.Y < g.rows
+}
+
+// Whether an entity can be in the cell.  Cells outside the grid never are.
+func (g *Grid) Walkable(c Cell) bool {
+	return g.Contains(c) && g.walkable[c.Y*g.cols+c.X]
+}
+
+// The cell a position falls in, clamped to the grid
+func (g *Grid) CellOf(pos shared.FloatVector) Cell {
+	c := Cell{X: int(math.Round(float64(pos.X / g.cellSize))), Y: int(math.Round(float64(pos.Y / g.cellSize)))}
+	c.X = min(max(c.X, 0), g.cols-1)
+	c.Y = min(max(c.Y, 0), g.rows-1)
+	return c
+}
+
+// The position a cell stands for
+func (g *Grid) PositionOf(c Cell) shared.FloatVector {
+	return shared.FloatVector{X: float32(c.X) * g.cellSize, Y: float32(c.Y) * g.cellSize}
+}
+
+// The walkable cell closest to the given one, searching outwards ring by ring.  Returns false if
+// nothing in the grid is walkable.
+func (g *Grid) NearestWalkable(c Cell) (Cell, bool) {
+	if g.Walkable(c) {
+		return c, true
+	}
+
+	for ring := 1; ring < max(g.cols, g.rows); ring++ {
+		for dy := -ring; dy <= ring; dy++ {
+			for dx := -ring; dx <= ring; dx++ {
+				// Only the edge of the ring, the inside was covered by the smaller rings
+				if dx != -ring && dx != ring && dy != -ring && dy != ring {
+					continue
+				}
+				if n := (Cell{X: c.X + dx, Y: c.Y + dy}); g.Walkable(n) {
+					return n, true
+				}
+			}
+		}
+	}
+
+	return Cell{}, false
+}
+
+// Whether an entity could move in a straight line between two positions without going through a
+// cell it can't be in.  The line is checked at every quarter of a cell along the way.
+func (g *Grid) LineOfSight(from, to shared.FloatVector) bool {
+	dx, dy := to.X-from.X, to.Y-from.Y
+	steps := int(math.Ceil(math.Hypot(float64(dx), float64(dy)) / float64(g.cellSize/4)))
+	for i := 0; i <= steps; i++ {
+		t := float32(1)
+		if steps > 0 {
+			t = float32(i) / float32(steps)
+		}
+
+		// The entity's square spans four cells when it's between them, and all four have to be clear
+		x, y := (from.X+dx*t)/g.cellSize, (from.Y+dy*t)/g.cellSize
+		x0, y0 := int(math.Floor(float64(x))), int(math.Floor(float64(y)))
+		x1, y1 := int(math.Ceil(float64(x))), int(math.Ceil(float64(y)))
+		if !g.Walkable(Cell{x0, y0}) || !g.Walkable(Cell{x1, y0}) || !g.Walkable(Cell{x0, y1}) || !g.Walkable(Cell{x1, y1}) {
+			return false
+		}
+	}
+	return true
+}
+
+// Create the grid for positions from 0,0 to maxX,maxY, with cells cellSize pixels across.  blocked
+// says whether an entity at a position would be in the way of something.
+func CreateGrid(maxX, maxY, cellSize float32, blocked func(pos shared.FloatVector) bool) *Grid {
+	g := &Grid{
+		cols:     int(maxX/cellSize) + 1,
+		rows:     int(maxY/cellSize) + 1,
+		cellSize: cellSize,
+	}
+
+	g.walkable = make([]bool, g.cols*g.rows)
+	for y := 0; y < g.rows; y++ {
+		for x := 0; x < g.cols; x++ {
+			g.walkable[y*g.cols+x] = !blocked(g.PositionOf(Cell{x, y}))
+		}
+	}
+	return g
+}
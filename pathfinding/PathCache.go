@@ -0,0 +1,79 @@
+package pathfinding
+
+import (
+	"sync"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Most paths a PathCache holds before it starts again from empty
+const PATH_CACHE_SIZE int = 256
+
+// Which path a cached path is, by the cells at its ends
+type pathKey struct {
+	from Cell
+	to   Cell
+}
+
+// Remembers paths which have already been found on a grid, so a crowd of bots after the same
+// thing don't all do the same search.  Paths are looked up by the cells at their ends, so a cached
+// path starts from the first cell's position rather than exactly where it was asked for.  Thread
+// safe.
+type PathCache struct {
+	lock  sync.Mutex
+	grid  *Grid
+	paths map[pathKey][]shared.FloatVector
+}
+
+// Find a path across the grid, the same as FindPath, using a cached one if there is one.  Asking
+// with a different grid than last time throws out everything in the cache, since the paths were
+// for a map that's gone.
+func (pc *PathCache) FindPath(g *Grid, from, to shared.FloatVector) ([]shared.FloatVector, bool) {
+	key := pathKey{g.CellOf(from), g.CellOf(to)}
+
+	pc.lock.Lock()
+	if pc.grid != g {
+		pc.grid = g
+		pc.paths = make(map[pathKey][]shared.FloatVector)
+	}
+	path, ok := pc.paths[key]
+	pc.lock.Unlock()
+	if ok {
+		return path, path != nil
+	}
+
+	path, ok = FindPath(g, g.PositionOf(key.from), to)
+	if !ok {
+		path = nil
+	}
+
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	if pc.grid == g {
+		if len(pc.paths) >= PATH_CACHE_SIZE {
+			pc.paths = make(map[pathKey][]shared.FloatVector)
+		}
+		pc.paths[key] = path
+	}
+	return path, ok
+}
+
+// Throw away every cached path, because the map they were found on has changed
+func (pc *PathCache) Invalidate() {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	pc.grid = nil
+	pc.paths = make(map[pathKey][]shared.FloatVector)
+}
+
+// Number of paths in the cache
+func (pc *PathCache) Len() int {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	return len(pc.paths)
+}
+
+// Create an empty cache
+func CreatePathCache() *PathCache {
+	return &PathCache{paths: make(map[pathKey][]shared.FloatVector)}
+}
@@ -0,0 +1,165 @@
+// Finds ways around the obstacles on a map, for things like bots which can't see where they're
+// going.  A map is turned into a Grid of the spots an entity can be, FindPath searches it with A*
+// and straightens the result out, and a PathCache saves doing the same search over and over.
+package pathfinding
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Cost of moving to a neighbouring cell straight across, and diagonally
+const (
+	STRAIGHT_COST float64 = 1
+	DIAGONAL_COST float64 = math.Sqrt2
+)
+
+// The eight cells around a cell, as offsets
+var neighbours = []Cell{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+
+// Find a way for an entity to get from one position to another without running into anything.
+// The path is a list of waypoints, each one in a straight line from the one before it, starting
+// from the first step and ending at the goal.  It's empty if the entity is already there.
+//
+// If the start is somewhere the entity shouldn't be, like on the edge of an obstacle, the path
+// starts from the closest cell it could be in.  If the goal is, the path goes as close as it can.
+// Returns false if the goal can't be reached at all.
+func FindPath(g *Grid, from, to shared.FloatVector) ([]shared.FloatVector, bool) {
+	start, ok := g.NearestWalkable(g.CellOf(from))
+	if !ok {
+		return nil, false
+	}
+	goal, ok := g.NearestWalkable(g.CellOf(to))
+	if !ok {
+		return nil, false
+	}
+
+	cells, ok := search(g, start, goal)
+	if !ok {
+		return nil, false
+	}
+
+	points := make([]shared.FloatVector, 0, len(cells)+1)
+	points = append(points, from)
+	for _, c := range cells[1:] {
+		points = append(points, g.PositionOf(c))
+	}
+
+	// The last cell is only near the goal, so finish on the goal itself if it can be got to from
+	// there.  The first point is where we are now, which doesn't need to be walked to.
+	if goal == g.CellOf(to) && g.LineOfSight(points[len(points)-1], to) {
+		points = append(points, to)
+	}
+	return Smooth(g, points)[1:], true
+}
+
+// Drop every waypoint which can be skipped by going straight from the one before it to the one
+// after it, so the path doesn't stick to the grid's eight directions.  The first and last points
+// are always kept.
+func Smooth(g *Grid, points []shared.FloatVector) []shared.FloatVector {
+	if len(points) < 3 {
+		return points
+	}
+
+	smoothed := []shared.FloatVector{points[0]}
+	for i := 1; i < len(points)-1; i++ {
+		if !g.LineOfSight(smoothed[len(smoothed)-1], points[i+1]) {
+			smoothed = append(smoothed, points[i])
+		}
+	}
+	return append(smoothed, points[len(points)-1])
+}
+
+// A* from one walkable cell to another.  Gives back every cell along the way, including both ends.
+func search(g *Grid, start, goal Cell) ([]Cell, bool) {
+	cols, _ := g.Size()
+	index := func(c Cell) int { return c.Y*cols + c.X }
+
+	cost := map[int]float64{index(start): 0}
+	cameFrom := make(map[int]Cell)
+	closed := make(map[int]bool)
+
+	open := &openSet{{cell: start, estimate: octile(start, goal)}}
+	for open.Len() > 0 {
+		current := heap.Pop(open).(*openNode).cell
+		if current == goal {
+			return walkBack(cameFrom, index, start, goal), true
+		}
+		if closed[index(current)] {
+			continue
+		}
+		closed[index(current)] = true
+
+		for _, offset := range neighbours {
+			next := Cell{current.X + offset.X, current.Y + offset.Y}
+			if !g.Walkable(next) || closed[index(next)] {
+				continue
+			}
+
+			// No cutting corners - going diagonally past an obstacle would clip it
+			step := STRAIGHT_COST
+			if offset.X != 0 && offset.Y != 0 {
+				if !g.Walkable(Cell{current.X + offset.X, current.Y}) || !g.Walkable(Cell{current.X, current.Y + offset.Y}) {
+					continue
+				}
+				step = DIAGONAL_COST
+			}
+
+			nextCost := cost[index(current)] + step
+			if known, ok := cost[index(next)]; ok && known <= nextCost {
+				continue
+			}
+			cost[index(next)] = nextCost
+			cameFrom[index(next)] = current
+			heap.Push(open, &openNode{cell: next, estimate: nextCost + octile(next, goal)})
+		}
+	}
+
+	return nil, false
+}
+
+// Follow the trail A* left from the goal back to the start, and turn it round
+func walkBack(cameFrom map[int]Cell, index func(Cell) int, start, goal Cell) []Cell {
+	cells := []Cell{goal}
+	for c := goal; c != start; {
+		c = cameFrom[index(c)]
+		cells = append(cells, c)
+	}
+
+	for i, j := 0, len(cells)-1; i < j; i, j = i+1, j-1 {
+		cells[i], cells[j] = cells[j], cells[i]
+	}
+	return cells
+}
+
+// The cheapest a path between two cells could possibly be, moving in eight directions
+func octile(a, b Cell) float64 {
+	dx := math.Abs(float64(a.X - b.X))
+	dy := math.Abs(float64(a.Y - b.Y))
+	return STRAIGHT_COST*math.Max(dx, dy) + (DIAGONAL_COST-STRAIGHT_COST)*math.Min(dx, dy)
+}
+
+// A cell waiting to be looked at, and the estimated cost of a path through it
+type openNode struct {
+	cell     Cell
+	estimate float64
+}
+
+// The cells A* has yet to look at, cheapest first.  Implements heap.Interface.  A cell can be in
+// here more than once if a cheaper way to it turns up, the extra copies are skipped once it's been
+// looked at.
+type openSet []*openNode
+
+func (os openSet) Len() int           { return len(os) }
+func (os openSet) Less(i, j int) bool { return os[i].estimate < os[j].estimate }
+func (os openSet) Swap(i, j int)      { os[i], os[j] = os[j], os[i] }
+func (os *openSet) Push(x any)        { *os = append(*os, x.(*openNode)) }
+
+func (os *openSet) Pop() any {
+	old := *os
+	node := old[len(old)-1]
+	*os = old[:len(old)-1]
+	return node
+}
@@ -0,0 +1,230 @@
+package pathfinding
+
+import (
+	"testing"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Cell size used by the test grids, in pixels
+const testCellSize float32 = 10
+
+// Build a grid from a picture of it, one string per row, with # for cells an entity can't be in
+func gridFromRows(rows ...string) *Grid {
+	maxX := float32(len(rows[0])-1) * testCellSize
+	maxY := float32(len(rows)-1) * testCellSize
+	return CreateGrid(maxX, maxY, testCellSize, func(pos shared.FloatVector) bool {
+		return rows[int(pos.Y/testCellSize)][int(pos.X/testCellSize)] == '#'
+	})
+}
+
+// The position of a cell in a test grid
+func at(x, y int) shared.FloatVector {
+	return shared.FloatVector{X: float32(x) * testCellSize, Y: float32(y) * testCellSize}
+}
+
+// Fail unless the path ends on the goal and every leg of it, starting from the start, is clear
+func checkPath(t *testing.T, g *Grid, from, to shared.FloatVector, path []shared.FloatVector) {
+	t.Helper()
+
+	if len(path) == 0 {
+		t.Fatalf("empty path from %v to %v", from, to)
+	}
+	if last := path[len(path)-1]; last != to {
+		t.Errorf("path ends at %v, wanted %v", last, to)
+	}
+
+	prev := from
+	for i, point := range path {
+		if !g.LineOfSight(prev, point) {
+			t.Errorf("leg %v of the path, %v to %v, goes through an obstacle", i, prev, point)
+		}
+		prev = point
+	}
+}
+
+func TestFindPathAroundObstacle(t *testing.T) {
+	tests := []struct {
+		name     string
+		rows     []string
+		from, to shared.FloatVector
+	}{
+		{
+			name: "wall with a gap",
+			rows: []string{
+				"..........",
+				"..........",
+				"....#.....",
+				"....#.....",
+				"....#.....",
+				"....#.....",
+				"..........",
+			},
+			from: at(1, 3),
+			to:   at(8, 3),
+		},
+		{
+			name: "u shaped trap",
+			rows: []string{
+				"..........",
+				"..#####...",
+				"......#...",
+				"......#...",
+				"..#####...",
+				"..........",
+			},
+			from: at(4, 2),
+			to:   at(9, 2),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := gridFromRows(test.rows...)
+			if g.LineOfSight(test.from, test.to) {
+				t.Fatalf("test is broken, there's nothing in the way")
+			}
+
+			path, ok := FindPath(g, test.from, test.to)
+			if !ok {
+				t.Fatalf("no path found")
+			}
+			checkPath(t, g, test.from, test.to, path)
+		})
+	}
+}
+
+func TestFindPathStraightLine(t *testing.T) {
+	g := gridFromRows(
+		"......",
+		"......",
+		"......",
+	)
+
+	path, ok := FindPath(g, at(0, 1), at(5, 1))
+	if !ok {
+		t.Fatalf("no path found")
+	}
+	if len(path) != 1 || path[0] != at(5, 1) {
+		t.Errorf("got %v, wanted straight to the goal", path)
+	}
+}
+
+func TestFindPathUnreachable(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []string
+	}{
+		{
+			name: "walled off",
+			rows: []string{
+				"......",
+				"...###",
+				"...#..",
+				"...###",
+			},
+		},
+		{
+			name: "nothing walkable",
+			rows: []string{
+				"######",
+				"######",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := gridFromRows(test.rows...)
+			if path, ok := FindPath(g, at(0, 0), at(5, 2)); ok {
+				t.Errorf("found a path %v to somewhere unreachable", path)
+			}
+		})
+	}
+}
+
+func TestSmooth(t *testing.T) {
+	g := gridFromRows(
+		"......",
+		"......",
+		"..#...",
+		"......",
+	)
+
+	tests := []struct {
+		name   string
+		points []shared.FloatVector
+		want   []shared.FloatVector
+	}{
+		{
+			name:   "too short to smooth",
+			points: []shared.FloatVector{at(0, 0), at(1, 1)},
+			want:   []shared.FloatVector{at(0, 0), at(1, 1)},
+		},
+		{
+			name:   "staircase in the open",
+			points: []shared.FloatVector{at(0, 0), at(1, 0), at(1, 1), at(2, 1), at(3, 1), at(4, 1)},
+			want:   []shared.FloatVector{at(0, 0), at(4, 1)},
+		},
+		{
+			name:   "corner round an obstacle",
+			points: []shared.FloatVector{at(0, 2), at(0, 3), at(1, 3), at(2, 3), at(3, 3), at(3, 2)},
+			want:   []shared.FloatVector{at(0, 2), at(1, 3), at(3, 3), at(3, 2)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Smooth(g, test.points)
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, wanted %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("got %v, wanted %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPathCacheInvalidation(t *testing.T) {
+	open := gridFromRows(
+		"......",
+		"......",
+		"......",
+	)
+	walled := gridFromRows(
+		"......",
+		"...#..",
+		"...#..",
+	)
+	from, to := at(0, 2), at(5, 2)
+
+	cache := CreatePathCache()
+	first, ok := cache.FindPath(open, from, to)
+	if !ok || cache.Len() != 1 {
+		t.Fatalf("path not found and cached, ok=%v len=%v", ok, cache.Len())
+	}
+	if again, _ := cache.FindPath(open, from, to); len(again) != len(first) {
+		t.Errorf("second lookup gave %v, the first gave %v", again, first)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("second lookup of the same path left %v paths in the cache", cache.Len())
+	}
+
+	// The map changed - the straight path from the open grid would go through the wall
+	path, ok := cache.FindPath(walled, from, to)
+	if !ok {
+		t.Fatalf("no path found on the new grid")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("cache kept %v paths across a change of grid, wanted only the new one", cache.Len())
+	}
+	checkPath(t, walled, walled.PositionOf(walled.CellOf(from)), to, path)
+
+	cache.Invalidate()
+	if cache.Len() != 0 {
+		t.Errorf("cache has %v paths after being invalidated", cache.Len())
+	}
+}
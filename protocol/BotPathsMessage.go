@@ -0,0 +1,77 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Sent by a room every half second, only when the server runs with -debug-paths, with the paths
+// its bots are following and the obstacles on its map.  Only the debug overlay in the client uses
+// it.
+type BotPathsMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Paths       []BotPath
+	Obstacles   []shared.FloatRect
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *BotPathsMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *BotPathsMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *BotPathsMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *BotPathsMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *BotPathsMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for BotPathsMessage, returns pointer to one
+func CreateBotPathsMessage(paths []BotPath, obstacles []shared.FloatRect) *BotPathsMessage {
+	return &BotPathsMessage{
+		SentTime:    time.Now(),
+		MessageType: BOT_PATHS_MESSAGE,
+		Paths:       paths,
+		Obstacles:   obstacles,
+	}
+}
+
+// Decode a BotPathsMessage from raw bytes of JSON data and return a pointer to it
+func DecodeBotPathsMessage(raw []byte) *BotPathsMessage {
+	msg := new(BotPathsMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
+
+// The rest of the path one bot is following, from the next waypoint to the end.  The points are
+// positions like an entity's.
+type BotPath struct {
+	Id     int64
+	Points []shared.FloatVector
+}
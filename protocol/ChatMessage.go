@@ -0,0 +1,110 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// A line of chat sent out by the server.  From and FromId are who said it, and Target is who it
+// was whispered to.  System lines come from the server itself, telling the client why something it
+// said didn't go through, and have no sender.
+type ChatMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Scope       ChatScope
+	FromId      int64
+	From        string
+	Target      string
+	Text        string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *ChatMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *ChatMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *ChatMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *ChatMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *ChatMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for ChatMessage, returns pointer to one
+func CreateChatMessage(scope ChatScope, fromId int64, from, target, text string) *ChatMessage {
+	return &ChatMessage{
+		SentTime:    time.Now(),
+		MessageType: CHAT_MESSAGE,
+		Scope:       scope,
+		FromId:      fromId,
+		From:        from,
+		Target:      target,
+		Text:        text,
+	}
+}
+
+// Decode a ChatMessage from raw bytes of JSON data and return a pointer to it
+func DecodeChatMessage(raw []byte) *ChatMessage {
+	msg := new(ChatMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
+
+// Who a line of chat goes to
+type ChatScope int
+
+const (
+	// Everyone on the server, spectators included
+	CHAT_SCOPE_GLOBAL ChatScope = iota + 1
+
+	// Only the players on the sender's team
+	CHAT_SCOPE_TEAM
+
+	// A single player, picked by username
+	CHAT_SCOPE_WHISPER
+
+	// Notices from the server to one client.  Clients can't send these.
+	CHAT_SCOPE_SYSTEM
+)
+
+// Readable names for the chat scopes, for logs
+var chatScopeNames = map[ChatScope]string{
+	CHAT_SCOPE_GLOBAL:  "global",
+	CHAT_SCOPE_TEAM:    "team",
+	CHAT_SCOPE_WHISPER: "whisper",
+	CHAT_SCOPE_SYSTEM:  "system",
+}
+
+// Get the readable name of a chat scope
+func (s ChatScope) String() string {
+	name, ok := chatScopeNames[s]
+	if !ok {
+		return fmt.Sprintf("unknown_%d", int(s))
+	}
+
+	return name
+}
@@ -0,0 +1,66 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent by a player who wants to switch teams.  The server can refuse, for instance when the switch
+// would leave the teams unbalanced, in which case it says why with a system line of chat.  A
+// switch which goes through shows up in the next world state.
+type ChooseTeamMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Team        string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *ChooseTeamMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *ChooseTeamMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *ChooseTeamMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *ChooseTeamMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *ChooseTeamMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for ChooseTeamMessage, returns pointer to one
+func CreateChooseTeamMessage(team string) *ChooseTeamMessage {
+	return &ChooseTeamMessage{
+		SentTime:    time.Now(),
+		MessageType: CHOOSE_TEAM_MESSAGE,
+		Team:        team,
+	}
+}
+
+// Decode a ChooseTeamMessage from raw bytes of JSON data and return a pointer to it
+func DecodeChooseTeamMessage(raw []byte) *ChooseTeamMessage {
+	msg := new(ChooseTeamMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
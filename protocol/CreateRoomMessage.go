@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent by a client to open a new room with the given name and settings and move into it.  The
+// server answers with a RoomChangedMessage, which carries a reason if the room couldn't be created
+// (the name is taken, there are too many rooms...).
+type CreateRoomMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Room        string
+	Settings    RoomSettings
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *CreateRoomMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *CreateRoomMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *CreateRoomMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *CreateRoomMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *CreateRoomMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for CreateRoomMessage, returns pointer to one
+func CreateCreateRoomMessage(room string, settings RoomSettings) *CreateRoomMessage {
+	return &CreateRoomMessage{
+		SentTime:    time.Now(),
+		MessageType: CREATE_ROOM_MESSAGE,
+		Room:        room,
+		Settings:    settings,
+	}
+}
+
+// Decode a CreateRoomMessage from raw bytes of JSON data and return a pointer to it
+func DecodeCreateRoomMessage(raw []byte) *CreateRoomMessage {
+	msg := new(CreateRoomMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
+
+// How a room is set up.  Zero values mean the server picks.
+type RoomSettings struct {
+	// Most players allowed in the room at once, 0 for no limit.  Spectators don't count.
+	MaxPlayers int
+
+	// How long each tick of the room's loop is, in milliseconds
+	TickMillis int
+
+	// How fast players move, in pixels per second
+	Speed float32
+
+	// How the room splits players into teams, for instance "ffa" for no teams or "teams" for red
+	// against blue.  Empty for the server's default.
+	Mode string `json:",omitempty"`
+}
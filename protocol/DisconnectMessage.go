@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent to a connected client right before the server throws it out (kicked, banned...).  Unlike a
+// dropped connection, the client shouldn't try to reconnect after getting one of these.
+type DisconnectMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Reason      string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *DisconnectMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *DisconnectMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *DisconnectMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *DisconnectMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *DisconnectMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for DisconnectMessage, returns pointer to one
+func CreateDisconnectMessage(reason string) *DisconnectMessage {
+	return &DisconnectMessage{
+		SentTime:    time.Now(),
+		MessageType: DISCONNECT_MESSAGE,
+		Reason:      reason,
+	}
+}
+
+// Decode a DisconnectMessage from raw bytes of JSON data and return a pointer to it
+func DecodeDisconnectMessage(raw []byte) *DisconnectMessage {
+	msg := new(DisconnectMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
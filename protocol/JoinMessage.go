@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The first message a client sends after opening a connection.  It carries the username and
+// credential (password, shared secret or signed token, depending on how the server is set up to
+// authenticate players).  If the client has been connected before and still has the session token
+// the server gave it, it sends it along so it can get its old player entity back instead of being
+// given a brand new one.  Spectators don't get an entity at all, they just watch.
+type JoinMessage struct {
+	MessageType  MessageType
+	SentTime     time.Time
+	RcvdTime     time.Time
+	Username     string
+	Credential   string
+	SessionToken string
+	Spectator    bool
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *JoinMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *JoinMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *JoinMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *JoinMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *JoinMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for JoinMessage, returns pointer to one.  Pass an empty token for a fresh join.
+func CreateJoinMessage(username, credential, sessionToken string, spectator bool) *JoinMessage {
+	return &JoinMessage{
+		SentTime:     time.Now(),
+		MessageType:  JOIN_MESSAGE,
+		Username:     username,
+		Credential:   credential,
+		SessionToken: sessionToken,
+		Spectator:    spectator,
+	}
+}
+
+// Decode a JoinMessage from raw bytes of JSON data and return a pointer to it
+func DecodeJoinMessage(raw []byte) *JoinMessage {
+	msg := new(JoinMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
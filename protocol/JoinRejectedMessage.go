@@ -0,0 +1,66 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent to a client instead of a PlayerUUIDMessage when the server refuses to let it join.  The
+// server closes the connection right after sending it, so the reason is the only thing the client
+// gets to know about what went wrong.
+type JoinRejectedMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Reason      string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *JoinRejectedMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *JoinRejectedMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *JoinRejectedMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *JoinRejectedMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *JoinRejectedMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for JoinRejectedMessage, returns pointer to one
+func CreateJoinRejectedMessage(reason string) *JoinRejectedMessage {
+	return &JoinRejectedMessage{
+		SentTime:    time.Now(),
+		MessageType: JOIN_REJECTED_MESSAGE,
+		Reason:      reason,
+	}
+}
+
+// Decode a JoinRejectedMessage from raw bytes of JSON data and return a pointer to it
+func DecodeJoinRejectedMessage(raw []byte) *JoinRejectedMessage {
+	msg := new(JoinRejectedMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
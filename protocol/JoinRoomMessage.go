@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent by a client to move into a room which already exists.  The server answers with a
+// RoomChangedMessage.
+type JoinRoomMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Room        string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *JoinRoomMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *JoinRoomMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *JoinRoomMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *JoinRoomMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *JoinRoomMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for JoinRoomMessage, returns pointer to one
+func CreateJoinRoomMessage(room string) *JoinRoomMessage {
+	return &JoinRoomMessage{
+		SentTime:    time.Now(),
+		MessageType: JOIN_ROOM_MESSAGE,
+		Room:        room,
+	}
+}
+
+// Decode a JoinRoomMessage from raw bytes of JSON data and return a pointer to it
+func DecodeJoinRoomMessage(raw []byte) *JoinRoomMessage {
+	msg := new(JoinRoomMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent by a client to stop waiting for a match.
+type LeaveQueueMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *LeaveQueueMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *LeaveQueueMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *LeaveQueueMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *LeaveQueueMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *LeaveQueueMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for LeaveQueueMessage, returns pointer to one
+func CreateLeaveQueueMessage() *LeaveQueueMessage {
+	return &LeaveQueueMessage{
+		SentTime:    time.Now(),
+		MessageType: LEAVE_QUEUE_MESSAGE,
+	}
+}
+
+// Decode a LeaveQueueMessage from raw bytes of JSON data and return a pointer to it
+func DecodeLeaveQueueMessage(raw []byte) *LeaveQueueMessage {
+	msg := new(LeaveQueueMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent by a client to leave its room without going into another one.  The player's entity is taken
+// out of the world until they join a room again.  The server answers with a RoomChangedMessage.
+type LeaveRoomMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *LeaveRoomMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *LeaveRoomMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *LeaveRoomMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *LeaveRoomMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *LeaveRoomMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for LeaveRoomMessage, returns pointer to one
+func CreateLeaveRoomMessage() *LeaveRoomMessage {
+	return &LeaveRoomMessage{
+		SentTime:    time.Now(),
+		MessageType: LEAVE_ROOM_MESSAGE,
+	}
+}
+
+// Decode a LeaveRoomMessage from raw bytes of JSON data and return a pointer to it
+func DecodeLeaveRoomMessage(raw []byte) *LeaveRoomMessage {
+	msg := new(LeaveRoomMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
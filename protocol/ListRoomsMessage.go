@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent by a client to ask which rooms the server has.  The server answers with a RoomListMessage.
+type ListRoomsMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *ListRoomsMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *ListRoomsMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *ListRoomsMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *ListRoomsMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *ListRoomsMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for ListRoomsMessage, returns pointer to one
+func CreateListRoomsMessage() *ListRoomsMessage {
+	return &ListRoomsMessage{
+		SentTime:    time.Now(),
+		MessageType: LIST_ROOMS_MESSAGE,
+	}
+}
+
+// Decode a ListRoomsMessage from raw bytes of JSON data and return a pointer to it
+func DecodeListRoomsMessage(raw []byte) *ListRoomsMessage {
+	msg := new(ListRoomsMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
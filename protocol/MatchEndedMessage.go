@@ -0,0 +1,66 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent to the players of a match when it's over, right before they're moved back to the lobby
+type MatchEndedMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	MatchId     int64
+	Reason      string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *MatchEndedMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *MatchEndedMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *MatchEndedMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *MatchEndedMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *MatchEndedMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for MatchEndedMessage, returns pointer to one
+func CreateMatchEndedMessage(matchId int64, reason string) *MatchEndedMessage {
+	return &MatchEndedMessage{
+		SentTime:    time.Now(),
+		MessageType: MATCH_ENDED_MESSAGE,
+		MatchId:     matchId,
+		Reason:      reason,
+	}
+}
+
+// Decode a MatchEndedMessage from raw bytes of JSON data and return a pointer to it
+func DecodeMatchEndedMessage(raw []byte) *MatchEndedMessage {
+	msg := new(MatchEndedMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
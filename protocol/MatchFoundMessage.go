@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent to every player in a group the matchmaker has just put together.  The match starts, and
+// they're moved into its room, when the MatchReadyMessage follows.
+type MatchFoundMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	MatchId     int64
+	Players     []string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *MatchFoundMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *MatchFoundMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *MatchFoundMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *MatchFoundMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *MatchFoundMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for MatchFoundMessage, returns pointer to one
+func CreateMatchFoundMessage(matchId int64, players []string) *MatchFoundMessage {
+	return &MatchFoundMessage{
+		SentTime:    time.Now(),
+		MessageType: MATCH_FOUND_MESSAGE,
+		MatchId:     matchId,
+		Players:     players,
+	}
+}
+
+// Decode a MatchFoundMessage from raw bytes of JSON data and return a pointer to it
+func DecodeMatchFoundMessage(raw []byte) *MatchFoundMessage {
+	msg := new(MatchFoundMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
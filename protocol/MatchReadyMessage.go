@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent once a match's room is open and its players have been moved in.  A RoomChangedMessage for
+// the same room goes along with it.
+type MatchReadyMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	MatchId     int64
+	Room        string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *MatchReadyMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *MatchReadyMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *MatchReadyMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *MatchReadyMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *MatchReadyMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for MatchReadyMessage, returns pointer to one
+func CreateMatchReadyMessage(matchId int64, room string) *MatchReadyMessage {
+	return &MatchReadyMessage{
+		SentTime:    time.Now(),
+		MessageType: MATCH_READY_MESSAGE,
+		MatchId:     matchId,
+		Room:        room,
+	}
+}
+
+// Decode a MatchReadyMessage from raw bytes of JSON data and return a pointer to it
+func DecodeMatchReadyMessage(raw []byte) *MatchReadyMessage {
+	msg := new(MatchReadyMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent by the server to each client every so often.  The client answers straight away with a
+// PongMessage carrying the ping's SentTime, which lets the server work out the round trip time.
+type PingMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *PingMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *PingMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *PingMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *PingMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *PingMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for PingMessage, returns pointer to one
+func CreatePingMessage() *PingMessage {
+	return &PingMessage{
+		SentTime:    time.Now(),
+		MessageType: PING_MESSAGE,
+	}
+}
+
+// Decode a PingMessage from raw bytes of JSON data and return a pointer to it
+func DecodePingMessage(raw []byte) *PingMessage {
+	msg := new(PingMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
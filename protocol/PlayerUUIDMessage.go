@@ -6,12 +6,14 @@ import (
 )
 
 // A message sent to a client upon their initial connection in order to let them know
-// what their unique ID is.
+// what their unique ID is.  It also carries the session token the client should present in its
+// JoinMessage if it needs to reconnect and take back the same player.
 type PlayerUUIDMessage struct {
-	MessageType MessageType
-	SentTime    time.Time
-	RcvdTime    time.Time
-	UUID        int64
+	MessageType  MessageType
+	SentTime     time.Time
+	RcvdTime     time.Time
+	UUID         int64
+	SessionToken string
 }
 
 // Encode the message to JSON format and get the raw bytes
@@ -45,11 +47,12 @@ func (m *PlayerUUIDMessage) GetMessageType() MessageType {
 }
 
 // Constructor for PlayerUUIDMessage, returns pointer to one
-func CreatePlayerUUIDMessage(uuid int64) *PlayerUUIDMessage {
+func CreatePlayerUUIDMessage(uuid int64, sessionToken string) *PlayerUUIDMessage {
 	return &PlayerUUIDMessage{
-		SentTime:    time.Now(),
-		MessageType: PLAYER_UUID_MESSAGE,
-		UUID:        uuid,
+		SentTime:     time.Now(),
+		MessageType:  PLAYER_UUID_MESSAGE,
+		UUID:         uuid,
+		SessionToken: sessionToken,
 	}
 }
 
@@ -0,0 +1,65 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// A client's answer to a PingMessage.  PingSentTime is copied from the ping untouched, so the
+// server only ever compares it against its own clock.
+type PongMessage struct {
+	MessageType  MessageType
+	SentTime     time.Time
+	RcvdTime     time.Time
+	PingSentTime time.Time
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *PongMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *PongMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *PongMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *PongMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *PongMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for PongMessage, returns pointer to one
+func CreatePongMessage(pingSentTime time.Time) *PongMessage {
+	return &PongMessage{
+		SentTime:     time.Now(),
+		MessageType:  PONG_MESSAGE,
+		PingSentTime: pingSentTime,
+	}
+}
+
+// Decode a PongMessage from raw bytes of JSON data and return a pointer to it
+func DecodePongMessage(raw []byte) *PongMessage {
+	msg := new(PongMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
@@ -0,0 +1,63 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent by a client to wait in the lobby for a match.  The server sends a MatchFoundMessage once it
+// has put a group together, or a QueueRejectedMessage straight away if it won't queue the player.
+type QueueMatchMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *QueueMatchMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *QueueMatchMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *QueueMatchMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *QueueMatchMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *QueueMatchMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for QueueMatchMessage, returns pointer to one
+func CreateQueueMatchMessage() *QueueMatchMessage {
+	return &QueueMatchMessage{
+		SentTime:    time.Now(),
+		MessageType: QUEUE_MATCH_MESSAGE,
+	}
+}
+
+// Decode a QueueMatchMessage from raw bytes of JSON data and return a pointer to it
+func DecodeQueueMatchMessage(raw []byte) *QueueMatchMessage {
+	msg := new(QueueMatchMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
@@ -0,0 +1,66 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent in answer to a QueueMatchMessage when the server won't put the player in the matchmaking
+// queue (they're spectating, already queued or already in a match), with the reason why.  Nothing
+// else changes for the player.
+type QueueRejectedMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Reason      string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *QueueRejectedMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *QueueRejectedMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *QueueRejectedMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *QueueRejectedMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *QueueRejectedMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for QueueRejectedMessage, returns pointer to one
+func CreateQueueRejectedMessage(reason string) *QueueRejectedMessage {
+	return &QueueRejectedMessage{
+		SentTime:    time.Now(),
+		MessageType: QUEUE_REJECTED_MESSAGE,
+		Reason:      reason,
+	}
+}
+
+// Decode a QueueRejectedMessage from raw bytes of JSON data and return a pointer to it
+func DecodeQueueRejectedMessage(raw []byte) *QueueRejectedMessage {
+	msg := new(QueueRejectedMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
@@ -0,0 +1,68 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent to a player waiting to join a full server, when they first go into the join queue and again
+// every time their place in it changes.  Position counts from 1 for the front of the queue.  Once
+// a slot frees up for them they get a PlayerUUIDMessage as usual.
+type QueueStatusMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Position    int
+	Length      int
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *QueueStatusMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *QueueStatusMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *QueueStatusMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *QueueStatusMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *QueueStatusMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for QueueStatusMessage, returns pointer to one
+func CreateQueueStatusMessage(position, length int) *QueueStatusMessage {
+	return &QueueStatusMessage{
+		SentTime:    time.Now(),
+		MessageType: QUEUE_STATUS_MESSAGE,
+		Position:    position,
+		Length:      length,
+	}
+}
+
+// Decode a QueueStatusMessage from raw bytes of JSON data and return a pointer to it
+func DecodeQueueStatusMessage(raw []byte) *QueueStatusMessage {
+	msg := new(QueueStatusMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
@@ -0,0 +1,77 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Tells a client which room it's in, after it joined, created or left one, or after a reconnect
+// put it back in its old room.  An empty room means it's not in any.  If the client asked for a
+// change which couldn't be made, the reason is set and the room is the one the client is still in.
+//
+// The room's settings come along, since the client has to move at the room's speed for its
+// prediction to match the server.  It's sent again with the same room whenever they change.  So do
+// the teams players can pick from in the room, which is empty if it has no teams.
+type RoomChangedMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Room        string
+	Reason      string
+	Settings    RoomSettings
+	Teams       []string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *RoomChangedMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *RoomChangedMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *RoomChangedMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *RoomChangedMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *RoomChangedMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for RoomChangedMessage, returns pointer to one.  Pass an empty reason if the change
+// worked.
+func CreateRoomChangedMessage(room, reason string, settings RoomSettings, teams []string) *RoomChangedMessage {
+	return &RoomChangedMessage{
+		SentTime:    time.Now(),
+		MessageType: ROOM_CHANGED_MESSAGE,
+		Room:        room,
+		Reason:      reason,
+		Settings:    settings,
+		Teams:       teams,
+	}
+}
+
+// Decode a RoomChangedMessage from raw bytes of JSON data and return a pointer to it
+func DecodeRoomChangedMessage(raw []byte) *RoomChangedMessage {
+	msg := new(RoomChangedMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
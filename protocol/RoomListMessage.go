@@ -0,0 +1,80 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The server's answer to a ListRoomsMessage, describing every room which is currently open.
+type RoomListMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Rooms       []RoomInfo
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *RoomListMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *RoomListMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *RoomListMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *RoomListMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *RoomListMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for RoomListMessage, returns pointer to one
+func CreateRoomListMessage(rooms []RoomInfo) *RoomListMessage {
+	return &RoomListMessage{
+		SentTime:    time.Now(),
+		MessageType: ROOM_LIST_MESSAGE,
+		Rooms:       rooms,
+	}
+}
+
+// Decode a RoomListMessage from raw bytes of JSON data and return a pointer to it
+func DecodeRoomListMessage(raw []byte) *RoomListMessage {
+	msg := new(RoomListMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
+
+// What a client gets to know about a room when it lists them
+type RoomInfo struct {
+	Name     string
+	Players  int
+	Settings RoomSettings
+}
+
+// Create a new RoomInfo
+func CreateRoomInfo(name string, players int, settings RoomSettings) RoomInfo {
+	return RoomInfo{
+		Name:     name,
+		Players:  players,
+		Settings: settings,
+	}
+}
@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Sent by a room to its members whenever its round moves on to another state, and every so often
+// in between so that newcomers find out and everyone's countdown stays right.  Remaining is how
+// long the state has left, zero if it lasts until something happens rather than for a set time.
+// Winner is only filled in for the post round state, and is empty if nobody won.  Status is
+// whatever the game mode wants players to know, like who is "it" in tag.
+type RoundStateMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Mode        string
+	Round       int
+	State       RoundState
+	Remaining   shared.MDuration
+	Winner      string
+	Status      string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *RoundStateMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *RoundStateMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *RoundStateMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *RoundStateMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *RoundStateMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for RoundStateMessage, returns pointer to one
+func CreateRoundStateMessage(mode string, round int, state RoundState, remaining shared.MDuration, winner, status string) *RoundStateMessage {
+	return &RoundStateMessage{
+		SentTime:    time.Now(),
+		MessageType: ROUND_STATE_MESSAGE,
+		Mode:        mode,
+		Round:       round,
+		State:       state,
+		Remaining:   remaining,
+		Winner:      winner,
+		Status:      status,
+	}
+}
+
+// Decode a RoundStateMessage from raw bytes of JSON data and return a pointer to it
+func DecodeRoundStateMessage(raw []byte) *RoundStateMessage {
+	msg := new(RoundStateMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
+
+// Where a room is in its round
+type RoundState int
+
+const (
+	// Waiting for enough players, then counting down to the start of the round
+	ROUND_STATE_WARMUP RoundState = iota + 1
+
+	// The round is being played
+	ROUND_STATE_IN_PROGRESS
+
+	// The round is over and the result is being shown
+	ROUND_STATE_POST_ROUND
+
+	// Moving on to the next map, with everyone put back at a spawn
+	ROUND_STATE_MAP_CHANGE
+)
+
+// Readable names for the round states, for logs and for players
+var roundStateNames = map[RoundState]string{
+	ROUND_STATE_WARMUP:      "warmup",
+	ROUND_STATE_IN_PROGRESS: "in progress",
+	ROUND_STATE_POST_ROUND:  "post round",
+	ROUND_STATE_MAP_CHANGE:  "map change",
+}
+
+// Get the readable name of a round state
+func (s RoundState) String() string {
+	name, ok := roundStateNames[s]
+	if !ok {
+		return fmt.Sprintf("unknown_%d", int(s))
+	}
+
+	return name
+}
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Sent by a room to its members every couple of seconds with everyone's stats, best score first.
+// Only the players in the room right now are listed.
+type ScoreboardMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Entries     []ScoreEntry
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *ScoreboardMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *ScoreboardMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *ScoreboardMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *ScoreboardMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *ScoreboardMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for ScoreboardMessage, returns pointer to one
+func CreateScoreboardMessage(entries []ScoreEntry) *ScoreboardMessage {
+	return &ScoreboardMessage{
+		SentTime:    time.Now(),
+		MessageType: SCOREBOARD_MESSAGE,
+		Entries:     entries,
+	}
+}
+
+// Decode a ScoreboardMessage from raw bytes of JSON data and return a pointer to it
+func DecodeScoreboardMessage(raw []byte) *ScoreboardMessage {
+	msg := new(ScoreboardMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
+
+// One player's line on the scoreboard
+type ScoreEntry struct {
+	Id       int64
+	Username string
+	Team     string `json:",omitempty"`
+	Score    int
+	Kills    int
+	Deaths   int
+
+	// How far the player has moved, in pixels.  Being teleported or respawned doesn't count.
+	Distance float32
+
+	// How long the player has been in the room, and their average round trip time while there
+	Connected shared.MDuration
+	RTT       shared.MDuration
+}
@@ -0,0 +1,69 @@
+package protocol
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Sent by a client to say something in the chat.  For whispers, Target is the username of the
+// player it's meant for.
+type SendChatMessage struct {
+	MessageType MessageType
+	SentTime    time.Time
+	RcvdTime    time.Time
+	Scope       ChatScope
+	Target      string
+	Text        string
+}
+
+// Encode the message to JSON format and get the raw bytes
+func (m *SendChatMessage) Encode() []byte {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return AddNewlineToByteSlice(bytes)
+}
+
+// Message interface
+func (m *SendChatMessage) GetSentTime() time.Time {
+	return m.SentTime
+}
+
+// Message interface
+func (m *SendChatMessage) GetRcvdTime() time.Time {
+	return m.RcvdTime
+}
+
+// Message interface
+func (m *SendChatMessage) SetRcvdTime(t time.Time) {
+	m.RcvdTime = t
+}
+
+// Message interface
+func (m *SendChatMessage) GetMessageType() MessageType {
+	return m.MessageType
+}
+
+// Constructor for SendChatMessage, returns pointer to one
+func CreateSendChatMessage(scope ChatScope, target, text string) *SendChatMessage {
+	return &SendChatMessage{
+		SentTime:    time.Now(),
+		MessageType: SEND_CHAT_MESSAGE,
+		Scope:       scope,
+		Target:      target,
+		Text:        text,
+	}
+}
+
+// Decode a SendChatMessage from raw bytes of JSON data and return a pointer to it
+func DecodeSendChatMessage(raw []byte) *SendChatMessage {
+	msg := new(SendChatMessage)
+	err := json.Unmarshal(raw, msg)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return msg
+}
@@ -9,12 +9,13 @@ import (
 
 // A WorldStateMessage is used to send a list of entities to each client after every server tick.
 // It is the structure used to convey to the clients what the state of the world according to the
-// server is.
+// server is.  The pickups lying around the world come along with the entities.
 type WorldStateMessage struct {
 	MessageType MessageType
 	SentTime    time.Time
 	RcvdTime    time.Time
 	Entities    []MessageEntity
+	Pickups     []MessagePickup `json:",omitempty"`
 }
 
 // Convert the message into JSON representation and return the raw bytes
@@ -48,11 +49,12 @@ func (m *WorldStateMessage) GetMessageType() MessageType {
 }
 
 // Constructor function to create a new WorldStateMessage and return a pointer to it
-func CreateWorldStateMessage(entities []MessageEntity) *WorldStateMessage {
+func CreateWorldStateMessage(entities []MessageEntity, pickups []MessagePickup) *WorldStateMessage {
 	return &WorldStateMessage{
 		SentTime:    time.Now(),
 		MessageType: WORLD_STATE_MESSAGE,
 		Entities:    entities,
+		Pickups:     pickups,
 	}
 }
 
@@ -71,13 +73,55 @@ func DecodeWorldStateMessage(raw []byte) *WorldStateMessage {
 // There should be one of these for each player currently in the server's world state.
 type MessageEntity struct {
 	Id       int64
+	Username string
 	Position shared.FloatVector
 	LastSeq  int64
+
+	// The team the entity is on, empty if it isn't on one
+	Team string `json:",omitempty"`
+
+	// How much health the entity has left, out of shared.MAX_HEALTH
+	Health int
+
+	// How the entity moves right now, speed boosts and all.  A client needs its own to predict
+	// where it's going.
+	Movement shared.MovementParams
+
+	// How fast the entity is going and in which direction, in pixels per second, as of LastSeq
+	// and anything the server did to it since, like knocking it back.  A client carries on its own
+	// prediction from here along with the position.
+	Velocity shared.FloatVector
 }
 
 // Create a new MessageEntity.  Don't bother making a pointer to it, it's a very small struct.  If
 // ever we need to send hundreds of these at once we might consider making it a pointer for memory
 // efficiency.
-func CreateMessageEntity(id int64, pos shared.FloatVector, seq int64) MessageEntity {
-	return MessageEntity{Id: id, Position: pos, LastSeq: seq}
+func CreateMessageEntity(id int64, username, team string, pos shared.FloatVector, seq int64) MessageEntity {
+	return MessageEntity{Id: id, Username: username, Team: team, Position: pos, LastSeq: seq}
+}
+
+// The kinds of pickup there are.  The names are what go in map files and admin commands.
+type PickupKind string
+
+const (
+	// Makes whoever picks it up move faster for a while
+	PICKUP_SPEED PickupKind = "speed"
+
+	// Gives back some health.  Nothing in the game costs any yet, so the server only puts these
+	// down when an admin asks it to.
+	PICKUP_HEALTH PickupKind = "health"
+
+	// Worth a point on the scoreboard
+	PICKUP_SCORE PickupKind = "score"
+)
+
+// Every kind of pickup, in a fixed order
+var PickupKinds = []PickupKind{PICKUP_SPEED, PICKUP_HEALTH, PICKUP_SCORE}
+
+// A pickup lying in the world as it is conveyed to the client.  Like an entity's, the position is
+// where the top left corner of its square is.
+type MessagePickup struct {
+	Id       int64
+	Kind     PickupKind
+	Position shared.FloatVector
 }
@@ -3,6 +3,7 @@ package protocol
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -10,11 +11,76 @@ const (
 	PLAYER_UUID_MESSAGE MessageType = iota + 1
 	SEND_INPUT_MESSAGE
 	WORLD_STATE_MESSAGE
+	JOIN_MESSAGE
+	JOIN_REJECTED_MESSAGE
+	DISCONNECT_MESSAGE
+	PING_MESSAGE
+	PONG_MESSAGE
+	LIST_ROOMS_MESSAGE
+	ROOM_LIST_MESSAGE
+	CREATE_ROOM_MESSAGE
+	JOIN_ROOM_MESSAGE
+	LEAVE_ROOM_MESSAGE
+	ROOM_CHANGED_MESSAGE
+	QUEUE_MATCH_MESSAGE
+	LEAVE_QUEUE_MESSAGE
+	MATCH_FOUND_MESSAGE
+	MATCH_READY_MESSAGE
+	MATCH_ENDED_MESSAGE
+	SEND_CHAT_MESSAGE
+	CHAT_MESSAGE
+	QUEUE_STATUS_MESSAGE
+	CHOOSE_TEAM_MESSAGE
+	ROUND_STATE_MESSAGE
+	SCOREBOARD_MESSAGE
+	BOT_PATHS_MESSAGE
+	QUEUE_REJECTED_MESSAGE
 )
 
 // Enum to keep track of message types
 type MessageType int
 
+// Readable names for the message types, for logs and metrics
+var messageTypeNames = map[MessageType]string{
+	PLAYER_UUID_MESSAGE:    "player_uuid",
+	SEND_INPUT_MESSAGE:     "send_input",
+	WORLD_STATE_MESSAGE:    "world_state",
+	JOIN_MESSAGE:           "join",
+	JOIN_REJECTED_MESSAGE:  "join_rejected",
+	DISCONNECT_MESSAGE:     "disconnect",
+	PING_MESSAGE:           "ping",
+	PONG_MESSAGE:           "pong",
+	LIST_ROOMS_MESSAGE:     "list_rooms",
+	ROOM_LIST_MESSAGE:      "room_list",
+	CREATE_ROOM_MESSAGE:    "create_room",
+	JOIN_ROOM_MESSAGE:      "join_room",
+	LEAVE_ROOM_MESSAGE:     "leave_room",
+	ROOM_CHANGED_MESSAGE:   "room_changed",
+	QUEUE_MATCH_MESSAGE:    "queue_match",
+	LEAVE_QUEUE_MESSAGE:    "leave_queue",
+	MATCH_FOUND_MESSAGE:    "match_found",
+	MATCH_READY_MESSAGE:    "match_ready",
+	MATCH_ENDED_MESSAGE:    "match_ended",
+	SEND_CHAT_MESSAGE:      "send_chat",
+	CHAT_MESSAGE:           "chat",
+	QUEUE_STATUS_MESSAGE:   "queue_status",
+	CHOOSE_TEAM_MESSAGE:    "choose_team",
+	ROUND_STATE_MESSAGE:    "round_state",
+	SCOREBOARD_MESSAGE:     "scoreboard",
+	BOT_PATHS_MESSAGE:      "bot_paths",
+	QUEUE_REJECTED_MESSAGE: "queue_rejected",
+}
+
+// Get the readable name of a message type
+func (t MessageType) String() string {
+	name, ok := messageTypeNames[t]
+	if !ok {
+		return fmt.Sprintf("unknown_%d", int(t))
+	}
+
+	return name
+}
+
 // Interface for generic network messages which can be serialized to JSON
 type Message interface {
 	GetSentTime() time.Time
@@ -26,7 +92,18 @@ type Message interface {
 
 // Figure out what a message is from its JSON representation and return the specific instance of
 // it.
-func DecodeMessage(raw []byte) (Message, error) {
+//
+// The specific decoders panic on bad JSON.  Whatever comes off the wire can be bad JSON, so the
+// panic is turned back into an error here rather than letting a broken message take down the
+// whole program.
+func DecodeMessage(raw []byte) (msg Message, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = nil
+			err = fmt.Errorf("Invalid message recieved (%v)", r)
+		}
+	}()
+
 	// First we're going to marshall the raw JSON into a blank interface.  This will let
 	// us get a peek at the message type field.
 	unknown := make(map[string]interface{})
@@ -54,6 +131,54 @@ func DecodeMessage(raw []byte) (Message, error) {
 		return DecodeSendInputMessage(raw), nil
 	case WORLD_STATE_MESSAGE:
 		return DecodeWorldStateMessage(raw), nil
+	case JOIN_MESSAGE:
+		return DecodeJoinMessage(raw), nil
+	case JOIN_REJECTED_MESSAGE:
+		return DecodeJoinRejectedMessage(raw), nil
+	case DISCONNECT_MESSAGE:
+		return DecodeDisconnectMessage(raw), nil
+	case PING_MESSAGE:
+		return DecodePingMessage(raw), nil
+	case PONG_MESSAGE:
+		return DecodePongMessage(raw), nil
+	case LIST_ROOMS_MESSAGE:
+		return DecodeListRoomsMessage(raw), nil
+	case ROOM_LIST_MESSAGE:
+		return DecodeRoomListMessage(raw), nil
+	case CREATE_ROOM_MESSAGE:
+		return DecodeCreateRoomMessage(raw), nil
+	case JOIN_ROOM_MESSAGE:
+		return DecodeJoinRoomMessage(raw), nil
+	case LEAVE_ROOM_MESSAGE:
+		return DecodeLeaveRoomMessage(raw), nil
+	case ROOM_CHANGED_MESSAGE:
+		return DecodeRoomChangedMessage(raw), nil
+	case QUEUE_MATCH_MESSAGE:
+		return DecodeQueueMatchMessage(raw), nil
+	case LEAVE_QUEUE_MESSAGE:
+		return DecodeLeaveQueueMessage(raw), nil
+	case MATCH_FOUND_MESSAGE:
+		return DecodeMatchFoundMessage(raw), nil
+	case MATCH_READY_MESSAGE:
+		return DecodeMatchReadyMessage(raw), nil
+	case MATCH_ENDED_MESSAGE:
+		return DecodeMatchEndedMessage(raw), nil
+	case SEND_CHAT_MESSAGE:
+		return DecodeSendChatMessage(raw), nil
+	case CHAT_MESSAGE:
+		return DecodeChatMessage(raw), nil
+	case QUEUE_STATUS_MESSAGE:
+		return DecodeQueueStatusMessage(raw), nil
+	case CHOOSE_TEAM_MESSAGE:
+		return DecodeChooseTeamMessage(raw), nil
+	case ROUND_STATE_MESSAGE:
+		return DecodeRoundStateMessage(raw), nil
+	case SCOREBOARD_MESSAGE:
+		return DecodeScoreboardMessage(raw), nil
+	case BOT_PATHS_MESSAGE:
+		return DecodeBotPathsMessage(raw), nil
+	case QUEUE_REJECTED_MESSAGE:
+		return DecodeQueueRejectedMessage(raw), nil
 	}
 
 	return nil, errors.New("The message type matched nothing")
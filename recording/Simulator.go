@@ -0,0 +1,192 @@
+package recording
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// An entity as the simulator sees it
+type SimEntity struct {
+	Id       int64
+	Username string
+	Team     string
+	Position shared.FloatVector
+	LastSeq  int64
+
+	// How the entity moves, and how fast it's going
+	Movement shared.MovementParams
+	Velocity shared.FloatVector
+
+	// Whether the entity is in the world right now.  Entities which left are remembered in case
+	// they come back.
+	Active bool
+}
+
+// Re-runs a recorded match without a server.  Feed it the events of a recording in order and it
+// moves the entities the same way the server did, checking its results against each keyframe.
+type Simulator struct {
+	entities map[int64]*SimEntity
+	tick     int64
+
+	// How fast the room's entities move, in pixels per second, for any entity the recording
+	// doesn't give the movement of
+	speed float32
+
+	// How many keyframes have been checked so far
+	Keyframes int
+}
+
+// Apply one event.  Returns an error describing the desync if the event is a keyframe which
+// doesn't match the simulation.
+func (s *Simulator) Apply(event *Event) error {
+	s.tick = event.Tick
+
+	switch event.Kind {
+	case EVENT_JOIN:
+		ent, ok := s.entities[event.PlayerId]
+		if !ok {
+			ent = &SimEntity{Id: event.PlayerId, Movement: shared.DefaultMovementParams()}
+			ent.Movement.MaxSpeed = s.speed
+			s.entities[event.PlayerId] = ent
+		}
+		ent.Username = event.Username
+		if event.Position != nil {
+			ent.Position = *event.Position
+		}
+		if event.Movement != nil {
+			ent.Movement = *event.Movement
+		}
+		if event.Velocity != nil {
+			ent.Velocity = *event.Velocity
+		}
+		ent.Active = true
+
+	case EVENT_LEAVE:
+		if ent, ok := s.entities[event.PlayerId]; ok {
+			ent.Active = false
+		}
+
+	case EVENT_INPUT:
+		ent, ok := s.entities[event.PlayerId]
+		if !ok {
+			return fmt.Errorf("tick %v: input for unknown player %v", event.Tick, event.PlayerId)
+		}
+		ent.Position = ent.Position.Plus(shared.GetMovement(event.Input, event.Dt, ent.Movement, &ent.Velocity))
+		if ent.LastSeq < event.Seq {
+			ent.LastSeq = event.Seq
+		}
+
+	case EVENT_TELEPORT:
+		ent, ok := s.entities[event.PlayerId]
+		if !ok || event.Position == nil {
+			return fmt.Errorf("tick %v: bad teleport for player %v", event.Tick, event.PlayerId)
+		}
+		ent.Position = *event.Position
+		ent.Velocity = shared.FloatVector{}
+
+	case EVENT_KEYFRAME:
+		s.Keyframes++
+		return s.checkKeyframe(event)
+
+	case EVENT_SETTINGS:
+		if event.Speed > 0 {
+			s.speed = event.Speed
+		}
+
+	case EVENT_TEAM:
+		ent, ok := s.entities[event.PlayerId]
+		if !ok {
+			return fmt.Errorf("tick %v: team change for unknown player %v", event.Tick, event.PlayerId)
+		}
+		ent.Team = event.Team
+
+	case EVENT_MOVEMENT:
+		ent, ok := s.entities[event.PlayerId]
+		if !ok || event.Movement == nil {
+			return fmt.Errorf("tick %v: bad movement change for player %v", event.Tick, event.PlayerId)
+		}
+		ent.Movement = *event.Movement
+
+	case EVENT_KNOCKBACK:
+		ent, ok := s.entities[event.PlayerId]
+		if !ok || event.Velocity == nil {
+			return fmt.Errorf("tick %v: bad knockback for player %v", event.Tick, event.PlayerId)
+		}
+		ent.Velocity = *event.Velocity
+	}
+
+	return nil
+}
+
+// Get the current tick
+func (s *Simulator) Tick() int64 {
+	return s.tick
+}
+
+// Get the entities which are in the world right now, ordered by ID, in the same form the server
+// sends them to clients.  Health isn't recorded, so it's left at zero.
+func (s *Simulator) MessageEntities() []protocol.MessageEntity {
+	ids := make([]int64, 0, len(s.entities))
+	for id, ent := range s.entities {
+		if ent.Active {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	msgEnts := make([]protocol.MessageEntity, 0, len(ids))
+	for _, id := range ids {
+		ent := s.entities[id]
+		msgEnt := protocol.CreateMessageEntity(ent.Id, ent.Username, ent.Team, ent.Position, ent.LastSeq)
+		msgEnt.Movement = ent.Movement
+		msgEnt.Velocity = ent.Velocity
+		msgEnts = append(msgEnts, msgEnt)
+	}
+
+	return msgEnts
+}
+
+// Compare every entity in a keyframe with the simulation, which has to have exactly the same
+// entities in the world.  Positions and velocities have to match exactly - the simulation does the
+// same float32 operations in the same order the server did.
+func (s *Simulator) checkKeyframe(event *Event) error {
+	active := 0
+	for _, ent := range s.entities {
+		if ent.Active {
+			active++
+		}
+	}
+	if active != len(event.Entities) {
+		return fmt.Errorf("tick %v: %v players in the simulation but %v in the recording",
+			event.Tick, active, len(event.Entities))
+	}
+
+	for _, recorded := range event.Entities {
+		ent, ok := s.entities[recorded.Id]
+		if !ok {
+			return fmt.Errorf("tick %v: keyframe has player %v which never joined", event.Tick, recorded.Id)
+		}
+		if !ent.Active {
+			return fmt.Errorf("tick %v: keyframe has player %v which already left", event.Tick, recorded.Id)
+		}
+
+		if ent.Position != recorded.Position {
+			return fmt.Errorf("tick %v: player %v is at %+v in the simulation but %+v in the recording",
+				event.Tick, recorded.Id, ent.Position, recorded.Position)
+		}
+		if ent.Velocity != recorded.Velocity {
+			return fmt.Errorf("tick %v: player %v is going %+v in the simulation but %+v in the recording",
+				event.Tick, recorded.Id, ent.Velocity, recorded.Velocity)
+		}
+	}
+
+	return nil
+}
+
+// Constructor, returns a pointer to an empty Simulator
+func CreateSimulator() *Simulator {
+	return &Simulator{entities: make(map[int64]*SimEntity), speed: shared.SPEED}
+}
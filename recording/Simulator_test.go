@@ -0,0 +1,131 @@
+package recording
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// A short match: players 1, 2 and 3 join, 1 and 3 move about, 2 leaves
+func simulatedMatch(t *testing.T) *Simulator {
+	t.Helper()
+	dt := shared.MDuration{Duration: 20 * time.Millisecond}
+	events := []*Event{
+		{Tick: 0, Kind: EVENT_JOIN, PlayerId: 1, Username: "alice", Position: &shared.FloatVector{X: 100, Y: 100}},
+		{Tick: 0, Kind: EVENT_JOIN, PlayerId: 2, Username: "bob", Position: &shared.FloatVector{X: 200, Y: 100}},
+		{Tick: 1, Kind: EVENT_JOIN, PlayerId: 3, Username: "carol", Position: &shared.FloatVector{X: 300, Y: 100}},
+		{Tick: 1, Kind: EVENT_INPUT, PlayerId: 1, Seq: 1, Dt: dt, Input: &shared.InputState{Actions: shared.ACTION_RIGHT}},
+		{Tick: 2, Kind: EVENT_INPUT, PlayerId: 1, Seq: 2, Dt: dt, Input: &shared.InputState{Actions: shared.ACTION_RIGHT | shared.ACTION_DOWN}},
+		{Tick: 2, Kind: EVENT_INPUT, PlayerId: 3, Seq: 1, Dt: dt, Input: &shared.InputState{Actions: shared.ACTION_UP}},
+		{Tick: 3, Kind: EVENT_LEAVE, PlayerId: 2},
+	}
+
+	s := CreateSimulator()
+	for _, event := range events {
+		if err := s.Apply(event); err != nil {
+			t.Fatalf("applying %+v: %v", event, err)
+		}
+	}
+	return s
+}
+
+func TestSimulatorKeyframes(t *testing.T) {
+	tests := []struct {
+		name string
+
+		// Makes the keyframe the server would have recorded, starting from what the simulation
+		// has
+		edit func(entities []protocol.MessageEntity) []protocol.MessageEntity
+
+		// Part of the error wanted, or empty if the keyframe should match
+		wantErr string
+	}{
+		{
+			name: "matches",
+			edit: func(entities []protocol.MessageEntity) []protocol.MessageEntity { return entities },
+		},
+		{
+			name: "position off",
+			edit: func(entities []protocol.MessageEntity) []protocol.MessageEntity {
+				entities[0].Position.X += 0.001
+				return entities
+			},
+			wantErr: "player 1 is at",
+		},
+		{
+			name: "velocity off",
+			edit: func(entities []protocol.MessageEntity) []protocol.MessageEntity {
+				entities[1].Velocity.Y = 0
+				return entities
+			},
+			wantErr: "player 3 is going",
+		},
+		{
+			name: "player missing",
+			edit: func(entities []protocol.MessageEntity) []protocol.MessageEntity {
+				return entities[:1]
+			},
+			wantErr: "2 players in the simulation but 1 in the recording",
+		},
+		{
+			name: "extra player",
+			edit: func(entities []protocol.MessageEntity) []protocol.MessageEntity {
+				return append(entities, protocol.CreateMessageEntity(2, "bob", "", shared.FloatVector{X: 200, Y: 100}, 0))
+			},
+			wantErr: "2 players in the simulation but 3 in the recording",
+		},
+		{
+			name: "player who already left",
+			edit: func(entities []protocol.MessageEntity) []protocol.MessageEntity {
+				return []protocol.MessageEntity{entities[0], protocol.CreateMessageEntity(2, "bob", "", shared.FloatVector{X: 200, Y: 100}, 0)}
+			},
+			wantErr: "player 2 which already left",
+		},
+		{
+			name: "player who never joined",
+			edit: func(entities []protocol.MessageEntity) []protocol.MessageEntity {
+				entities[1].Id = 99
+				return entities
+			},
+			wantErr: "player 99 which never joined",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := simulatedMatch(t)
+			keyframe := &Event{Tick: 4, Kind: EVENT_KEYFRAME, Entities: test.edit(s.MessageEntities())}
+
+			err := s.Apply(keyframe)
+			if test.wantErr == "" && err != nil {
+				t.Errorf("keyframe didn't match: %v", err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("got %v, wanted an error about %q", err, test.wantErr)
+			}
+			if s.Keyframes != 1 {
+				t.Errorf("%v keyframes counted, wanted 1", s.Keyframes)
+			}
+		})
+	}
+}
+
+func TestSimulatorRejoin(t *testing.T) {
+	s := simulatedMatch(t)
+
+	// Bob comes back where they left off, and is in the keyframes again
+	if err := s.Apply(&Event{Tick: 5, Kind: EVENT_JOIN, PlayerId: 2, Username: "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	entities := s.MessageEntities()
+	if len(entities) != 3 || entities[1].Id != 2 || entities[1].Position != (shared.FloatVector{X: 200, Y: 100}) {
+		t.Errorf("after rejoining the entities are %+v", entities)
+	}
+
+	if err := s.Apply(&Event{Tick: 5, Kind: EVENT_INPUT, PlayerId: 42, Dt: shared.MDuration{Duration: time.Millisecond}, Input: &shared.InputState{}}); err == nil {
+		t.Errorf("input for a player who never joined was accepted")
+	}
+}
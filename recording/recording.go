@@ -0,0 +1,246 @@
+// Recording writes a match to disk as it's played and reads it back for replay.  A recording is
+// a gzip compressed stream of JSON lines: a Header followed by one Event per line, in the order
+// they happened on the server.  Replaying the input events through the same movement code the
+// server uses must land every entity exactly where the keyframes say it was.
+package recording
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+)
+
+// Bump this whenever the meaning of a recording changes (for instance the movement model), so
+// old recordings aren't replayed through code that would give different results
+const FORMAT_VERSION = 6
+
+const (
+	// A player's entity was put into the world, either fresh or coming back from a reconnect
+	EVENT_JOIN EventKind = iota + 1
+
+	// A player's entity was taken out of the world
+	EVENT_LEAVE
+
+	// An input was accepted and applied to an entity
+	EVENT_INPUT
+
+	// An entity was moved by the server directly, not by input (rubber-banding, for instance).  It
+	// stops dead wherever it ends up.
+	EVENT_TELEPORT
+
+	// Where every entity in the world was at the end of a tick
+	EVENT_KEYFRAME
+
+	// The room's speed or tick length changed.  Every recording starts with one of these.
+	EVENT_SETTINGS
+
+	// A player was put on a team, or taken off one
+	EVENT_TEAM
+
+	// The way a player moves changed: they came into the world, a speed boost started or wore
+	// off, or the room's speed was changed
+	EVENT_MOVEMENT
+
+	// An entity was knocked back, which changed its velocity
+	EVENT_KNOCKBACK
+)
+
+// What kind of thing an Event records
+type EventKind int
+
+// First line of every recording
+type Header struct {
+	Version      int
+	StartTime    time.Time
+	TickDuration time.Duration
+}
+
+// One thing which happened during the match.  Which fields are filled in depends on the kind.
+type Event struct {
+	Tick     int64
+	Kind     EventKind
+	PlayerId int64               `json:",omitempty"`
+	Username string              `json:",omitempty"`
+	Position *shared.FloatVector `json:",omitempty"`
+	Input    *shared.InputState  `json:",omitempty"`
+	Dt       shared.MDuration
+	Seq      int64                    `json:",omitempty"`
+	Entities []protocol.MessageEntity `json:",omitempty"`
+
+	// Only for EVENT_SETTINGS
+	Speed        float32       `json:",omitempty"`
+	TickDuration time.Duration `json:",omitempty"`
+
+	// Only for EVENT_TEAM.  Empty when the player was taken off their team.
+	Team string `json:",omitempty"`
+
+	// Only for EVENT_MOVEMENT and EVENT_JOIN.  How the player moves from now on.
+	Movement *shared.MovementParams `json:",omitempty"`
+
+	// Only for EVENT_KNOCKBACK and EVENT_JOIN.  The player's velocity from now on.
+	Velocity *shared.FloatVector `json:",omitempty"`
+}
+
+// Returned when writing to a recording which has already been closed
+var ErrClosed = errors.New("recording is closed")
+
+// Writes events to a recording file.  Safe to use from several goroutines - events end up in the
+// file in the order Record was called.
+type Recorder struct {
+	lock    *sync.Mutex
+	file    *os.File
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	encoder *json.Encoder
+
+	// The server's current tick, stamped onto events recorded from outside the main loop
+	tick int64
+
+	// Set once the file has been closed, after which nothing more gets written
+	closed bool
+}
+
+// Record an event.  Events without a tick get the current one.
+func (r *Recorder) Record(event Event) error {
+	if event.Tick == 0 {
+		event.Tick = r.Tick()
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	return r.encoder.Encode(event)
+}
+
+// Set the current tick.  Called by the main loop at the start of each tick.
+func (r *Recorder) SetTick(tick int64) {
+	atomic.StoreInt64(&r.tick, tick)
+}
+
+// Get the current tick
+func (r *Recorder) Tick() int64 {
+	return atomic.LoadInt64(&r.tick)
+}
+
+// Push everything recorded so far out to the file, so a crash loses as little as possible
+func (r *Recorder) Flush() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+
+	if err := r.buf.Flush(); err != nil {
+		return err
+	}
+	return r.gz.Flush()
+}
+
+// Finish the recording and close the file.  Anything recorded afterwards gets ErrClosed.
+func (r *Recorder) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	r.closed = true
+
+	if err := r.buf.Flush(); err != nil {
+		return err
+	}
+	if err := r.gz.Close(); err != nil {
+		return err
+	}
+	return r.file.Close()
+}
+
+// Create a new recording at the given path, overwriting anything already there
+func CreateRecorder(path string, tickDuration time.Duration) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(file)
+	buf := bufio.NewWriter(gz)
+	r := &Recorder{
+		lock:    new(sync.Mutex),
+		file:    file,
+		gz:      gz,
+		buf:     buf,
+		encoder: json.NewEncoder(buf),
+	}
+
+	err = r.encoder.Encode(Header{Version: FORMAT_VERSION, StartTime: time.Now(), TickDuration: tickDuration})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reads events back out of a recording file
+type Reader struct {
+	file    *os.File
+	decoder *json.Decoder
+	Header  Header
+}
+
+// Get the next event.  Returns io.EOF at the end of the recording.  A recording which was cut
+// off (the server was killed before it could close it) simply ends at the last complete event.
+func (r *Reader) Next() (*Event, error) {
+	event := new(Event)
+	err := r.decoder.Decode(event)
+	if err == io.ErrUnexpectedEOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// Close the file
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// Open a recording and read its header
+func OpenReader(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	r := &Reader{file: file, decoder: json.NewDecoder(gz)}
+	if err := r.decoder.Decode(&r.Header); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if r.Header.Version != FORMAT_VERSION {
+		file.Close()
+		return nil, errors.New("recording was made with a different format version")
+	}
+
+	return r, nil
+}
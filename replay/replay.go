@@ -0,0 +1,172 @@
+// Replay plays back a match recorded with mpgtserver -record.  By default it runs the recording
+// through the simulator as fast as it can and checks every keyframe, which is a quick way to tell
+// whether the movement code still behaves the way it did when the match was played.  With -stream
+// it pretends to be a server instead and plays the match to a connected client at its original
+// speed, so it can be watched.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/gabriel-comeau/multiplayer-game-test/logging"
+	"github.com/gabriel-comeau/multiplayer-game-test/protocol"
+	"github.com/gabriel-comeau/multiplayer-game-test/recording"
+	"github.com/gabriel-comeau/multiplayer-game-test/shared"
+	"github.com/gabriel-comeau/multiplayer-game-test/transport"
+)
+
+// Player ID handed to viewers.  Never used by a real player, so the client treats every entity it
+// is sent as someone else's.
+const VIEWER_ID int64 = -1
+
+var replayLog = logging.For("replay")
+
+func main() {
+	stream := flag.Bool("stream", false, "play the recording to a connecting client instead of just verifying it")
+	addr := flag.String("addr", ":"+shared.PORT, "address to wait for the viewing client on, for -stream")
+	speed := flag.Float64("speed", 1, "playback speed for -stream, 2 is twice as fast")
+	logFlags := logging.RegisterFlags()
+	flag.Parse()
+
+	if err := logFlags.Apply(); err != nil {
+		logging.Fatal(replayLog, "Bad logging configuration", logging.ERROR, err)
+	}
+
+	if flag.NArg() != 1 {
+		logging.Fatal(replayLog, "Usage: replay [flags] recording-file")
+	}
+
+	if *speed <= 0 {
+		logging.Fatal(replayLog, "-speed has to be more than zero")
+	}
+
+	reader, err := recording.OpenReader(flag.Arg(0))
+	if err != nil {
+		logging.Fatal(replayLog, "Couldn't open recording", logging.ERROR, err)
+	}
+	defer reader.Close()
+
+	replayLog.Info("Opened recording", "started", reader.Header.StartTime, "tick", reader.Header.TickDuration)
+
+	if *stream {
+		conn := waitForViewer(*addr)
+		defer conn.Close()
+		err = play(reader, conn, *speed)
+	} else {
+		err = play(reader, nil, 1)
+	}
+
+	if err != nil {
+		replayLog.Error("Replay failed", logging.ERROR, err)
+		os.Exit(1)
+	}
+}
+
+// Run every event in the recording through the simulator.  If there's a viewer connection, the
+// world state is sent to it at the end of every tick and playback is slowed down to the speed the
+// match was played at, times the given speed.  Stops at the first keyframe which doesn't match.
+func play(reader *recording.Reader, viewer net.Conn, speed float64) error {
+	sim := recording.CreateSimulator()
+	events := 0
+	var nextTick time.Time
+	tickDuration := time.Duration(float64(reader.Header.TickDuration) / speed)
+
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// Moving on to a new tick means the last one is finished - show it.  Ticks where nothing
+		// happened aren't in the recording, but they still have to take up time.
+		if viewer != nil && event.Tick != sim.Tick() && events > 0 {
+			nextTick = sendTick(viewer, sim, nextTick, tickDuration)
+			nextTick = nextTick.Add(time.Duration(event.Tick-sim.Tick()-1) * tickDuration)
+		}
+
+		if err := sim.Apply(event); err != nil {
+			return err
+		}
+		if event.Kind == recording.EVENT_SETTINGS && event.TickDuration > 0 {
+			tickDuration = time.Duration(float64(event.TickDuration) / speed)
+		}
+		events++
+	}
+
+	if viewer != nil {
+		sendTick(viewer, sim, nextTick, tickDuration)
+		viewer.Write(protocol.CreateDisconnectMessage("replay finished").Encode())
+	}
+
+	replayLog.Info("Replay finished", "events", events, "ticks", sim.Tick(), "keyframes", sim.Keyframes)
+	return nil
+}
+
+// Send the simulator's world state to the viewer, after waiting until it's time for the tick.
+// Returns when the tick after this one is due.
+func sendTick(viewer net.Conn, sim *recording.Simulator, due time.Time, tickDuration time.Duration) time.Time {
+	if wait := time.Until(due); wait > 0 {
+		time.Sleep(wait)
+	}
+
+	viewer.Write(protocol.CreateWorldStateMessage(sim.MessageEntities(), nil).Encode())
+
+	now := time.Now()
+	if due.IsZero() || now.Sub(due) > tickDuration {
+		// First tick, or we've fallen behind - don't try to catch up by rushing
+		due = now
+	}
+	return due.Add(tickDuration)
+}
+
+// Wait for a client to connect and go through the join handshake.  The client is given the viewer
+// ID, and whatever it sends after that is thrown away.
+func waitForViewer(addr string) net.Conn {
+	listener, err := transport.Listen(addr, nil)
+	if err != nil {
+		logging.Fatal(replayLog, "Couldn't listen", logging.ERROR, err)
+	}
+	defer listener.Close()
+
+	replayLog.Info("Waiting for a viewer", logging.ADDR, listener.Addr().String())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			logging.Fatal(replayLog, "Error during accept", logging.ERROR, err)
+		}
+
+		b := bufio.NewReader(conn)
+		line, err := b.ReadBytes('\n')
+		if err == nil {
+			var message protocol.Message
+			message, err = protocol.DecodeMessage(line)
+			if _, ok := message.(*protocol.JoinMessage); err == nil && !ok {
+				err = errors.New("expected JOIN_MESSAGE as the first message")
+			}
+		}
+		if err != nil {
+			replayLog.Warn("Viewer didn't join properly", logging.ADDR, conn.RemoteAddr().String(), logging.ERROR, err)
+			conn.Close()
+			continue
+		}
+
+		conn.Write(protocol.CreatePlayerUUIDMessage(VIEWER_ID, "").Encode())
+		replayLog.Info("Viewer connected", logging.ADDR, conn.RemoteAddr().String())
+
+		// The viewer's input doesn't go anywhere, but it has to be read so the client doesn't
+		// block writing it
+		go io.Copy(io.Discard, b)
+
+		return conn
+	}
+}
@@ -0,0 +1,21 @@
+package shared
+
+// An axis aligned rectangle, with its top left corner at X, Y.  Used for the parts of a map which
+// are in the way, on both the server and the client.
+type FloatRect struct {
+	X      float32
+	Y      float32
+	Width  float32
+	Height float32
+}
+
+// Whether this rectangle and another overlap.  Rectangles which only touch along an edge don't.
+func (r FloatRect) Intersects(other FloatRect) bool {
+	return r.X < other.X+other.Width && other.X < r.X+r.Width &&
+		r.Y < other.Y+other.Height && other.Y < r.Y+r.Height
+}
+
+// The square an entity at the given position takes up
+func EntityRect(pos FloatVector) FloatRect {
+	return FloatRect{X: pos.X, Y: pos.Y, Width: ENTITY_SIZE, Height: ENTITY_SIZE}
+}
@@ -1,32 +1,121 @@
 package shared
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Something a player can do.  Every action has its own bit, so a whole set of them can be held in
+// one Action and goes over the network as a single small number.
+type Action uint16
+
+const (
+	ACTION_LEFT Action = 1 << iota
+	ACTION_RIGHT
+	ACTION_DOWN
+	ACTION_UP
+
+	// Move SPRINT_FACTOR times faster than usual
+	ACTION_SPRINT
+
+	// Nothing on the server does anything with these yet, but they get there and into recordings
+	// like everything else
+	ACTION_FIRE
+	ACTION_INTERACT
+)
+
+// Every action by the name it goes by in key bindings files
+var actionNames = map[string]Action{
+	"left":     ACTION_LEFT,
+	"right":    ACTION_RIGHT,
+	"down":     ACTION_DOWN,
+	"up":       ACTION_UP,
+	"sprint":   ACTION_SPRINT,
+	"fire":     ACTION_FIRE,
+	"interact": ACTION_INTERACT,
+}
+
+// Look up an action by its name
+func ParseAction(name string) (Action, error) {
+	action, ok := actionNames[strings.ToLower(name)]
+	if !ok {
+		names := make([]string, 0, len(actionNames))
+		for name := range actionNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return 0, fmt.Errorf("unknown action %q, try %v", name, strings.Join(names, ", "))
+	}
+	return action, nil
+}
+
+// The names of the actions in the set, joined with +, or "none"
+func (a Action) String() string {
+	names := make([]string, 0)
+	for name, action := range actionNames {
+		if a&action != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	sort.Strings(names)
+	return strings.Join(names, "+")
+}
+
 // A simple structure to keep track of the given input from the client.  Instead of just sending
-// keypresses directly, we can use this so multiple (or no) keypresses can be sent in one go.
+// keypresses directly, we can use this so multiple (or no) actions can be sent in one go.  Which
+// keys do what is up to the client, the server only ever sees the actions.
 type InputState struct {
-	KeyLeftDown  bool
-	KeyRightDown bool
-	KeyDownDown  bool
-	KeyUpDown    bool
+	// The actions being done right now, one bit each
+	Actions Action
+
+	// Which way the player is aiming, as a direction from the middle of their entity, for
+	// anything pointed with a mouse or an analog stick.  Nil when they aren't aiming anywhere.
+	Aim *FloatVector `json:",omitempty"`
+}
+
+// Check whether an action is being done
+func (i *InputState) Has(action Action) bool {
+	return i.Actions&action != 0
 }
 
-// Check if any of the key in the state are actually being pressed.
+// Start or stop doing an action
+func (i *InputState) Set(action Action, doing bool) {
+	if doing {
+		i.Actions |= action
+	} else {
+		i.Actions &^= action
+	}
+}
+
+// Check if any of the actions in the state are actually being done.
 func (i *InputState) HasInput() bool {
+	return i.Actions != 0
+}
+
+// Which way the movement actions point along each axis: -1, 0 or 1.  Opposite directions cancel
+// each other out.
+func (i *InputState) Direction() FloatVector {
+	direction := FloatVector{X: 0, Y: 0}
 
-	if i.KeyLeftDown {
-		return true
+	if i.Has(ACTION_DOWN) && !i.Has(ACTION_UP) {
+		direction.Y = 1
 	}
 
-	if i.KeyRightDown {
-		return true
+	if i.Has(ACTION_UP) && !i.Has(ACTION_DOWN) {
+		direction.Y = -1
 	}
 
-	if i.KeyDownDown {
-		return true
+	if i.Has(ACTION_LEFT) && !i.Has(ACTION_RIGHT) {
+		direction.X = -1
 	}
 
-	if i.KeyUpDown {
-		return true
+	if i.Has(ACTION_RIGHT) && !i.Has(ACTION_LEFT) {
+		direction.X = 1
 	}
 
-	return false
+	return direction
 }
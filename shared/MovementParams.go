@@ -0,0 +1,42 @@
+package shared
+
+// How an entity moves.  Every entity has its own, so one player can be faster than another, and
+// the server sends each entity's along with its position so a client can predict its own movement
+// with exactly the numbers the server will use.
+type MovementParams struct {
+	// Top speed the entity can get itself up to, in pixels per second.  Something else, like a
+	// knockback, can push it faster than this for a while, up to MAX_VELOCITY.
+	MaxSpeed float32
+
+	// How quickly the entity speeds up towards where its keys point, and how quickly it slows to
+	// a stop once it lets go of them, in pixels per second per second.  Zero means straight away.
+	Acceleration float32
+	Friction     float32
+
+	// How much of its velocity the entity loses every second on top of that, whether it's holding
+	// keys down or not, as a fraction.  Zero means none.
+	Drag float32
+
+	// Whether moving diagonally is held to MaxSpeed like moving along one axis is.  Without it a
+	// diagonal is about 1.41 times as fast, since it's full speed along both axes at once.
+	NormalizeDiagonals bool
+}
+
+// The same movement at factor times the speed.  Acceleration goes up along with the top speed, so
+// getting up to speed takes just as long as before.
+func (m MovementParams) Scaled(factor float32) MovementParams {
+	m.MaxSpeed *= factor
+	m.Acceleration *= factor
+	return m
+}
+
+// The movement entities get unless something says otherwise: SPEED, getting up to it and back to a
+// stop in about a tenth of a second, no drag, and diagonals no faster than straight lines
+func DefaultMovementParams() MovementParams {
+	return MovementParams{
+		MaxSpeed:           SPEED,
+		Acceleration:       ACCELERATION,
+		Friction:           FRICTION,
+		NormalizeDiagonals: true,
+	}
+}
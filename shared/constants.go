@@ -25,6 +25,27 @@ const (
 	// Path to the root of the textures folder
 	TEXTURE_ROOT = "./data/images/"
 
+	// *******************************************
+	//                                           *
+	// Sizes                                     *
+	//                                           *
+	// *******************************************
+
+	// Width and height of an entity's square, in pixels.  Matches the size of the textures.
+	ENTITY_SIZE float32 = 64
+
+	// Width and height of a pickup's square, in pixels.  Matches the size of the textures.
+	PICKUP_SIZE float32 = 32
+
+	// *******************************************
+	//                                           *
+	// Health                                    *
+	//                                           *
+	// *******************************************
+
+	// Health players start with, and the most they can have
+	MAX_HEALTH int = 100
+
 	// *******************************************
 	//                                           *
 	// Velocities and speeds                     *
@@ -34,6 +55,16 @@ const (
 	// How fast (pixels per second)
 	SPEED float32 = 300
 
+	// How many times faster entities move while sprinting
+	SPRINT_FACTOR float32 = 1.5
+
+	// How quickly entities get up to speed and slow back down (pixels per second per second)
+	ACCELERATION float32 = 3000
+	FRICTION     float32 = 3000
+
+	// Nothing moves faster than this (pixels per second), however hard it gets knocked back
+	MAX_VELOCITY float32 = 2000
+
 	// Clamp val
 	MAX_DT time.Duration = time.Second / 20
 
@@ -1,29 +1,76 @@
 package shared
 
-// Taking into account the max speed constant (pixels per second an object can move),
-// use the current input and the frame time to create a vector representing the offset for how
-// far a unit moved and in which direction.
+import "math"
+
+// How much each axis of a diagonal move is scaled down by so the move as a whole is no longer than
+// a straight one, which is one over the square root of two.  Written out as a float32 so the
+// client, the server and the replay simulator all get exactly the same result.
+const DIAGONAL_FACTOR float32 = 0.70710677
+
+// Use the current input, the frame time and the way the entity moves to step the entity's velocity
+// forward, and create a vector representing the offset for how far it moved and in which
+// direction.  The velocity is updated in place.
+//
+// Each axis of the velocity heads towards the velocity the actions ask for - full speed in their
+// direction, faster when sprinting, or standing still - by at most Acceleration (or Friction, when
+// not moving) times the frame time, after drag has taken its share.  The entity then moves by its
+// new velocity.
 //
-// Both the client and the server use this calculation so it belongs to the shared package.
-func GetVectorFromInputAndDt(inputState *InputState, dt MDuration) FloatVector {
+// Both the client and the server use this calculation so it belongs to the shared package.  The
+// client predicting its own movement only works because it comes out exactly the same on both, so
+// the velocity has to be carried from one input to the next just like the position is.
+func GetMovement(inputState *InputState, dt MDuration, params MovementParams, velocity *FloatVector) FloatVector {
 	dtFloatSeconds := float32(dt.Seconds())
-	velocity := FloatVector{X: 0, Y: 0}
+	direction := inputState.Direction()
+
+	speed := params.MaxSpeed
+	if inputState.Has(ACTION_SPRINT) {
+		speed *= SPRINT_FACTOR
+	}
+	if params.NormalizeDiagonals && direction.X != 0 && direction.Y != 0 {
+		speed *= DIAGONAL_FACTOR
+	}
+	target := FloatVector{X: direction.X * speed, Y: direction.Y * speed}
 
-	if inputState.KeyDownDown && !inputState.KeyUpDown {
-		velocity.Y = (SPEED * dtFloatSeconds)
+	v := *velocity
+	if params.Drag > 0 {
+		keep := max(1-params.Drag*dtFloatSeconds, 0)
+		v = FloatVector{X: v.X * keep, Y: v.Y * keep}
 	}
 
-	if inputState.KeyUpDown && !inputState.KeyDownDown {
-		velocity.Y = (SPEED * dtFloatSeconds) * -1
+	// A rate of zero means the entity gets there straight away, however little time has passed
+	rate := params.Acceleration
+	if direction.X == 0 && direction.Y == 0 {
+		rate = params.Friction
+	}
+	if rate > 0 {
+		v.X = approach(v.X, target.X, rate*dtFloatSeconds)
+		v.Y = approach(v.Y, target.Y, rate*dtFloatSeconds)
+	} else {
+		v = target
 	}
 
-	if inputState.KeyLeftDown && !inputState.KeyRightDown {
-		velocity.X = (SPEED * dtFloatSeconds) * -1
+	*velocity = ClampVelocity(v)
+	return FloatVector{X: velocity.X * dtFloatSeconds, Y: velocity.Y * dtFloatSeconds}
+}
+
+// Move from one value towards another by at most step, without going past it
+func approach(from, to, step float32) float32 {
+	switch {
+	case from < to:
+		return min(from+step, to)
+	default:
+		return max(from-step, to)
 	}
+}
 
-	if inputState.KeyRightDown && !inputState.KeyLeftDown {
-		velocity.X = (SPEED * dtFloatSeconds)
+// The velocity slowed down to MAX_VELOCITY if it's any faster, keeping its direction
+func ClampVelocity(v FloatVector) FloatVector {
+	squared := v.X*v.X + v.Y*v.Y
+	if squared <= MAX_VELOCITY*MAX_VELOCITY {
+		return v
 	}
 
-	return velocity
+	scale := MAX_VELOCITY / float32(math.Sqrt(float64(squared)))
+	return FloatVector{X: v.X * scale, Y: v.Y * scale}
 }
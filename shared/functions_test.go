@@ -0,0 +1,112 @@
+package shared
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// Close enough for float32 maths done in a slightly different order
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 0.001
+}
+
+func TestGetMovement(t *testing.T) {
+	// Gets to any speed in a single step, whatever the frame time
+	instant := MovementParams{MaxSpeed: SPEED, NormalizeDiagonals: true}
+
+	tests := []struct {
+		name     string
+		actions  Action
+		dt       time.Duration
+		params   MovementParams
+		velocity FloatVector
+
+		wantVelocity FloatVector
+		wantOffset   FloatVector
+	}{
+		{
+			name: "standing still", actions: 0, dt: 100 * time.Millisecond,
+			params: DefaultMovementParams(),
+		},
+		{
+			name: "right at full speed", actions: ACTION_RIGHT, dt: 100 * time.Millisecond,
+			params:       instant,
+			wantVelocity: FloatVector{X: 300}, wantOffset: FloatVector{X: 30},
+		},
+		{
+			name: "up is negative", actions: ACTION_UP, dt: 100 * time.Millisecond,
+			params:       instant,
+			wantVelocity: FloatVector{Y: -300}, wantOffset: FloatVector{Y: -30},
+		},
+		{
+			name: "opposite actions cancel out", actions: ACTION_LEFT | ACTION_RIGHT, dt: 100 * time.Millisecond,
+			params: instant,
+		},
+		{
+			name: "sprinting", actions: ACTION_LEFT | ACTION_SPRINT, dt: 100 * time.Millisecond,
+			params:       instant,
+			wantVelocity: FloatVector{X: -450}, wantOffset: FloatVector{X: -45},
+		},
+		{
+			name: "normalized diagonal", actions: ACTION_DOWN | ACTION_RIGHT, dt: 100 * time.Millisecond,
+			params:       instant,
+			wantVelocity: FloatVector{X: 212.132, Y: 212.132}, wantOffset: FloatVector{X: 21.2132, Y: 21.2132},
+		},
+		{
+			name: "unnormalized diagonal", actions: ACTION_DOWN | ACTION_RIGHT, dt: 100 * time.Millisecond,
+			params:       MovementParams{MaxSpeed: SPEED},
+			wantVelocity: FloatVector{X: 300, Y: 300}, wantOffset: FloatVector{X: 30, Y: 30},
+		},
+		{
+			name: "accelerating from a standstill", actions: ACTION_RIGHT, dt: 50 * time.Millisecond,
+			params:       DefaultMovementParams(),
+			wantVelocity: FloatVector{X: 150}, wantOffset: FloatVector{X: 7.5},
+		},
+		{
+			name: "acceleration stops at top speed", actions: ACTION_RIGHT, dt: 50 * time.Millisecond,
+			params: DefaultMovementParams(), velocity: FloatVector{X: 250},
+			wantVelocity: FloatVector{X: 300}, wantOffset: FloatVector{X: 15},
+		},
+		{
+			name: "friction slows to a stop", actions: 0, dt: 50 * time.Millisecond,
+			params: DefaultMovementParams(), velocity: FloatVector{X: 300, Y: -100},
+			wantVelocity: FloatVector{X: 150}, wantOffset: FloatVector{X: 7.5},
+		},
+		{
+			name: "turning round", actions: ACTION_LEFT, dt: 50 * time.Millisecond,
+			params: DefaultMovementParams(), velocity: FloatVector{X: 300},
+			wantVelocity: FloatVector{X: 150}, wantOffset: FloatVector{X: 7.5},
+		},
+		{
+			name: "drag", actions: 0, dt: 100 * time.Millisecond,
+			params: MovementParams{MaxSpeed: SPEED, Friction: 1, Drag: 5}, velocity: FloatVector{X: 1000},
+			wantVelocity: FloatVector{X: 499.9}, wantOffset: FloatVector{X: 49.99},
+		},
+		{
+			name: "knockback clamped to the max velocity", actions: 0, dt: 10 * time.Millisecond,
+			params: DefaultMovementParams(), velocity: FloatVector{X: 0, Y: 5000},
+			wantVelocity: FloatVector{Y: MAX_VELOCITY}, wantOffset: FloatVector{Y: 20},
+		},
+		{
+			name: "no time passing", actions: ACTION_RIGHT, dt: 0,
+			params: DefaultMovementParams(), velocity: FloatVector{X: 100},
+			wantVelocity: FloatVector{X: 100},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := &InputState{Actions: test.actions}
+			velocity := test.velocity
+			offset := GetMovement(input, MDuration{test.dt}, test.params, &velocity)
+
+			if !near(velocity.X, test.wantVelocity.X) || !near(velocity.Y, test.wantVelocity.Y) {
+				t.Errorf("velocity %v, wanted %v", velocity, test.wantVelocity)
+			}
+			if !near(offset.X, test.wantOffset.X) || !near(offset.Y, test.wantOffset.Y) {
+				t.Errorf("offset %v, wanted %v", offset, test.wantOffset)
+			}
+		})
+	}
+}
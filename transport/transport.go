@@ -0,0 +1,172 @@
+// Transport takes care of opening network connections between the clients and the server, either
+// as plain TCP or wrapped in TLS.  Everything that talks to the network goes through here so the
+// server, the client and the load tester all agree on how TLS is set up.
+package transport
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// How long a generated development certificate is good for
+const SELF_SIGNED_VALIDITY time.Duration = 365 * 24 * time.Hour
+
+// Open a connection to the server.  A nil config means plain TCP.
+func Dial(address string, tlsConfig *tls.Config) (net.Conn, error) {
+	if tlsConfig == nil {
+		return net.Dial("tcp", address)
+	}
+
+	return tls.Dial("tcp", address, tlsConfig)
+}
+
+// Start listening for connections.  A nil config means plain TCP.
+func Listen(address string, tlsConfig *tls.Config) (net.Listener, error) {
+	if tlsConfig == nil {
+		return net.Listen("tcp", address)
+	}
+
+	return tls.Listen("tcp", address, tlsConfig)
+}
+
+// Build the TLS config for the client side of a connection.  If pin is set, the server's
+// certificate is accepted if and only if its SHA-256 fingerprint matches the pin, which is how a
+// self-signed development certificate can be trusted.  Otherwise the certificate is checked
+// against the system roots as usual, unless insecure is set in which case anything goes.
+func ClientConfig(serverName, pin string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if pin != "" {
+		want, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+		if err != nil || len(want) != sha256.Size {
+			return nil, errors.New("certificate pin must be a hex SHA-256 fingerprint")
+		}
+
+		// Normal chain verification is replaced by the fingerprint check
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			got := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(got[:], want) {
+				return fmt.Errorf("server certificate fingerprint %x doesn't match the pin", got)
+			}
+			return nil
+		}
+	} else if insecure {
+		cfg.InsecureSkipVerify = true
+	}
+
+	return cfg, nil
+}
+
+// Build the TLS config for the server side.  The certificate and key are loaded from the given
+// paths.  If selfSigned is set and the files don't exist yet, a development certificate is
+// generated and written there first (or only kept in memory if no paths were given).
+func ServerConfig(certPath, keyPath string, selfSigned bool) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+
+	if selfSigned && !fileExists(certPath) {
+		cert, err = generateSelfSigned(certPath, keyPath)
+	} else {
+		cert, err = tls.LoadX509KeyPair(certPath, keyPath)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// Get the SHA-256 fingerprint of a certificate, in the format ClientConfig takes as a pin
+func Fingerprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256(cert.Certificate[0])
+	return hex.EncodeToString(sum[:])
+}
+
+// Make a certificate for localhost signed by its own key, and save it if paths were given
+func generateSelfSigned(certPath, keyPath string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "multiplayer-game-test development"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(SELF_SIGNED_VALIDITY),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+
+	if certPath != "" && keyPath != "" {
+		if err := os.WriteFile(keyPath, keyPem, 0600); err != nil {
+			return tls.Certificate{}, err
+		}
+		if err := os.WriteFile(certPath, certPem, 0644); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	return tls.X509KeyPair(certPem, keyPem)
+}
+
+// Check if there's something at the path
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+
+	_, err := os.Stat(path)
+	return err == nil
+}